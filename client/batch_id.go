@@ -0,0 +1,23 @@
+package client
+
+import "context"
+
+// HeaderBatchID is sent with every attempt of a batch. Retries of the same messages have the same ID,
+// so receivers can deduplicate them. A retry of some of the messages has an ID derived from the batch ID,
+// because its content is different: halves of a batch rejected as too large get ".0" and ".1",
+// messages rejected in an accepted batch get ".r" and the attempt that rejected them.
+const HeaderBatchID = "X-Notifier-Batch-Id"
+
+type batchIDKey struct{}
+
+// WithBatchID returns ctx that carries ID of the batch being sent.
+func WithBatchID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, batchIDKey{}, id)
+}
+
+// BatchID returns ID of the batch a Transport or HTTPClient is sending with ctx, or empty string
+// if ctx doesn't carry it.
+func BatchID(ctx context.Context) string {
+	id, _ := ctx.Value(batchIDKey{}).(string)
+	return id
+}
@@ -5,8 +5,6 @@ import (
 	"net/http"
 
 	"notifier/errs"
-	"notifier/log"
-	"notifier/log/tag"
 )
 
 // HTTPClient decouples dependency on specific HTTP requesting library.
@@ -14,15 +12,24 @@ type HTTPClient interface {
 	Do(ctx context.Context, req *http.Request) (*http.Response, error)
 }
 
+// Transport delivers batches of messages whatever the protocol is. Sender sends every batch with a single Send
+// and retries failed ones by itself. Failures are classified by retry.Policy with the response of *retry.Error,
+// so transports other than HTTP describe them with the closest HTTP status. Rejected messages of an accepted
+// batch are reported as *errs.DeliveryError with Rejected indexes.
+type Transport interface {
+	Send(ctx context.Context, msgs []string) error
+}
+
 // ErrorHandler Allows the caller to handle notification failures in case any requests fail.
 // Check r for nil!
 type ErrorHandler func(r *http.Response, err error) error
 
+// DefaultErrorHandler returns *errs.DeliveryError for failed requests and unsuccessful statuses.
+// It wraps errs.ErrValidation for 400, errs.ErrNotFound for 404 and errs.ErrInternal for other statuses.
+// Failures are logged by DefaultHTTPClient with tags of the batch.
 func DefaultErrorHandler(r *http.Response, err error) error {
 	if err != nil {
-		log.Error("failed perform request", err)
-
-		return err
+		return errs.NewDeliveryError(r, err)
 	}
 
 	if r == nil {
@@ -35,12 +42,10 @@ func DefaultErrorHandler(r *http.Response, err error) error {
 
 	switch r.StatusCode {
 	case http.StatusNotFound:
-		return errs.Wrap(errs.ErrNotFound, r.Request.URL.Path)
+		return errs.NewDeliveryError(r, errs.Wrap(errs.ErrNotFound, r.Request.URL.Path))
 	case http.StatusBadRequest:
-		log.ErrorContext(r.Request.Context(), "bad request", tag.HTTPCode, r.StatusCode)
-		return errs.Wrap(errs.ErrValidation, r.Request.URL.Path)
+		return errs.NewDeliveryError(r, errs.Wrap(errs.ErrValidation, r.Request.URL.Path))
 	default:
-		log.ErrorContext(r.Request.Context(), "unexpected status code", tag.HTTPCode, r.StatusCode)
-		return errs.Wrap(errs.ErrInternal, r.Request.URL.Path)
+		return errs.NewDeliveryError(r, errs.Wrap(errs.ErrInternal, r.Request.URL.Path))
 	}
 }
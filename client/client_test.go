@@ -108,3 +108,19 @@ func TestDefaultErrorHandler(t *testing.T) {
 		)
 	}
 }
+
+func TestDefaultErrorHandler_Returns_Delivery_Error(t *testing.T) {
+	t.Parallel()
+
+	err := DefaultErrorHandler(newResponse(t, http.StatusBadRequest, `{"error":"invalid fields"}`), nil)
+
+	var derr *errs.DeliveryError
+	if !errors.As(err, &derr) {
+		t.Fatalf("DefaultErrorHandler() error = %T, want *errs.DeliveryError", err)
+	}
+
+	if derr.StatusCode != http.StatusBadRequest || derr.Body != `{"error":"invalid fields"}` ||
+		derr.Class != errs.ClassPermanent {
+		t.Errorf("DefaultErrorHandler() error = %+v", derr)
+	}
+}
@@ -1,10 +1,16 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/go-resty/resty/v2"
+
+	"notifier/log"
+	"notifier/log/tag"
 )
 
 type DefaultHTTPClient struct {
@@ -12,6 +18,8 @@ type DefaultHTTPClient struct {
 	errorHandler ErrorHandler
 }
 
+// DefaultRetryCondition retries requests that failed with 500 when resty retries are enabled.
+// Notifier retries requests by itself with retry.Policy, so resty retries are disabled by default.
 func DefaultRetryCondition(r *resty.Response, _ error) bool {
 	return r.StatusCode() == http.StatusInternalServerError
 }
@@ -30,7 +38,8 @@ func (r *DefaultHTTPClient) Do(
 	ctx context.Context,
 	req *http.Request,
 ) (*http.Response, error) {
-	restyReq := r.c.R().SetContext(ctx).SetBody(req.Body)
+	restyReq := r.c.R().SetContext(ctx).SetHeaderMultiValues(req.Header).SetBody(req.Body)
+	start := time.Now()
 
 	resp, err := restyReq.Execute(
 		req.Method, func() string {
@@ -40,17 +49,34 @@ func (r *DefaultHTTPClient) Do(
 			return req.URL.String()
 		}(),
 	)
-	if err = r.errorHandler(getRawResponse(resp), err); err != nil {
-		return nil, err
+	raw := getRawResponse(resp)
+
+	args := []interface{}{tag.Latency, time.Since(start).Milliseconds()}
+	if raw != nil {
+		args = append(args, tag.HTTPCode, raw.StatusCode)
+	}
+
+	// response is returned along with the error, so callers can decide whether to retry by its status
+	if err = r.errorHandler(raw, err); err != nil {
+		log.FromContext(ctx).WarnContext(ctx, "http: request failed", append(args, tag.Err, err)...)
+		return raw, err
 	}
 
-	return getRawResponse(resp), nil
+	log.FromContext(ctx).DebugContext(ctx, "http: request sent", args...)
+
+	return raw, nil
 }
 
+// getRawResponse returns the response with the body restored, resty reads the raw body by itself
+// unless it's told not to parse the response.
 func getRawResponse(resp *resty.Response) *http.Response {
-	if resp == nil {
+	if resp == nil || resp.RawResponse == nil {
 		return nil
 	}
 
+	if resp.Body() != nil {
+		resp.RawResponse.Body = io.NopCloser(bytes.NewReader(resp.Body()))
+	}
+
 	return resp.RawResponse
 }
@@ -0,0 +1,306 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"notifier/clock"
+	"notifier/errs"
+)
+
+// DefaultFaultTimeout is how long a request that is timed out by FaultClient hangs
+// unless its context is done earlier.
+const DefaultFaultTimeout = 10 * time.Second
+
+// Latency samples delay added to a request.
+type Latency func(r *rand.Rand) time.Duration
+
+// FixedLatency always delays by d.
+func FixedLatency(d time.Duration) Latency {
+	return func(*rand.Rand) time.Duration {
+		return d
+	}
+}
+
+// UniformLatency delays by a random duration in [minDelay, maxDelay].
+func UniformLatency(minDelay, maxDelay time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		if maxDelay <= minDelay {
+			return minDelay
+		}
+
+		return minDelay + time.Duration(r.Int64N(int64(maxDelay-minDelay)+1))
+	}
+}
+
+// NormalLatency delays by a normally distributed duration. Negative samples are cut to zero.
+func NormalLatency(mean, stddev time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		return max(0, time.Duration(r.NormFloat64()*float64(stddev)+float64(mean)))
+	}
+}
+
+// ExponentialLatency delays by an exponentially distributed duration. It models a long tail of slow requests.
+func ExponentialLatency(mean time.Duration) Latency {
+	return func(r *rand.Rand) time.Duration {
+		return time.Duration(r.ExpFloat64() * float64(mean))
+	}
+}
+
+// StatusFault answers a request with Status without sending it.
+type StatusFault struct {
+	Status      int
+	Probability float64
+	// Header is added to the response, e.g. Retry-After
+	Header http.Header
+}
+
+// Faults configures FaultClient. A single fault at most is injected per request: probabilities are cumulative
+// and checked in order Reset, Timeout, Statuses, Truncate, so their sum can't exceed 1.
+type Faults struct {
+	// Seed makes the sequence of faults reproducible
+	Seed uint64
+	// Latency is added to every request. It's nil if requests are not delayed.
+	Latency Latency
+
+	// ResetProbability fails a request with connection reset before it's sent
+	ResetProbability float64
+	// TimeoutProbability makes a request hang for Timeout and fail with a timeout error without sending it
+	TimeoutProbability float64
+	// Timeout defaults to DefaultFaultTimeout
+	Timeout time.Duration
+	// Statuses answer requests with a status without sending them
+	Statuses []StatusFault
+	// TruncateProbability sends a request, but cuts the response body in half, so reading it fails with
+	// io.ErrUnexpectedEOF. Only those who read the body notice it, e.g. ResponseParser.
+	TruncateProbability float64
+
+	// Clock is used to wait. Real clock is used if it's nil.
+	Clock clock.Clock
+}
+
+// Validate reports nonsense values.
+func (f Faults) Validate() error {
+	var problems []error
+
+	total := 0.0
+	check := func(name string, p float64) {
+		if p < 0 || p > 1 {
+			problems = append(problems, errs.Wrap(errs.ErrValidation, name+" must be in [0, 1]"))
+		}
+		total += p
+	}
+
+	check("reset probability", f.ResetProbability)
+	check("timeout probability", f.TimeoutProbability)
+	for _, s := range f.Statuses {
+		if s.Status < 100 || s.Status > 999 {
+			problems = append(problems, errs.Wrap(errs.ErrValidation, fmt.Sprintf("status %d is invalid", s.Status)))
+		}
+		check(fmt.Sprintf("status %d probability", s.Status), s.Probability)
+	}
+	check("truncate probability", f.TruncateProbability)
+
+	if total > 1 {
+		problems = append(problems, errs.Wrap(errs.ErrValidation, "sum of probabilities must not exceed 1"))
+	}
+
+	if f.Timeout < 0 {
+		problems = append(problems, errs.Wrap(errs.ErrValidation, "timeout must not be negative"))
+	}
+
+	return errors.Join(problems...)
+}
+
+// FaultStats counts requests and injected faults.
+type FaultStats struct {
+	Requests  int
+	Resets    int
+	Timeouts  int
+	Statuses  int
+	Truncated int
+}
+
+// FaultClient is HTTPClient decorator that injects faults for chaos testing of Notifier
+// against a healthy local receiver. It's safe for concurrent use.
+type FaultClient struct {
+	next   HTTPClient
+	faults Faults
+	clock  clock.Clock
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	stats FaultStats
+}
+
+type fault int
+
+const (
+	faultNone fault = iota
+	faultReset
+	faultTimeout
+	faultStatus
+	faultTruncate
+)
+
+// NewFaultClient wraps next with faults.
+func NewFaultClient(next HTTPClient, faults Faults) (*FaultClient, error) {
+	if err := faults.Validate(); err != nil {
+		return nil, err
+	}
+
+	if faults.Timeout == 0 {
+		faults.Timeout = DefaultFaultTimeout
+	}
+
+	return &FaultClient{
+		next:   next,
+		faults: faults,
+		clock:  clock.OrReal(faults.Clock),
+		rng:    rand.New(rand.NewPCG(faults.Seed, faults.Seed)),
+	}, nil
+}
+
+// Stats returns the number of requests and injected faults so far.
+func (c *FaultClient) Stats() FaultStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *FaultClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	delay, f, status := c.roll()
+
+	if delay > 0 {
+		if err := c.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	switch f {
+	case faultReset:
+		return nil, &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.ECONNRESET)}
+	case faultTimeout:
+		if err := c.sleep(ctx, c.faults.Timeout); err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("fault: request timed out: %w", os.ErrDeadlineExceeded)
+	case faultStatus:
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", status.Status, http.StatusText(status.Status)),
+			StatusCode: status.Status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     status.Header.Clone(),
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	case faultTruncate:
+		resp, err := c.next.Do(ctx, req)
+		if err != nil || resp == nil || resp.Body == nil {
+			return resp, err
+		}
+
+		resp.Body = &truncatedBody{body: resp.Body}
+
+		return resp, nil
+	default:
+		return c.next.Do(ctx, req)
+	}
+}
+
+// roll picks latency and fault of a request.
+func (c *FaultClient) roll() (time.Duration, fault, StatusFault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Requests++
+
+	var delay time.Duration
+	if c.faults.Latency != nil {
+		delay = c.faults.Latency(c.rng)
+	}
+
+	u := c.rng.Float64()
+
+	if u -= c.faults.ResetProbability; u < 0 {
+		c.stats.Resets++
+		return delay, faultReset, StatusFault{}
+	}
+
+	if u -= c.faults.TimeoutProbability; u < 0 {
+		c.stats.Timeouts++
+		return delay, faultTimeout, StatusFault{}
+	}
+
+	for _, s := range c.faults.Statuses {
+		if u -= s.Probability; u < 0 {
+			c.stats.Statuses++
+			return delay, faultStatus, s
+		}
+	}
+
+	if u -= c.faults.TruncateProbability; u < 0 {
+		c.stats.Truncated++
+		return delay, faultTruncate, StatusFault{}
+	}
+
+	return delay, faultNone, StatusFault{}
+}
+
+func (c *FaultClient) sleep(ctx context.Context, d time.Duration) error {
+	timer := c.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// truncatedBody returns the first half of body and then fails with io.ErrUnexpectedEOF.
+type truncatedBody struct {
+	body io.ReadCloser
+	// rest is the part of the first half that is not read yet, it's set by the first Read
+	rest []byte
+	cut  bool
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if !b.cut {
+		data, err := io.ReadAll(b.body)
+		if err != nil {
+			return 0, err
+		}
+
+		b.rest = data[:len(data)/2]
+		b.cut = true
+	}
+
+	if len(b.rest) == 0 {
+		return 0, fmt.Errorf("fault: response truncated: %w", io.ErrUnexpectedEOF)
+	}
+
+	n := copy(p, b.rest)
+	b.rest = b.rest[n:]
+
+	return n, nil
+}
+
+func (b *truncatedBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/clock"
+	"notifier/errs"
+)
+
+// countingClient answers 200 with body "accepted" and counts requests.
+type countingClient struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (c *countingClient) Do(_ context.Context, req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests++
+
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("accepted")), Request: req}, nil
+}
+
+func TestFaultClient_Do(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		faults       Faults
+		wantStatus   int
+		wantErr      error
+		wantBody     string
+		wantReadErr  error
+		wantSent     int
+		wantStats    FaultStats
+		cancelBefore bool
+	}{
+		{
+			name:       "no_faults_passes_request",
+			wantStatus: http.StatusOK,
+			wantBody:   "accepted",
+			wantSent:   1,
+			wantStats:  FaultStats{Requests: 1},
+		},
+		{
+			name:      "reset_is_not_sent",
+			faults:    Faults{ResetProbability: 1},
+			wantErr:   syscall.ECONNRESET,
+			wantStats: FaultStats{Requests: 1, Resets: 1},
+		},
+		{
+			name:      "timeout_is_not_sent",
+			faults:    Faults{TimeoutProbability: 1, Timeout: time.Millisecond},
+			wantErr:   os.ErrDeadlineExceeded,
+			wantStats: FaultStats{Requests: 1, Timeouts: 1},
+		},
+		{
+			name:         "timeout_returns_early_if_context_is_done",
+			faults:       Faults{TimeoutProbability: 1, Timeout: time.Hour},
+			wantErr:      context.Canceled,
+			wantStats:    FaultStats{Requests: 1, Timeouts: 1},
+			cancelBefore: true,
+		},
+		{
+			name: "status_is_answered_without_sending",
+			faults: Faults{
+				Statuses: []StatusFault{{Status: http.StatusServiceUnavailable, Probability: 1}},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantStats:  FaultStats{Requests: 1, Statuses: 1},
+		},
+		{
+			name:        "truncated_response_is_sent",
+			faults:      Faults{TruncateProbability: 1},
+			wantStatus:  http.StatusOK,
+			wantBody:    "acce",
+			wantReadErr: io.ErrUnexpectedEOF,
+			wantSent:    1,
+			wantStats:   FaultStats{Requests: 1, Truncated: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				next := &countingClient{}
+
+				c, err := NewFaultClient(next, tt.faults)
+				if err != nil {
+					t.Fatalf("NewFaultClient() error = %v", err)
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				if tt.cancelBefore {
+					cancel()
+				}
+
+				resp, err := c.Do(ctx, &http.Request{Method: http.MethodPost})
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+				}
+
+				if tt.wantStatus != 0 {
+					if resp == nil {
+						t.Fatalf("Do() response is nil, want status %d", tt.wantStatus)
+					}
+
+					if diff := cmp.Diff(tt.wantStatus, resp.StatusCode); diff != "" {
+						t.Errorf("status mismatch (-want +got):\n%s", diff)
+					}
+
+					body, err := io.ReadAll(resp.Body)
+					if !errors.Is(err, tt.wantReadErr) {
+						t.Errorf("reading body error = %v, want %v", err, tt.wantReadErr)
+					}
+					if diff := cmp.Diff(tt.wantBody, string(body)); diff != "" {
+						t.Errorf("body mismatch (-want +got):\n%s", diff)
+					}
+				}
+
+				if diff := cmp.Diff(tt.wantSent, next.requests); diff != "" {
+					t.Errorf("sent requests mismatch (-want +got):\n%s", diff)
+				}
+
+				if diff := cmp.Diff(tt.wantStats, c.Stats()); diff != "" {
+					t.Errorf("stats mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestFaultClient_Seed_Makes_Faults_Reproducible(t *testing.T) {
+	t.Parallel()
+
+	faults := Faults{
+		Seed:                42,
+		ResetProbability:    0.1,
+		Statuses:            []StatusFault{{Status: http.StatusTooManyRequests, Probability: 0.2}},
+		TruncateProbability: 0.1,
+		Latency:             UniformLatency(0, time.Microsecond),
+	}
+
+	run := func() []string {
+		c, err := NewFaultClient(&countingClient{}, faults)
+		if err != nil {
+			t.Fatalf("NewFaultClient() error = %v", err)
+		}
+
+		var outcomes []string
+		for i := 0; i < 100; i++ {
+			resp, err := c.Do(context.Background(), &http.Request{})
+			switch {
+			case err != nil:
+				outcomes = append(outcomes, err.Error())
+			default:
+				outcomes = append(outcomes, resp.Status)
+			}
+		}
+
+		return outcomes
+	}
+
+	first := run()
+	if diff := cmp.Diff(first, run()); diff != "" {
+		t.Errorf("outcomes of the same seed mismatch (-first +second):\n%s", diff)
+	}
+}
+
+func TestFaultClient_Latency(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	next := &countingClient{}
+
+	c, err := NewFaultClient(next, Faults{Latency: FixedLatency(time.Second), Clock: clk})
+	if err != nil {
+		t.Fatalf("NewFaultClient() error = %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := c.Do(context.Background(), &http.Request{})
+		done <- err
+	}()
+
+	clk.BlockUntil(1)
+
+	select {
+	case <-done:
+		t.Fatal("Do() returned before latency passed")
+	default:
+	}
+
+	clk.Advance(time.Second)
+
+	if err = <-done; err != nil {
+		t.Errorf("Do() error = %v", err)
+	}
+}
+
+func TestFaults_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		faults  Faults
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			faults: Faults{ResetProbability: 0.5, TruncateProbability: 0.5},
+		},
+		{
+			name:    "probability_over_one",
+			faults:  Faults{ResetProbability: 1.5},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "negative_probability",
+			faults:  Faults{TimeoutProbability: -0.1},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "sum_over_one",
+			faults:  Faults{ResetProbability: 0.6, Statuses: []StatusFault{{Status: 500, Probability: 0.6}}},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "invalid_status",
+			faults:  Faults{Statuses: []StatusFault{{Status: 42, Probability: 0.1}}},
+			wantErr: errs.ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				if err := tt.faults.Validate(); !errors.Is(err, tt.wantErr) {
+					t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		latency Latency
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "fixed", latency: FixedLatency(time.Second), min: time.Second, max: time.Second},
+		{name: "uniform", latency: UniformLatency(time.Second, 2*time.Second), min: time.Second, max: 2 * time.Second},
+		{name: "normal_is_not_negative", latency: NormalLatency(0, time.Second), min: 0, max: time.Hour},
+		{name: "exponential", latency: ExponentialLatency(time.Second), min: 0, max: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				r := rand.New(rand.NewPCG(1, 1))
+				for i := 0; i < 1000; i++ {
+					if d := tt.latency(r); d < tt.min || d > tt.max {
+						t.Fatalf("latency %v is out of [%v, %v]", d, tt.min, tt.max)
+					}
+				}
+			},
+		)
+	}
+}
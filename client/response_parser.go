@@ -0,0 +1,70 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"notifier/errs"
+)
+
+// ResponseParser extracts per-message results from a successful response to a batch of n messages.
+// It returns indexes of rejected messages, none if the whole batch is accepted.
+// Error means the results are unknown, then the whole batch is reported as failed.
+type ResponseParser func(resp *http.Response, n int) (rejected []int, err error)
+
+// RejectedIndexes returns ResponseParser of JSON object that lists indexes of rejected messages in field,
+// e.g. {"failed":[3,7]}. Empty body and missing field mean the whole batch is accepted.
+func RejectedIndexes(field string) ResponseParser {
+	return func(resp *http.Response, n int) ([]int, error) {
+		if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+			return nil, nil
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		// the body is restored for those who read it after, e.g. DeliveryError
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			return nil, nil
+		}
+
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal(body, &fields); err != nil {
+			return nil, errs.Wrap(errs.ErrValidation, "response body: "+err.Error())
+		}
+
+		raw, ok := fields[field]
+		if !ok {
+			return nil, nil
+		}
+
+		var rejected []int
+		if err = json.Unmarshal(raw, &rejected); err != nil {
+			return nil, errs.Wrap(errs.ErrValidation, fmt.Sprintf("response field %q: %s", field, err))
+		}
+
+		if err = CheckRejected(rejected, n); err != nil {
+			return nil, err
+		}
+
+		return rejected, nil
+	}
+}
+
+// CheckRejected reports indexes that are out of a batch of n messages.
+func CheckRejected(rejected []int, n int) error {
+	for _, i := range rejected {
+		if i < 0 || i >= n {
+			return errs.Wrap(errs.ErrValidation, fmt.Sprintf("rejected index %d is out of batch of %d", i, n))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/errs"
+)
+
+func TestRejectedIndexes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		body    string
+		n       int
+		want    []int
+		wantErr error
+	}{
+		{name: "empty_body", body: "", n: 3},
+		{name: "missing_field", body: `{"ok":true}`, n: 3},
+		{name: "no_rejected", body: `{"failed":[]}`, n: 3, want: []int{}},
+		{name: "rejected", body: `{"failed":[0,2]}`, n: 3, want: []int{0, 2}},
+		{name: "out_of_batch", body: `{"failed":[3]}`, n: 3, wantErr: errs.ErrValidation},
+		{name: "negative", body: `{"failed":[-1]}`, n: 3, wantErr: errs.ErrValidation},
+		{name: "not_json", body: `OK`, n: 3, wantErr: errs.ErrValidation},
+		{name: "not_indexes", body: `{"failed":"all"}`, n: 3, wantErr: errs.ErrValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(tt.body))}
+
+				got, err := RejectedIndexes("failed")(resp, tt.n)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RejectedIndexes() error = %v, want %v", err, tt.wantErr)
+				}
+
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("RejectedIndexes() mismatch (-want +got):\n%s", diff)
+				}
+
+				// the body is restored
+				body, _ := io.ReadAll(resp.Body)
+				if diff := cmp.Diff(tt.body, string(body)); diff != "" {
+					t.Errorf("restored body mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,64 @@
+// Package clock abstracts time, so timing of batching, retries and rate limiting can be tested deterministically.
+package clock
+
+import (
+	"time"
+)
+
+// Clock tells time and creates timers.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer mirrors time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing. It returns false if the timer already fired or was stopped.
+	Stop() bool
+	// Reset changes the timer to fire after d. It returns true if the timer had been active.
+	Reset(d time.Duration) bool
+}
+
+// Real is Clock backed by time package.
+var Real Clock = realClock{}
+
+// OrReal returns c or Real if c is nil.
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.t.Reset(d)
+}
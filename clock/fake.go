@@ -0,0 +1,155 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is Clock that moves only when Advance or Set is called. Timers fire synchronously during Advance.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+	// changed is closed and replaced every time the set of active timers changes
+	changed chan struct{}
+}
+
+// NewFake returns Fake that starts at start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start, changed: make(chan struct{})}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+
+	return t
+}
+
+// Advance moves the clock forward by d and fires timers that are due in order of their deadlines.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t and fires timers that are due in order of their deadlines.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = t
+	f.fire()
+}
+
+// Timers returns the number of active timers.
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.timers)
+}
+
+// BlockUntil waits until at least n timers are active. It's used to make sure a goroutine is waiting
+// on a timer before the clock is advanced.
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		active, changed := len(f.timers), f.changed
+		f.mu.Unlock()
+
+		if active >= n {
+			return
+		}
+
+		<-changed
+	}
+}
+
+// fire sends current time to due timers. f.mu must be held.
+func (f *Fake) fire() {
+	sort.SliceStable(
+		f.timers, func(i, j int) bool {
+			return f.timers[i].deadline.Before(f.timers[j].deadline)
+		},
+	)
+
+	fired := 0
+	for _, t := range f.timers {
+		if t.deadline.After(f.now) {
+			break
+		}
+
+		select {
+		case t.c <- f.now:
+		default:
+		}
+		fired++
+	}
+
+	if fired > 0 {
+		f.timers = f.timers[fired:]
+		f.notify()
+	}
+}
+
+// notify wakes up BlockUntil. f.mu must be held.
+func (f *Fake) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// remove deactivates t and returns true if it was active. f.mu must be held.
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, active := range f.timers {
+		if active == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			f.notify()
+
+			return true
+		}
+	}
+
+	return false
+}
+
+type fakeTimer struct {
+	f        *Fake
+	c        chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+
+	return t.f.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+
+	wasActive := t.f.remove(t)
+
+	t.deadline = t.f.now.Add(d)
+	t.f.timers = append(t.f.timers, t)
+	t.f.notify()
+	t.f.fire()
+
+	return wasActive
+}
@@ -0,0 +1,119 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func fired(t Timer) bool {
+	select {
+	case <-t.C():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestFake_Advance_Fires_Due_Timers(t *testing.T) {
+	t.Parallel()
+
+	f := NewFake(start)
+
+	short := f.NewTimer(time.Second)
+	long := f.NewTimer(time.Minute)
+
+	f.Advance(500 * time.Millisecond)
+	if fired(short) || fired(long) {
+		t.Fatal("timers fired too early")
+	}
+
+	f.Advance(500 * time.Millisecond)
+	if !fired(short) {
+		t.Error("short timer didn't fire")
+	}
+	if fired(long) {
+		t.Error("long timer fired too early")
+	}
+
+	if diff := cmp.Diff(1, f.Timers()); diff != "" {
+		t.Errorf("Timers() mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(time.Second, f.Since(start)); diff != "" {
+		t.Errorf("Since() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFake_Timer_Stop_And_Reset(t *testing.T) {
+	t.Parallel()
+
+	f := NewFake(start)
+
+	timer := f.NewTimer(time.Second)
+
+	if !timer.Stop() {
+		t.Error("Stop() of active timer = false")
+	}
+	if timer.Stop() {
+		t.Error("Stop() of stopped timer = true")
+	}
+
+	f.Advance(time.Hour)
+	if fired(timer) {
+		t.Error("stopped timer fired")
+	}
+
+	if timer.Reset(time.Second) {
+		t.Error("Reset() of stopped timer = true")
+	}
+
+	f.Advance(time.Second)
+	if !fired(timer) {
+		t.Error("reset timer didn't fire")
+	}
+
+	zero := f.NewTimer(0)
+	if !fired(zero) {
+		t.Error("timer with zero duration didn't fire immediately")
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	t.Parallel()
+
+	f := NewFake(start)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		timer := f.NewTimer(time.Second)
+		<-timer.C()
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("goroutine wasn't woken up by Advance()")
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	t.Parallel()
+
+	if OrReal(nil) != Real {
+		t.Error("OrReal(nil) is not Real")
+	}
+
+	f := NewFake(start)
+	if OrReal(f) != f {
+		t.Error("OrReal() replaced non nil clock")
+	}
+}
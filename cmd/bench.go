@@ -0,0 +1,559 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"notifier"
+	"notifier/client"
+)
+
+const (
+	profileConstant = "constant"
+	profileBurst    = "burst"
+	profileSpike    = "spike"
+
+	// benchTick is how often the generator catches up with the target rate
+	benchTick = 10 * time.Millisecond
+	// benchSampleInterval is how often memory, FDs and goroutines are sampled
+	benchSampleInterval = 100 * time.Millisecond
+)
+
+// BenchConfig configures `notifier bench`.
+type BenchConfig struct {
+	// ConfigPath is a path to YAML or JSON notifier config. URL is replaced with the local sink
+	ConfigPath string
+	Duration   time.Duration
+	// Profile is one of constant, burst or spike
+	Profile string
+	// Rate is messages per second of constant and spike profiles
+	Rate       int
+	BurstSize  int
+	BurstEvery time.Duration
+	SpikeRate  int
+	SpikeAt    time.Duration
+	SpikeFor   time.Duration
+	MsgSize    int
+	// Drop makes generator use NotifyAndForget instead of blocking Notify
+	Drop bool
+
+	SinkLatency time.Duration
+	// FailRate is a probability of the sink answering 503
+	FailRate float64
+	Seed     uint64
+}
+
+// ParseBenchFlags parses flags of `notifier bench`.
+func (config *BenchConfig) ParseBenchFlags(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+
+	fs.StringVar(&config.ConfigPath, "config", "", "Path to YAML or JSON notifier config. URL is replaced with the local sink")
+	fs.DurationVar(&config.Duration, "d", 10*time.Second, "Duration of load generation")
+	fs.StringVar(&config.Profile, "profile", profileConstant, "Load profile: constant, burst or spike")
+	fs.IntVar(&config.Rate, "rate", 10000, "Messages per second of constant and spike profiles")
+	fs.IntVar(&config.BurstSize, "burst", 50000, "Messages sent at once by burst profile")
+	fs.DurationVar(&config.BurstEvery, "burst-every", time.Second, "Interval between bursts")
+	fs.IntVar(&config.SpikeRate, "spike-rate", 100000, "Messages per second during spike")
+	fs.DurationVar(&config.SpikeAt, "spike-at", 3*time.Second, "Spike start since the beginning")
+	fs.DurationVar(&config.SpikeFor, "spike-for", 2*time.Second, "Spike duration")
+	fs.IntVar(&config.MsgSize, "size", 128, "Message size in bytes")
+	fs.BoolVar(&config.Drop, "drop", false, "Use NotifyAndForget, messages are dropped when the input channel is full")
+	fs.DurationVar(&config.SinkLatency, "sink-latency", 0, "Latency of the local sink")
+	fs.Float64Var(&config.FailRate, "fail", 0, "Probability of the sink answering 503")
+	fs.Uint64Var(&config.Seed, "seed", 1, "Seed of injected failures")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return config.Validate()
+}
+
+// Validate reports nonsense values.
+func (config *BenchConfig) Validate() error {
+	var problems []error
+
+	switch config.Profile {
+	case profileConstant, profileSpike:
+		if config.Rate <= 0 {
+			problems = append(problems, errors.New("rate must be positive"))
+		}
+	case profileBurst:
+		if config.BurstSize <= 0 || config.BurstEvery <= 0 {
+			problems = append(problems, errors.New("burst and burst-every must be positive"))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("unknown profile %q", config.Profile))
+	}
+
+	if config.Profile == profileSpike && (config.SpikeRate <= 0 || config.SpikeFor <= 0) {
+		problems = append(problems, errors.New("spike-rate and spike-for must be positive"))
+	}
+
+	if config.Duration <= 0 {
+		problems = append(problems, errors.New("duration must be positive"))
+	}
+
+	if config.MsgSize < benchHeaderSize {
+		problems = append(problems, fmt.Errorf("size must be at least %d", benchHeaderSize))
+	}
+
+	if config.FailRate < 0 || config.FailRate > 1 {
+		problems = append(problems, errors.New("fail must be in [0, 1]"))
+	}
+
+	return errors.Join(problems...)
+}
+
+// rate returns target messages per second at elapsed.
+func (config *BenchConfig) rate(elapsed time.Duration) int {
+	if config.Profile == profileSpike && elapsed >= config.SpikeAt && elapsed < config.SpikeAt+config.SpikeFor {
+		return config.SpikeRate
+	}
+
+	return config.Rate
+}
+
+// runBench generates load through Notifier against a local sink and writes the report to w.
+func runBench(args []string, w io.Writer) error {
+	config := BenchConfig{}
+	if err := config.ParseBenchFlags(args); err != nil {
+		return err
+	}
+
+	// notifier logs every drop and failure, it would flood the report
+	slog.SetLogLoggerLevel(slog.LevelError)
+
+	s, err := newBenchSink(config.SinkLatency)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	base := notifier.DefaultConfig()
+	base.URL = s.URL
+
+	cfg, err := base.Load(config.ConfigPath)
+	if err != nil {
+		return err
+	}
+	cfg.URL = s.URL
+
+	var failed atomic.Int64
+
+	opts := []notifier.Option{
+		notifier.WithConfig(cfg),
+		notifier.WithFailureHandler(
+			func(msgs []string, _ error) {
+				failed.Add(int64(len(msgs)))
+			},
+		),
+	}
+
+	if config.FailRate > 0 {
+		faulty, err := client.NewFaultClient(
+			client.NewDefaultHTTPClient(resty.New().SetTimeout(cfg.HTTPTimeout).SetBaseURL(s.URL), nil),
+			client.Faults{
+				Seed:     config.Seed,
+				Statuses: []client.StatusFault{{Status: http.StatusServiceUnavailable, Probability: config.FailRate}},
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, notifier.WithHTTPClient(faulty))
+	}
+
+	n, err := notifier.New(s.URL, opts...)
+	if err != nil {
+		return err
+	}
+
+	sampler := newResourceSampler()
+	go sampler.Run()
+
+	n.Start()
+
+	start := time.Now()
+	sent, rejected := generate(n, &config)
+	generated := time.Since(start)
+
+	n.Stop()
+	total := time.Since(start)
+
+	sampler.Stop()
+
+	report := benchReport{
+		config:    &config,
+		generated: generated,
+		total:     total,
+		sent:      sent,
+		rejected:  rejected,
+		failed:    failed.Load(),
+		sink:      s.Result(),
+		resources: sampler.Result(),
+	}
+
+	return report.Write(w)
+}
+
+// generate notifies messages according to the profile and returns the number of accepted and rejected ones.
+func generate(n *notifier.Notifier, config *BenchConfig) (sent int64, rejected int64) {
+	padding := strings.Repeat("x", config.MsgSize)
+
+	notify := n.Notify
+	if config.Drop {
+		notify = n.NotifyAndForget
+	}
+
+	ticker := time.NewTicker(benchTick)
+	defer ticker.Stop()
+
+	start := time.Now()
+	nextBurst := time.Duration(0)
+	prev := time.Duration(0)
+	due := 0.0
+	seq := int64(0)
+
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= config.Duration {
+			return sent, rejected
+		}
+
+		count := int64(0)
+
+		switch config.Profile {
+		case profileBurst:
+			if elapsed >= nextBurst {
+				count = int64(config.BurstSize)
+				nextBurst += config.BurstEvery
+			}
+		default:
+			// catch up by real elapsed time, ticks are late when Notify blocks
+			due += float64(config.rate(elapsed)) * (elapsed - prev).Seconds()
+			prev = elapsed
+			count = int64(due) - seq
+		}
+
+		for i := int64(0); i < count; i++ {
+			if notify(benchMessage(seq, time.Now(), padding, config.MsgSize)) {
+				sent++
+			} else {
+				rejected++
+			}
+			seq++
+		}
+
+		<-ticker.C
+	}
+}
+
+// benchHeaderSize is the size of sequence number and timestamp prefix of a message
+const benchHeaderSize = 16 + 1 + 16 + 1
+
+// benchMessage encodes seq and send time as fixed size hex prefix and pads the message to size.
+func benchMessage(seq int64, now time.Time, padding string, size int) string {
+	var b strings.Builder
+	b.Grow(size)
+
+	writeHex(&b, uint64(seq))
+	b.WriteByte(':')
+	writeHex(&b, uint64(now.UnixNano()))
+	b.WriteByte(':')
+	b.WriteString(padding[:size-benchHeaderSize])
+
+	return b.String()
+}
+
+func writeHex(b *strings.Builder, v uint64) {
+	s := strconv.FormatUint(v, 16)
+	b.WriteString(strings.Repeat("0", 16-len(s)))
+	b.WriteString(s)
+}
+
+// parseBenchMessage returns seq and send time of a message made by benchMessage.
+func parseBenchMessage(msg string) (int64, time.Time, bool) {
+	if len(msg) < benchHeaderSize {
+		return 0, time.Time{}, false
+	}
+
+	seq, err := strconv.ParseUint(msg[:16], 16, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	ns, err := strconv.ParseUint(msg[17:33], 16, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	return int64(seq), time.Unix(0, int64(ns)), true
+}
+
+// benchSink is a local receiver that measures end-to-end latency and batch sizes.
+type benchSink struct {
+	*http.Server
+	URL string
+
+	latency time.Duration
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	batches   []int
+	seen      []bool
+	unique    int64
+	dups      int64
+	malformed int64
+}
+
+type sinkResult struct {
+	latencies []time.Duration
+	batches   []int
+	unique    int64
+	dups      int64
+	malformed int64
+}
+
+func newBenchSink(latency time.Duration) (*benchSink, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &benchSink{URL: "http://" + l.Addr().String(), latency: latency}
+	s.Server = &http.Server{Handler: http.HandlerFunc(s.handle), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		_ = s.Serve(l)
+	}()
+
+	return s, nil
+}
+
+func (s *benchSink) handle(w http.ResponseWriter, r *http.Request) {
+	if s.latency > 0 {
+		time.Sleep(s.latency)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, msgs, err := decodeBatch(r.Header, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, len(msgs))
+
+	for _, msg := range msgs {
+		seq, sentAt, ok := parseBenchMessage(msg)
+		if !ok {
+			s.malformed++
+			continue
+		}
+
+		for int64(len(s.seen)) <= seq {
+			s.seen = append(s.seen, false)
+		}
+
+		if s.seen[seq] {
+			s.dups++
+			continue
+		}
+
+		s.seen[seq] = true
+		s.unique++
+		s.latencies = append(s.latencies, now.Sub(sentAt))
+	}
+}
+
+func (s *benchSink) Result() sinkResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sinkResult{
+		latencies: append([]time.Duration(nil), s.latencies...),
+		batches:   append([]int(nil), s.batches...),
+		unique:    s.unique,
+		dups:      s.dups,
+		malformed: s.malformed,
+	}
+}
+
+// resourceSampler tracks peak memory, open file descriptors and goroutines of the process.
+type resourceSampler struct {
+	stop chan struct{}
+	done chan struct{}
+
+	result resources
+}
+
+type resources struct {
+	peakHeap       uint64
+	peakSys        uint64
+	numGC          uint32
+	peakFDs        int
+	peakGoroutines int
+}
+
+func newResourceSampler() *resourceSampler {
+	return &resourceSampler{stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (r *resourceSampler) Run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(benchSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		r.sample()
+
+		select {
+		case <-r.stop:
+			r.sample()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *resourceSampler) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	r.result.peakHeap = max(r.result.peakHeap, m.HeapInuse)
+	r.result.peakSys = max(r.result.peakSys, m.Sys)
+	r.result.numGC = m.NumGC
+	r.result.peakGoroutines = max(r.result.peakGoroutines, runtime.NumGoroutine())
+	r.result.peakFDs = max(r.result.peakFDs, openFDs())
+}
+
+func (r *resourceSampler) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *resourceSampler) Result() resources {
+	return r.result
+}
+
+// openFDs returns the number of open file descriptors or -1 if it's unknown on this platform.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+
+	return len(entries)
+}
+
+type benchReport struct {
+	config    *BenchConfig
+	generated time.Duration
+	total     time.Duration
+	sent      int64
+	rejected  int64
+	failed    int64
+	sink      sinkResult
+	resources resources
+}
+
+func (r *benchReport) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	lost := max(0, r.sent-r.sink.unique-r.failed)
+
+	row := func(name string, format string, args ...any) {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", name, fmt.Sprintf(format, args...))
+	}
+
+	row("profile", "%s, msg size %d B", r.config.Profile, r.config.MsgSize)
+	row("duration", "%v generating, %v draining", r.generated.Round(time.Millisecond),
+		(r.total - r.generated).Round(time.Millisecond))
+	row("sent", "%d (%.0f msg/s)", r.sent, perSecond(r.sent, r.generated))
+	row("delivered", "%d (%.0f msg/s), %d duplicates", r.sink.unique, perSecond(r.sink.unique, r.total), r.sink.dups)
+	row("dropped", "%d (rejected by Notify %d, failed %d, lost %d)",
+		r.rejected+r.failed+lost, r.rejected, r.failed, lost)
+
+	lat := r.sink.latencies
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	latency := func(p float64) time.Duration {
+		return percentile(lat, p).Round(time.Microsecond)
+	}
+	row("latency", "p50 %v, p90 %v, p99 %v, p99.9 %v, max %v",
+		latency(0.5), latency(0.9), latency(0.99), latency(0.999), latency(1))
+
+	batches := r.sink.batches
+	sort.Ints(batches)
+	row("batches", "%d requests, msgs per batch p50 %d, p90 %d, p99 %d, max %d",
+		len(batches), percentile(batches, 0.5), percentile(batches, 0.9), percentile(batches, 0.99),
+		percentile(batches, 1))
+
+	row("memory", "heap peak %.1f MiB, sys peak %.1f MiB, %d GC",
+		mib(r.resources.peakHeap), mib(r.resources.peakSys), r.resources.numGC)
+	if r.resources.peakFDs >= 0 {
+		row("fds", "peak %d", r.resources.peakFDs)
+	} else {
+		row("fds", "unknown")
+	}
+	row("goroutines", "peak %d", r.resources.peakGoroutines)
+
+	if r.sink.malformed > 0 {
+		row("malformed", "%d", r.sink.malformed)
+	}
+
+	return tw.Flush()
+}
+
+// percentile returns p-th percentile of sorted values.
+func percentile[T any](sorted []T, p float64) T {
+	var zero T
+	if len(sorted) == 0 {
+		return zero
+	}
+
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func perSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(n) / d.Seconds()
+}
+
+func mib(b uint64) float64 {
+	return float64(b) / 1024 / 1024
+}
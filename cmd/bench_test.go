@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBenchConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	valid := BenchConfig{Duration: time.Second, Profile: profileConstant, Rate: 100, MsgSize: 128}
+
+	tests := []struct {
+		name     string
+		modify   func(c *BenchConfig)
+		wantText []string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *BenchConfig) {},
+		},
+		{
+			name: "valid_burst",
+			modify: func(c *BenchConfig) {
+				c.Profile = profileBurst
+				c.Rate = 0
+				c.BurstSize = 10
+				c.BurstEvery = time.Second
+			},
+		},
+		{
+			name:     "unknown_profile",
+			modify:   func(c *BenchConfig) { c.Profile = "ramp" },
+			wantText: []string{`unknown profile "ramp"`},
+		},
+		{
+			name: "burst_without_size",
+			modify: func(c *BenchConfig) {
+				c.Profile = profileBurst
+				c.BurstEvery = time.Second
+			},
+			wantText: []string{"burst and burst-every must be positive"},
+		},
+		{
+			name: "spike_without_rate",
+			modify: func(c *BenchConfig) {
+				c.Profile = profileSpike
+				c.SpikeFor = time.Second
+			},
+			wantText: []string{"spike-rate and spike-for must be positive"},
+		},
+		{
+			name: "all_problems_reported",
+			modify: func(c *BenchConfig) {
+				c.Rate = 0
+				c.Duration = 0
+				c.MsgSize = benchHeaderSize - 1
+				c.FailRate = -1
+			},
+			wantText: []string{
+				"rate must be positive", "duration must be positive", "size must be at least", "fail must be in [0, 1]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				c := valid
+				tt.modify(&c)
+
+				assertProblems(t, c.Validate(), tt.wantText)
+			},
+		)
+	}
+}
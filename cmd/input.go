@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// inputLines is a message per line
+	inputLines = "lines"
+	// inputNDJSON is a JSON value per line. Strings are unquoted, other values are sent as compact JSON
+	inputNDJSON = "ndjson"
+	// inputLength is a message prefixed by its length in bytes encoded as uvarint, like protobuf delimited streams
+	inputLength = "length"
+
+	// maxLineSize limits a single line of lines and ndjson input
+	maxLineSize = 16 * 1024 * 1024
+)
+
+var inputFormats = []string{inputLines, inputNDJSON, inputLength}
+
+// readMessages reads messages from r in format and passes them to notify until r is exhausted.
+func readMessages(r io.Reader, format string, notify func(msg string)) error {
+	switch format {
+	case inputLines:
+		return scanLines(r, func(line []byte) error {
+			notify(string(line))
+			return nil
+		})
+	case inputNDJSON:
+		return scanLines(r, func(line []byte) error {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				return nil
+			}
+
+			msg, err := ndjsonMessage(line)
+			if err != nil {
+				return err
+			}
+
+			notify(msg)
+			return nil
+		})
+	case inputLength:
+		return readLengthDelimited(r, notify)
+	default:
+		return fmt.Errorf("unknown input format %q", format)
+	}
+}
+
+func scanLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		if err := fn(scanner.Bytes()); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func ndjsonMessage(line []byte) (string, error) {
+	if line[0] == '"' {
+		var msg string
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return "", err
+		}
+
+		return msg, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, line); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func readLengthDelimited(r io.Reader, notify func(msg string)) error {
+	br := bufio.NewReader(r)
+
+	for n := 1; ; n++ {
+		size, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("message %d: %w", n, err)
+		}
+
+		if size > maxLineSize {
+			return fmt.Errorf("message %d: size %d exceeds %d", n, size, maxLineSize)
+		}
+
+		msg := make([]byte, size)
+		if _, err = io.ReadFull(br, msg); err != nil {
+			return fmt.Errorf("message %d: %w", n, err)
+		}
+
+		notify(string(msg))
+	}
+}
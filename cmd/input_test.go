@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadMessages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "lines",
+			format: inputLines,
+			input:  "hello\n{\"a\": 1}\n\nlast",
+			want:   []string{"hello", `{"a": 1}`, "", "last"},
+		},
+		{
+			name:   "ndjson",
+			format: inputNDJSON,
+			input:  "\"hello\\nworld\"\n\n  {\"a\": 1,  \"b\": [1, 2]}  \n42\n",
+			want:   []string{"hello\nworld", `{"a":1,"b":[1,2]}`, "42"},
+		},
+		{
+			name:    "ndjson_invalid_line",
+			format:  inputNDJSON,
+			input:   "\"ok\"\n{\"a\":\n",
+			want:    []string{"ok"},
+			wantErr: "line 2: ",
+		},
+		{
+			name:   "length",
+			format: inputLength,
+			input:  lengthDelimited("hello", "", "multi\nline"),
+			want:   []string{"hello", "", "multi\nline"},
+		},
+		{
+			name:    "length_truncated",
+			format:  inputLength,
+			input:   lengthDelimited("hello")[:3],
+			wantErr: "message 1: unexpected EOF",
+		},
+		{
+			name:    "unknown_format",
+			format:  "csv",
+			input:   "a,b",
+			wantErr: `unknown input format "csv"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				var got []string
+				err := readMessages(strings.NewReader(tt.input), tt.format, func(msg string) { got = append(got, msg) })
+
+				if tt.wantErr == "" && err != nil {
+					t.Fatalf("readMessages() error = %v", err)
+				}
+				if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+					t.Fatalf("readMessages() error = %v, want %q", err, tt.wantErr)
+				}
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("messages mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+// lengthDelimited encodes msgs in the length input format.
+func lengthDelimited(msgs ...string) string {
+	var b []byte
+	for _, msg := range msgs {
+		b = binary.AppendUvarint(b, uint64(len(msg)))
+		b = append(b, msg...)
+	}
+
+	return string(b)
+}
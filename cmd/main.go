@@ -1,12 +1,20 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -15,85 +23,418 @@ import (
 	"notifier/log/tag"
 )
 
+const (
+	defaultURL      = "http://localhost:8080/notify"
+	defaultInterval = 5 * time.Second
+)
+
 type Config struct {
-	URL      string
-	Interval time.Duration
+	// ConfigPath is a path to YAML or JSON notifier config
+	ConfigPath string
+	// Files are read in order, "-" is stdin. Stdin is read if there are none
+	Files []string
+	// InputFormat is one of lines, ndjson or length
+	InputFormat string
+	// WaitDelivery makes the program exit with non-zero status and a summary if any message was not delivered
+	WaitDelivery bool
+	// DryRun prints encoded batches instead of sending them
+	DryRun bool
+
+	// args are parsed again on top of config file, so explicitly passed flags take precedence over it
+	args []string
+}
+
+// subcommands run instead of reading stdin if the first argument is their name
+var subcommands = map[string]func(args []string) error{
+	"bench": func(args []string) error { return runBench(args, os.Stdout) },
+	"serve": runServe,
 }
 
 func main() {
+	if len(os.Args) > 1 && subcommands[os.Args[1]] != nil {
+		if err := subcommands[os.Args[1]](os.Args[2:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	cfg := Config{}
 
-	err := cfg.ParseFlags()
+	err := cfg.ParseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		os.Exit(1)
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
 	}
 
 	slog.SetLogLoggerLevel(slog.LevelDebug)
 
+	notifierCfg, err := cfg.NotifierConfig()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	d := &delivery{}
+
+	opts := []notifier.Option{
+		notifier.WithConfig(notifierCfg),
+		notifier.WithSuccessHandler(d.delivered),
+		notifier.WithFailureHandler(d.failed),
+	}
+	if cfg.DryRun {
+		opts = append(opts, notifier.WithHTTPClient(&printClient{w: os.Stdout}))
+	}
+
 	// Initialize the notifier
 	// The library handles buffering internally via FlushInterval
-	n := notifier.Default(
-		cfg.URL,
-		notifier.Options{
-			FlushInterval: cfg.Interval, // Use the parsed interval
-		},
-	)
+	n, err := notifier.New(notifierCfg.URL, opts...)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	if err = run(n); err != nil {
+	if err = run(n, &cfg, d); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	if cfg.WaitDelivery {
+		_, _ = fmt.Fprintln(os.Stderr, d.Summary())
+
+		if !d.OK() {
+			os.Exit(1)
+		}
+	}
 }
 
 // run orchestrates the lifecycle: Start -> Wait for Input/Signal -> Stop
-func run(n *notifier.Notifier) error {
+func run(n *notifier.Notifier, config *Config, d *delivery) error {
 	n.Start()
 	defer n.Stop()
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGINT)
 
-	done := make(chan struct{})
+	done := make(chan error, 1)
 
 	go func() {
-		readStdin(n)
-		close(done)
+		done <- readInputs(config, func(msg string) {
+			d.notified(n.Notify(msg))
+		})
 	}()
 
 	select {
-	case <-done:
-		return nil
+	case err := <-done:
+		return err
 	case <-sigChan:
 		log.Info("Gracefully shutting down...")
 		return nil
 	}
 }
 
-// readStdin scans standard input line by line
-func readStdin(n *notifier.Notifier) {
-	scanner := bufio.NewScanner(os.Stdin)
+// readInputs reads files in order, stdin is read if there are none
+func readInputs(config *Config, notify func(msg string)) error {
+	files := config.Files
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	for _, name := range files {
+		if err := readInput(name, config.InputFormat, notify); err != nil {
+			log.Error("failed to read input", "file", name, tag.Err, err)
+
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func readInput(name string, format string, notify func(msg string)) error {
+	if name == "-" {
+		return readMessages(os.Stdin, format, notify)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return readMessages(f, format, notify)
+}
+
+// ParseFlags parses args without the program name. Positional arguments are input files.
+func (config *Config) ParseFlags(args []string) error {
+	cfg := defaultNotifierConfig()
+
+	fs := newFlagSet(config, &cfg)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: notify [flags] [file ...]\n       notify bench|serve [flags]\n\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config.Files = fs.Args()
+	config.args = args
+
+	if !slices.Contains(inputFormats, config.InputFormat) {
+		return fmt.Errorf("input format must be one of %s, got %q", strings.Join(inputFormats, ", "), config.InputFormat)
+	}
+
+	return nil
+}
+
+// NotifierConfig loads notifier config from file and environment on top of flag defaults.
+// Explicitly passed flags take precedence over both.
+func (config *Config) NotifierConfig() (notifier.Config, error) {
+	cfg, err := defaultNotifierConfig().Load(config.ConfigPath)
+	if err != nil {
+		return notifier.Config{}, err
+	}
+
+	// flags are bound with loaded values as defaults, so only explicitly passed ones change them
+	fs := newFlagSet(&Config{}, &cfg)
+	fs.SetOutput(io.Discard)
+
+	if err = fs.Parse(config.args); err != nil {
+		return notifier.Config{}, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func defaultNotifierConfig() notifier.Config {
+	cfg := notifier.DefaultConfig()
+	cfg.URL = defaultURL
+	cfg.FlushInterval = defaultInterval
+
+	return cfg
+}
+
+// newFlagSet binds flags to config and cfg. Current values of cfg are used as defaults.
+func newFlagSet(config *Config, cfg *notifier.Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("notify", flag.ContinueOnError)
+
+	fs.StringVar(&config.ConfigPath, "config", "", "Path to YAML or JSON notifier config. NOTIFIER_* env variables override it")
+	fs.StringVar(&config.InputFormat, "input-format", inputLines,
+		"Input format: lines, ndjson (a JSON value per line) or length (uvarint length-prefixed messages)")
+	fs.BoolVar(&config.WaitDelivery, "wait-delivery", false,
+		"Print delivery summary and exit with non-zero status if any message was not delivered")
+	fs.BoolVar(&config.DryRun, "dry-run", false, "Print encoded batches instead of sending them")
+
+	fs.StringVar(&cfg.URL, "url", cfg.URL, "Target URL for notifications")
+	fs.DurationVar(&cfg.FlushInterval, "i", cfg.FlushInterval, "Notification interval")
+	fs.IntVar(&cfg.InputChanSize, "input-chan", cfg.InputChanSize, "Input channel size")
+	fs.IntVar(&cfg.OutputChanSize, "output-chan", cfg.OutputChanSize, "Output channel size")
+	fs.IntVar(&cfg.BatchSizeBytes, "batch-size", cfg.BatchSizeBytes, "Max batch size in bytes")
+	fs.IntVar(&cfg.SendersCount, "senders", cfg.SendersCount, "Number of senders")
+	fs.DurationVar(&cfg.HTTPTimeout, "timeout", cfg.HTTPTimeout, "HTTP request timeout")
+	fs.IntVar(&cfg.RetryCount, "retries", cfg.RetryCount, "Max number of retries of a batch")
+	fs.DurationVar(&cfg.RetryDelay, "retry-delay", cfg.RetryDelay, "Upper bound of the first backoff")
+	fs.DurationVar(&cfg.RetryMaxDelay, "retry-max-delay", cfg.RetryMaxDelay, "Max backoff")
+	fs.Var(&intsFlag{p: &cfg.RetryStatuses}, "retry-statuses", "Comma separated statuses that are retried")
+	fs.DurationVar(&cfg.RetryMaxElapsed, "retry-max-elapsed", cfg.RetryMaxElapsed,
+		"Stop retrying a batch after that since the first attempt, 0 is no limit")
+	fs.DurationVar(&cfg.RetryAttemptTimeout, "retry-attempt-timeout", cfg.RetryAttemptTimeout,
+		"Timeout of a single attempt, 0 is no limit")
+	fs.BoolVar(&cfg.RetryHonorRetryAfter, "retry-honor-retry-after", cfg.RetryHonorRetryAfter,
+		"Wait as long as Retry-After response header asks")
+	fs.DurationVar(&cfg.RetryAfterMax, "retry-after-max", cfg.RetryAfterMax, "Max delay asked by Retry-After")
+	fs.IntVar(&cfg.RPS, "rps", cfg.RPS, "Requests per second limit")
+	fs.StringVar(&cfg.Encoder, "encoder", cfg.Encoder, "Batch encoding: json or ndjson")
+	fs.Var(&headersFlag{p: &cfg.Headers}, "H", "Header added to every request as 'Key: Value', can be repeated")
+	fs.StringVar(&cfg.Auth.Type, "auth-type", cfg.Auth.Type, "Authorization: basic, bearer or empty")
+	fs.StringVar(&cfg.Auth.Username, "auth-user", cfg.Auth.Username, "Username of basic auth")
+	fs.StringVar(&cfg.Auth.Password, "auth-password", cfg.Auth.Password, "Password of basic auth")
+	fs.StringVar(&cfg.Auth.Token, "auth-token", cfg.Auth.Token, "Token of bearer auth")
+	fs.StringVar(&cfg.SigningSecret, "signing-secret", cfg.SigningSecret, "HMAC secret to sign request bodies with")
+	fs.StringVar(&cfg.Ordering, "ordering", cfg.Ordering, "Delivery order: global or empty for none")
+	fs.IntVar(&cfg.AggregatorShards, "shards", cfg.AggregatorShards, "Number of aggregator shards")
+	fs.StringVar(&cfg.InputQueue, "input-queue", cfg.InputQueue, "Input queue: ring or empty for channels")
+	fs.IntVar(&cfg.MemoryBudgetBytes, "memory-budget", cfg.MemoryBudgetBytes,
+		"Memory budget of queued messages in bytes, 0 is no limit")
+	fs.StringVar(&cfg.Overflow, "overflow", cfg.Overflow,
+		"Behaviour when the memory budget is exhausted: drop or empty to block")
+	fs.StringVar(&cfg.Delivery, "delivery", cfg.Delivery, "Delivery: stream or empty for batches")
+	fs.IntVar(&cfg.StreamMaxBytes, "stream-max-bytes", cfg.StreamMaxBytes, "Rotate streams after that many bytes")
+	fs.DurationVar(&cfg.StreamMaxAge, "stream-max-age", cfg.StreamMaxAge, "Rotate streams after that time")
+	fs.StringVar(&cfg.Transport, "transport", cfg.Transport, "Transport: grpc or empty for HTTP")
+	fs.StringVar(&cfg.Template, "template", cfg.Template, "text/template every message is rendered with")
+	fs.StringVar(&cfg.Redaction.Mode, "redact-mode", cfg.Redaction.Mode,
+		"Redaction of logged messages: hash, summary or empty to mask")
+	fs.Var(&stringsFlag{p: &cfg.Redaction.Patterns}, "redact-pattern",
+		"Regexp of logged values to redact, can be repeated")
+	fs.Var(&stringsFlag{p: &cfg.Redaction.Fields}, "redact-field", "JSON field path to redact, can be repeated")
+	fs.StringVar(&cfg.Name, "name", cfg.Name, "Name of the notifier added to its log lines")
+	fs.DurationVar(&cfg.LogSampleInterval, "log-sample-interval", cfg.LogSampleInterval,
+		"Interval repeated warnings and errors are sampled in, 0 logs every line")
+	fs.IntVar(&cfg.LogSampleBurst, "log-sample-burst", cfg.LogSampleBurst,
+		"Lines with the same message logged per sample interval")
+
+	return fs
+}
+
+// intsFlag is a comma separated list of ints. It replaces the list instead of appending to it.
+type intsFlag struct {
+	p *[]int
+}
 
-	for scanner.Scan() {
-		n.Notify(scanner.Text())
+func (f *intsFlag) String() string {
+	if f.p == nil {
+		return ""
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Error("scanner returned an error", tag.Err, err.Error())
+	s := make([]string, 0, len(*f.p))
+	for _, v := range *f.p {
+		s = append(s, strconv.Itoa(v))
 	}
+
+	return strings.Join(s, ",")
 }
 
-func (config *Config) ParseFlags() error {
-	url := flag.String("url", "http://localhost:8080/notify", "Target URL for notifications")
-	interval := flag.Duration("i", 5*time.Second, "Notification interval")
+func (f *intsFlag) Set(value string) error {
+	var ints []int
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
 
-	flag.Usage = func() {
-		flag.PrintDefaults()
+		ints = append(ints, v)
 	}
 
-	flag.Parse()
+	*f.p = ints
+	return nil
+}
 
-	config.URL = *url
-	config.Interval = *interval
+// stringsFlag appends every value to the list.
+type stringsFlag struct {
+	p *[]string
+}
 
+func (f *stringsFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+
+	return strings.Join(*f.p, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	// slice may be shared with config the flags were bound to
+	*f.p = append(slices.Clip(*f.p), value)
 	return nil
 }
+
+// headersFlag adds 'Key: Value' headers to the map.
+type headersFlag struct {
+	p *map[string]string
+}
+
+func (f *headersFlag) String() string {
+	if f.p == nil {
+		return ""
+	}
+
+	s := make([]string, 0, len(*f.p))
+	for k, v := range *f.p {
+		s = append(s, k+": "+v)
+	}
+	slices.Sort(s)
+
+	return strings.Join(s, ", ")
+}
+
+func (f *headersFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(k) == "" {
+		return fmt.Errorf("header must be 'Key: Value', got %q", value)
+	}
+
+	// map may be shared with config the flags were bound to
+	headers := make(map[string]string, len(*f.p)+1)
+	for hk, hv := range *f.p {
+		headers[hk] = hv
+	}
+	headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+
+	*f.p = headers
+	return nil
+}
+
+// delivery counts results of notified messages.
+type delivery struct {
+	notifiedCount  atomic.Int64
+	rejectedCount  atomic.Int64
+	deliveredCount atomic.Int64
+	failedCount    atomic.Int64
+}
+
+func (d *delivery) notified(ok bool) {
+	if ok {
+		d.notifiedCount.Add(1)
+	} else {
+		d.rejectedCount.Add(1)
+	}
+}
+
+func (d *delivery) delivered(msgs []string) {
+	d.deliveredCount.Add(int64(len(msgs)))
+}
+
+func (d *delivery) failed(msgs []string, _ error) {
+	d.failedCount.Add(int64(len(msgs)))
+}
+
+// OK reports whether every read message was delivered.
+func (d *delivery) OK() bool {
+	return d.rejectedCount.Load() == 0 && d.failedCount.Load() == 0 &&
+		d.deliveredCount.Load() == d.notifiedCount.Load()
+}
+
+func (d *delivery) Summary() string {
+	return fmt.Sprintf(
+		"read %d, delivered %d, failed %d, rejected %d",
+		d.notifiedCount.Load()+d.rejectedCount.Load(), d.deliveredCount.Load(), d.failedCount.Load(),
+		d.rejectedCount.Load(),
+	)
+}
+
+// printClient prints request bodies instead of sending them.
+type printClient struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (c *printClient) Do(_ context.Context, req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		body = append(body, '\n')
+	}
+
+	if _, err = c.w.Write(body); err != nil {
+		return nil, err
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"notifier"
+)
+
+func TestConfig_ParseFlags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: Config{InputFormat: inputLines},
+		},
+		{
+			name: "files_and_flags",
+			args: []string{"-input-format", "ndjson", "-wait-delivery", "-dry-run", "a.txt", "-"},
+			want: Config{InputFormat: inputNDJSON, WaitDelivery: true, DryRun: true, Files: []string{"a.txt", "-"}},
+		},
+		{
+			name:    "unknown_input_format",
+			args:    []string{"-input-format", "csv"},
+			wantErr: `input format must be one of lines, ndjson, length, got "csv"`,
+		},
+		{
+			name:    "unknown_flag",
+			args:    []string{"-unknown"},
+			wantErr: "flag provided but not defined: -unknown",
+		},
+		{
+			name:    "invalid_value",
+			args:    []string{"-retry-statuses", "500,abc"},
+			wantErr: `invalid value "500,abc" for flag -retry-statuses`,
+		},
+		{
+			name:    "invalid_header",
+			args:    []string{"-H", "no colon"},
+			wantErr: `invalid value "no colon" for flag -H`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				config := Config{}
+				err := config.ParseFlags(tt.args)
+
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("ParseFlags() error = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ParseFlags() error = %v", err)
+				}
+
+				diff := cmp.Diff(tt.want, config, cmp.AllowUnexported(Config{}), ignoreArgs, cmpopts.EquateEmpty())
+				if diff != "" {
+					t.Errorf("Config mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestConfig_ParseFlags_Help(t *testing.T) {
+	t.Parallel()
+
+	config := Config{}
+	if err := config.ParseFlags([]string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("ParseFlags() error = %v, want %v", err, flag.ErrHelp)
+	}
+}
+
+// TestConfig_NotifierConfig is not parallel because it sets environment variables.
+func TestConfig_NotifierConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifier.yaml")
+	data := "rps: 10\nsenders_count: 3\nbatch_size_bytes: 2048\nurl: http://file/notify\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(notifier.EnvPrefix+"SENDERS_COUNT", "5")
+	t.Setenv(notifier.EnvPrefix+"RPS", "20")
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    func(c *notifier.Config)
+		wantErr string
+	}{
+		{
+			name: "flags_over_env_over_file",
+			args: []string{"-config", path, "-rps", "30", "-i", "1s"},
+			want: func(c *notifier.Config) {
+				c.URL = "http://file/notify"
+				c.BatchSizeBytes = 2048
+				c.SendersCount = 5
+				c.RPS = 30
+				c.FlushInterval = time.Second
+			},
+		},
+		{
+			name: "flag_defaults_without_file",
+			want: func(c *notifier.Config) {
+				c.SendersCount = 5
+				c.RPS = 20
+			},
+		},
+		{
+			name:    "invalid_flag_value",
+			args:    []string{"-url", "/relative"},
+			wantErr: "url must be absolute",
+		},
+		{
+			name:    "missing_file",
+			args:    []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")},
+			wantErr: "failed to read config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				config := Config{}
+				if err := config.ParseFlags(tt.args); err != nil {
+					t.Fatalf("ParseFlags() error = %v", err)
+				}
+
+				got, err := config.NotifierConfig()
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("NotifierConfig() error = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("NotifierConfig() error = %v", err)
+				}
+
+				want := defaultNotifierConfig()
+				tt.want(&want)
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("NotifierConfig() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		record      func(d *delivery)
+		wantOK      bool
+		wantSummary string
+	}{
+		{
+			name: "all_delivered",
+			record: func(d *delivery) {
+				d.notified(true)
+				d.notified(true)
+				d.delivered([]string{"a", "b"})
+			},
+			wantOK:      true,
+			wantSummary: "read 2, delivered 2, failed 0, rejected 0",
+		},
+		{
+			name: "failed",
+			record: func(d *delivery) {
+				d.notified(true)
+				d.notified(true)
+				d.delivered([]string{"a"})
+				d.failed([]string{"b"}, errors.New("bad request"))
+			},
+			wantSummary: "read 2, delivered 1, failed 1, rejected 0",
+		},
+		{
+			name: "rejected",
+			record: func(d *delivery) {
+				d.notified(true)
+				d.notified(false)
+				d.delivered([]string{"a"})
+			},
+			wantSummary: "read 2, delivered 1, failed 0, rejected 1",
+		},
+		{
+			name: "not_finished",
+			record: func(d *delivery) {
+				d.notified(true)
+			},
+			wantSummary: "read 1, delivered 0, failed 0, rejected 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				d := &delivery{}
+				tt.record(d)
+
+				if diff := cmp.Diff(tt.wantOK, d.OK()); diff != "" {
+					t.Errorf("OK() mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantSummary, d.Summary()); diff != "" {
+					t.Errorf("Summary() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+// ignoreArgs ignores raw arguments kept for NotifierConfig
+var ignoreArgs = cmp.FilterPath(func(p cmp.Path) bool { return p.Last().String() == ".args" }, cmp.Ignore())
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"notifier"
+	"notifier/codec"
+	"notifier/errs"
+	"notifier/log"
+	"notifier/log/tag"
+	"notifier/signature"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+
+	serveShutdownTimeout = 5 * time.Second
+)
+
+// ServeConfig configures `notifier serve`.
+type ServeConfig struct {
+	Addr string
+	// Secret enables HMAC signature verification
+	Secret    string
+	Tolerance time.Duration
+	// Out is a file messages are appended to, "-" is stdout
+	Out string
+	// Format is text (a message per line) or json (a batch per line)
+	Format string
+
+	// FailRate is a probability of answering FailStatus instead of accepting a batch
+	FailRate   float64
+	FailStatus int
+	Latency    time.Duration
+	Seed       uint64
+}
+
+// ParseServeFlags parses flags of `notifier serve`.
+func (config *ServeConfig) ParseServeFlags(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+
+	fs.StringVar(&config.Addr, "addr", "localhost:8080", "Address to listen on")
+	fs.StringVar(&config.Secret, "secret", os.Getenv(notifier.EnvPrefix+"SIGNING_SECRET"),
+		"HMAC secret to verify signatures with. Defaults to "+notifier.EnvPrefix+"SIGNING_SECRET")
+	fs.DurationVar(&config.Tolerance, "tolerance", signature.DefaultTolerance, "Max age of a signed request")
+	fs.StringVar(&config.Out, "out", "-", "File to append messages to, - is stdout")
+	fs.StringVar(&config.Format, "format", formatText, "Output format: text (a message per line) or json (a batch per line)")
+	fs.Float64Var(&config.FailRate, "fail", 0, "Probability of rejecting a batch")
+	fs.IntVar(&config.FailStatus, "fail-status", http.StatusServiceUnavailable, "Status of rejected batches")
+	fs.DurationVar(&config.Latency, "latency", 0, "Delay before answering")
+	fs.Uint64Var(&config.Seed, "seed", 1, "Seed of simulated failures")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	return config.Validate()
+}
+
+// Validate reports nonsense values.
+func (config *ServeConfig) Validate() error {
+	var problems []error
+
+	if config.Format != formatText && config.Format != formatJSON {
+		problems = append(problems, fmt.Errorf("unknown format %q", config.Format))
+	}
+
+	if config.FailRate < 0 || config.FailRate > 1 {
+		problems = append(problems, errors.New("fail must be in [0, 1]"))
+	}
+
+	if config.FailStatus < 100 || config.FailStatus > 999 {
+		problems = append(problems, fmt.Errorf("fail-status %d is invalid", config.FailStatus))
+	}
+
+	if config.Latency < 0 || config.Tolerance < 0 {
+		problems = append(problems, errors.New("latency and tolerance must not be negative"))
+	}
+
+	return errors.Join(problems...)
+}
+
+// runServe starts a local receiver of notifier batches until SIGINT or SIGTERM.
+func runServe(args []string) error {
+	config := ServeConfig{}
+	if err := config.ParseServeFlags(args); err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if config.Out != "-" {
+		f, err := os.OpenFile(config.Out, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		out = f
+	}
+
+	r := newReceiver(&config, out)
+	srv := &http.Server{Addr: config.Addr, Handler: r, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.ListenAndServe()
+	}()
+
+	log.Info("receiver is listening", "addr", config.Addr, "signed", config.Secret != "", "fail_rate", config.FailRate)
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info("Gracefully shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	accepted, rejected, msgs := r.Stats()
+	log.Info("receiver stopped", "accepted_batches", accepted, "rejected_batches", rejected, tag.Msgs, msgs)
+
+	return nil
+}
+
+// receiver accepts notifier batches and writes their messages to out.
+type receiver struct {
+	config *ServeConfig
+
+	mu       sync.Mutex
+	out      io.Writer
+	rng      *rand.Rand
+	accepted int
+	rejected int
+	msgs     int
+}
+
+func newReceiver(config *ServeConfig, out io.Writer) *receiver {
+	return &receiver{
+		config: config,
+		out:    out,
+		rng:    rand.New(rand.NewPCG(config.Seed, config.Seed)),
+	}
+}
+
+// receivedBatch is a line of json output format.
+type receivedBatch struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Codec      string    `json:"codec"`
+	Messages   []string  `json:"messages"`
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rc.config.Latency > 0 {
+		select {
+		case <-time.After(rc.config.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if rc.config.Secret != "" {
+		err = signature.Verify(r.Header, []byte(rc.config.Secret), time.Now(), rc.config.Tolerance, body)
+		if err != nil {
+			rc.reject(w, http.StatusUnauthorized, err)
+			return
+		}
+	}
+
+	c, msgs, err := decodeBatch(r.Header, body)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errs.ErrNotFound) {
+			status = http.StatusUnsupportedMediaType
+		}
+
+		rc.reject(w, status, err)
+		return
+	}
+
+	if rc.fail() {
+		if rc.config.FailStatus == http.StatusTooManyRequests || rc.config.FailStatus == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "1")
+		}
+
+		rc.reject(w, rc.config.FailStatus, errors.New("simulated failure"))
+		return
+	}
+
+	if err = rc.write(receivedBatch{ReceivedAt: time.Now(), Codec: c.Name(), Messages: msgs}); err != nil {
+		rc.reject(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (rc *receiver) fail() bool {
+	if rc.config.FailRate == 0 {
+		return false
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.rng.Float64() < rc.config.FailRate
+}
+
+func (rc *receiver) reject(w http.ResponseWriter, status int, err error) {
+	rc.mu.Lock()
+	rc.rejected++
+	rc.mu.Unlock()
+
+	log.Warn("batch rejected", tag.HTTPCode, status, tag.Err, err)
+	http.Error(w, err.Error(), status)
+}
+
+func (rc *receiver) write(b receivedBatch) error {
+	var buf strings.Builder
+
+	switch rc.config.Format {
+	case formatJSON:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+
+		buf.Write(data)
+		buf.WriteByte('\n')
+	default:
+		for _, msg := range b.Messages {
+			buf.WriteString(msg)
+			buf.WriteByte('\n')
+		}
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, err := io.WriteString(rc.out, buf.String()); err != nil {
+		return err
+	}
+
+	rc.accepted++
+	rc.msgs += len(b.Messages)
+
+	return nil
+}
+
+// Stats returns the number of accepted and rejected batches and accepted messages.
+func (rc *receiver) Stats() (accepted, rejected, msgs int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return rc.accepted, rc.rejected, rc.msgs
+}
+
+// decodeBatch decodes body by Content-Type of the request. JSON is assumed if it's missing.
+// Unsupported Content-Type is reported as errs.ErrNotFound.
+func decodeBatch(h http.Header, body []byte) (codec.Codec, []string, error) {
+	c := codec.JSON
+	if contentType := h.Get("Content-Type"); contentType != "" {
+		var err error
+		if c, err = codec.ByContentType(contentType); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	msgs, err := c.Decode(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, msgs, nil
+}
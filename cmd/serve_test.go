@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/signature"
+)
+
+func TestReceiver_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	const secret = "secret"
+
+	tests := []struct {
+		name        string
+		config      ServeConfig
+		contentType string
+		body        string
+		// sign signs the request with the secret, tamper changes the body after signing
+		sign, tamper   bool
+		wantStatus     int
+		wantOut        string
+		wantRetryAfter string
+	}{
+		{
+			name:       "json",
+			body:       `{"messages":["a","b"]}`,
+			wantStatus: http.StatusOK,
+			wantOut:    "a\nb\n",
+		},
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body:        "\"a\"\n\"b\"\n",
+			wantStatus:  http.StatusOK,
+			wantOut:     "a\nb\n",
+		},
+		{
+			name:        "unsupported_content_type",
+			contentType: "text/csv",
+			body:        "a,b",
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "invalid_body",
+			body:       `{"messages":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "signed",
+			config:     ServeConfig{Secret: secret},
+			body:       `{"messages":["a"]}`,
+			sign:       true,
+			wantStatus: http.StatusOK,
+			wantOut:    "a\n",
+		},
+		{
+			name:       "unsigned",
+			config:     ServeConfig{Secret: secret},
+			body:       `{"messages":["a"]}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "tampered",
+			config:     ServeConfig{Secret: secret},
+			body:       `{"messages":["a"]}`,
+			sign:       true,
+			tamper:     true,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "simulated_failure",
+			config:         ServeConfig{FailRate: 1, FailStatus: http.StatusServiceUnavailable},
+			body:           `{"messages":["a"]}`,
+			wantStatus:     http.StatusServiceUnavailable,
+			wantRetryAfter: "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				var out strings.Builder
+				config := tt.config
+				config.Format = formatText
+				config.Tolerance = signature.DefaultTolerance
+				rc := newReceiver(&config, &out)
+
+				req := httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(tt.body))
+				if tt.contentType != "" {
+					req.Header.Set("Content-Type", tt.contentType)
+				}
+				if tt.sign {
+					signature.Sign(req.Header, []byte(secret), time.Now(), []byte(tt.body))
+				}
+				if tt.tamper {
+					req.Body = http.NoBody
+				}
+
+				w := httptest.NewRecorder()
+				rc.ServeHTTP(w, req)
+
+				if diff := cmp.Diff(tt.wantStatus, w.Code); diff != "" {
+					t.Errorf("status mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantOut, out.String()); diff != "" {
+					t.Errorf("output mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantRetryAfter, w.Header().Get("Retry-After")); diff != "" {
+					t.Errorf("Retry-After mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestReceiver_ServeHTTP_JSON_Format(t *testing.T) {
+	t.Parallel()
+
+	var out strings.Builder
+	rc := newReceiver(&ServeConfig{Format: formatJSON}, &out)
+
+	req := httptest.NewRequest(http.MethodPost, "/notify", strings.NewReader(`{"messages":["a","b"]}`))
+	rc.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got receivedBatch
+	if err := json.Unmarshal([]byte(out.String()), &got); err != nil {
+		t.Fatalf("output %q: %v", out.String(), err)
+	}
+	if diff := cmp.Diff(receivedBatch{Codec: "json", Messages: []string{"a", "b"}}, got, ignoreReceivedAt); diff != "" {
+		t.Errorf("batch mismatch (-want +got):\n%s", diff)
+	}
+
+	accepted, rejected, msgs := rc.Stats()
+	if diff := cmp.Diff([]int{1, 0, 2}, []int{accepted, rejected, msgs}); diff != "" {
+		t.Errorf("Stats() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServeConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	valid := ServeConfig{Format: formatText, FailStatus: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name     string
+		modify   func(c *ServeConfig)
+		wantText []string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *ServeConfig) {},
+		},
+		{
+			name: "all_problems_reported",
+			modify: func(c *ServeConfig) {
+				c.Format = "xml"
+				c.FailRate = 2
+				c.FailStatus = 42
+				c.Latency = -time.Second
+			},
+			wantText: []string{
+				`unknown format "xml"`, "fail must be in [0, 1]", "fail-status 42 is invalid",
+				"latency and tolerance must not be negative",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				c := valid
+				tt.modify(&c)
+
+				assertProblems(t, c.Validate(), tt.wantText)
+			},
+		)
+	}
+}
+
+// assertProblems checks that err reports every problem of wantText, nil err is expected without them.
+func assertProblems(t *testing.T, err error, wantText []string) {
+	t.Helper()
+
+	if len(wantText) == 0 {
+		if err != nil {
+			t.Fatalf("Validate() error = %v", err)
+		}
+		return
+	}
+
+	if err == nil {
+		t.Fatalf("Validate() error = nil, want %q", wantText)
+	}
+	for _, text := range wantText {
+		if !strings.Contains(err.Error(), text) {
+			t.Errorf("Validate() error = %v, want it to contain %q", err, text)
+		}
+	}
+}
+
+// ignoreReceivedAt ignores the time batches are received at
+var ignoreReceivedAt = cmp.FilterPath(func(p cmp.Path) bool { return p.Last().String() == ".ReceivedAt" }, cmp.Ignore())
@@ -0,0 +1,101 @@
+package codec
+
+import (
+	"unicode/utf8"
+)
+
+// Appender is implemented by codecs that encode batches into a caller's buffer, so buffers can be reused
+// between batches. Encode of such codecs is AppendEncode with a nil buffer.
+type Appender interface {
+	AppendEncode(dst []byte, msgs []string) ([]byte, error)
+}
+
+const hex = "0123456789abcdef"
+
+// safeSet and htmlSafeSet are ASCII bytes that are appended to JSON strings as is
+var safeSet, htmlSafeSet = func() (safe, htmlSafe [utf8.RuneSelf]bool) {
+	for b := byte(0x20); b < utf8.RuneSelf; b++ {
+		safe[b] = b != '"' && b != '\\'
+		htmlSafe[b] = safe[b] && b != '<' && b != '>' && b != '&'
+	}
+
+	return safe, htmlSafe
+}()
+
+// appendString appends s as JSON string exactly like encoding/json does. escapeHTML escapes <, > and &
+// like json.Marshal, json.Encoder with SetEscapeHTML(false) doesn't.
+func appendString(dst []byte, s string, escapeHTML bool) []byte {
+	safe := &safeSet
+	if escapeHTML {
+		safe = &htmlSafeSet
+	}
+
+	dst = append(dst, '"')
+
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if safe[b] {
+				i++
+				continue
+			}
+
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+
+			i++
+			start = i
+			continue
+		}
+
+		c, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case c == utf8.RuneError && size == 1:
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+		case c == '\u2028' || c == '\u2029':
+			// valid JSON, but not valid JavaScript
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[c&0xF])
+		default:
+			i += size
+			continue
+		}
+
+		i += size
+		start = i
+	}
+
+	dst = append(dst, s[start:]...)
+
+	return append(dst, '"')
+}
+
+// grow makes room for msgs, assuming they need no escaping, plus perMsg bytes of quotes and separators each.
+func grow(dst []byte, msgs []string, perMsg int) []byte {
+	n := len(msgs) * perMsg
+	for _, msg := range msgs {
+		n += len(msg)
+	}
+
+	if cap(dst)-len(dst) < n {
+		dst = append(make([]byte, 0, len(dst)+n), dst...)
+	}
+
+	return dst
+}
@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"mime"
+	"sort"
+	"strings"
+
+	"notifier/errs"
+)
+
+// Codec encodes batches of messages into HTTP request bodies and decodes them back.
+type Codec interface {
+	// Name is used to choose Codec in configuration
+	Name() string
+	// ContentType is sent as Content-Type header of requests
+	ContentType() string
+	Encode(msgs []string) ([]byte, error)
+	Decode(body []byte) ([]string, error)
+}
+
+var (
+	// JSON encodes batches as `{"messages":["hello_world", "hello_world"]}`. It's the default codec.
+	JSON Codec = jsonCodec{}
+	// NDJSON encodes every message as JSON string on a separate line.
+	NDJSON Codec = ndjsonCodec{}
+)
+
+var registry = map[string]Codec{
+	JSON.Name():   JSON,
+	NDJSON.Name(): NDJSON,
+}
+
+// ByName returns registered Codec by its name.
+func ByName(name string) (Codec, error) {
+	c, ok := registry[strings.ToLower(name)]
+	if !ok {
+		return nil, errs.Wrap(errs.ErrNotFound, "unknown codec "+name+", supported: "+strings.Join(Names(), ", "))
+	}
+
+	return c, nil
+}
+
+// ByContentType returns registered Codec by Content-Type header value. Parameters like charset are ignored.
+func ByContentType(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrValidation, "invalid content type "+contentType)
+	}
+
+	for _, c := range registry {
+		if c.ContentType() == mediaType {
+			return c, nil
+		}
+	}
+
+	return nil, errs.Wrap(errs.ErrNotFound, "unsupported content type "+contentType)
+}
+
+// Names returns sorted names of all registered codecs.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,227 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/errs"
+)
+
+func TestCodec_Encode_Decode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		codec    Codec
+		msgs     []string
+		wantBody string
+	}{
+		{
+			name:     "json_multiple_messages",
+			codec:    JSON,
+			msgs:     []string{"foo", "bar"},
+			wantBody: `{"messages":["foo","bar"]}`,
+		},
+		{
+			name:     "json_empty_batch",
+			codec:    JSON,
+			msgs:     []string{},
+			wantBody: `{"messages":[]}`,
+		},
+		{
+			name:     "ndjson_multiple_messages",
+			codec:    NDJSON,
+			msgs:     []string{"foo", `{"a":"<b>"}`},
+			wantBody: "\"foo\"\n\"{\\\"a\\\":\\\"<b>\\\"}\"\n",
+		},
+		{
+			name:     "ndjson_message_with_new_line",
+			codec:    NDJSON,
+			msgs:     []string{"line1\nline2"},
+			wantBody: "\"line1\\nline2\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				body, err := tt.codec.Encode(tt.msgs)
+				if err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+
+				if diff := cmp.Diff(tt.wantBody, string(body)); diff != "" {
+					t.Errorf("Encode() mismatch (-want +got):\n%s", diff)
+				}
+
+				got, err := tt.codec.Decode(body)
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+
+				if diff := cmp.Diff(tt.msgs, got); diff != "" {
+					t.Errorf("Decode() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestAppendEncode_Matches_Encoding_JSON(t *testing.T) {
+	t.Parallel()
+
+	msgs := []string{
+		"plain", `quotes " and \ slashes`, "<html> & co", "\b\f\n\r\t\x00\x1f\x7f",
+		"юникод 🙂", "\u2028\u2029", "invalid \xff\xfe utf8", "",
+	}
+
+	ndjson := &bytes.Buffer{}
+	enc := json.NewEncoder(ndjson)
+	enc.SetEscapeHTML(false)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			t.Fatalf("json.Encoder.Encode() error = %v", err)
+		}
+	}
+
+	jsonBody, err := json.Marshal(map[string][]string{"messages": msgs})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		codec Codec
+		want  string
+	}{
+		{name: "json", codec: JSON, want: string(jsonBody)},
+		{name: "ndjson", codec: NDJSON, want: ndjson.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				// appended after the existing content of dst
+				got, err := tt.codec.(Appender).AppendEncode([]byte("prefix"), msgs)
+				if err != nil {
+					t.Fatalf("AppendEncode() error = %v", err)
+				}
+
+				if diff := cmp.Diff("prefix"+tt.want, string(got)); diff != "" {
+					t.Errorf("AppendEncode() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestCodec_Decode_Invalid_Body(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []Codec{JSON, NDJSON} {
+		if _, err := c.Decode([]byte(`{"messages":`)); !errors.Is(err, errs.ErrValidation) {
+			t.Errorf("%s Decode() error = %v, want %v", c.Name(), err, errs.ErrValidation)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		arg     string
+		want    Codec
+		wantErr error
+	}{
+		{
+			name: "json",
+			arg:  "json",
+			want: JSON,
+		},
+		{
+			name: "ndjson_upper_case",
+			arg:  "NDJSON",
+			want: NDJSON,
+		},
+		{
+			name:    "unknown",
+			arg:     "xml",
+			wantErr: errs.ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				got, err := ByName(tt.arg)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ByName() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if got != tt.want {
+					t.Errorf("ByName() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestByContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		arg     string
+		want    Codec
+		wantErr error
+	}{
+		{
+			name: "json_with_charset",
+			arg:  "application/json; charset=utf-8",
+			want: JSON,
+		},
+		{
+			name: "ndjson",
+			arg:  "application/x-ndjson",
+			want: NDJSON,
+		},
+		{
+			name:    "unsupported",
+			arg:     "text/plain",
+			wantErr: errs.ErrNotFound,
+		},
+		{
+			name:    "invalid",
+			arg:     "",
+			wantErr: errs.ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				got, err := ByContentType(tt.arg)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ByContentType() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if got != tt.want {
+					t.Errorf("ByContentType() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"notifier/errs"
+)
+
+type jsonCodec struct{}
+
+type jsonBody struct {
+	Messages []string `json:"messages"`
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (c jsonCodec) Encode(msgs []string) ([]byte, error) {
+	return c.AppendEncode(nil, msgs)
+}
+
+// AppendEncode appends the same body json.Marshal makes without reflection and intermediate buffers.
+func (jsonCodec) AppendEncode(dst []byte, msgs []string) ([]byte, error) {
+	dst = grow(dst, msgs, 3)
+	dst = append(dst, `{"messages":`...)
+
+	if msgs == nil {
+		return append(dst, `null}`...), nil
+	}
+
+	dst = append(dst, '[')
+	for i, msg := range msgs {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendString(dst, msg, true)
+	}
+
+	return append(dst, ']', '}'), nil
+}
+
+func (jsonCodec) Decode(body []byte) ([]string, error) {
+	var b jsonBody
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, errs.Wrap(errs.ErrValidation, err.Error())
+	}
+
+	return b.Messages, nil
+}
@@ -0,0 +1,55 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"notifier/errs"
+)
+
+type ndjsonCodec struct{}
+
+func (ndjsonCodec) Name() string {
+	return "ndjson"
+}
+
+func (ndjsonCodec) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (c ndjsonCodec) Encode(msgs []string) ([]byte, error) {
+	return c.AppendEncode(nil, msgs)
+}
+
+// AppendEncode appends the same body json.Encoder with SetEscapeHTML(false) makes.
+func (ndjsonCodec) AppendEncode(dst []byte, msgs []string) ([]byte, error) {
+	dst = grow(dst, msgs, 3)
+
+	for _, msg := range msgs {
+		dst = appendString(dst, msg, false)
+		dst = append(dst, '\n')
+	}
+
+	return dst, nil
+}
+
+func (ndjsonCodec) Decode(body []byte) ([]string, error) {
+	msgs := make([]string, 0, bytes.Count(body, []byte{'\n'}))
+
+	for i, line := range bytes.Split(body, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg string
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, errs.Wrap(errs.ErrValidation, "line "+strconv.Itoa(i+1)+": "+err.Error())
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,474 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"notifier/clock"
+	"notifier/codec"
+	"notifier/errs"
+	"notifier/internal"
+	"notifier/log"
+	"notifier/log/tag"
+	"notifier/redact"
+	"notifier/retry"
+	"notifier/transform"
+)
+
+const (
+	// EnvPrefix is a prefix of environment variables that override Config, e.g. NOTIFIER_BATCH_SIZE_BYTES
+	EnvPrefix = "NOTIFIER_"
+
+	AuthTypeNone   = ""
+	AuthTypeBasic  = "basic"
+	AuthTypeBearer = "bearer"
+)
+
+// Config declares every knob of Notifier. It can be loaded from YAML or JSON file and NOTIFIER_* environment
+// variables with LoadConfig. Use DefaultConfig to get optimal values.
+type Config struct {
+	// URL notifications are sent to
+	URL string `yaml:"url" json:"url"`
+	// Name is added to every log line of the Notifier, e.g. to tell apart Notifiers of different endpoints
+	Name string `yaml:"name" json:"name"`
+
+	InputChanSize  int `yaml:"input_chan_size" json:"input_chan_size"`
+	OutputChanSize int `yaml:"output_chan_size" json:"output_chan_size"`
+
+	BatchSizeBytes int           `yaml:"batch_size_bytes" json:"batch_size_bytes"`
+	FlushInterval  time.Duration `yaml:"flush_interval" json:"flush_interval"`
+
+	// AggregatorShards is the number of Aggregators, each with its own input channel of InputChanSize and batch.
+	// Messages are spread over shards round-robin or by key of NotifyKey.
+	AggregatorShards int `yaml:"aggregator_shards" json:"aggregator_shards"`
+	// InputQueue is InputQueueChannel or InputQueueRing
+	InputQueue string `yaml:"input_queue" json:"input_queue"`
+	// MemoryBudgetBytes limits the size of messages held from Notify until they are delivered or dropped.
+	// Zero means no limit.
+	MemoryBudgetBytes int `yaml:"memory_budget_bytes" json:"memory_budget_bytes"`
+	// Overflow is OverflowBlock or OverflowDrop, it's applied when the memory budget is exhausted
+	Overflow string `yaml:"overflow" json:"overflow"`
+
+	// Delivery is DeliveryBatch or DeliveryStream
+	Delivery string `yaml:"delivery" json:"delivery"`
+	// StreamMaxBytes and StreamMaxAge rotate streams of DeliveryStream
+	StreamMaxBytes int           `yaml:"stream_max_bytes" json:"stream_max_bytes"`
+	StreamMaxAge   time.Duration `yaml:"stream_max_age" json:"stream_max_age"`
+
+	// Transport is TransportHTTP or TransportGRPC
+	Transport string `yaml:"transport" json:"transport"`
+
+	SendersCount int           `yaml:"senders_count" json:"senders_count"`
+	HTTPTimeout  time.Duration `yaml:"http_timeout" json:"http_timeout"`
+
+	// RetryCount is the number of retries after the first attempt
+	RetryCount    int           `yaml:"retry_count" json:"retry_count"`
+	RetryDelay    time.Duration `yaml:"retry_delay" json:"retry_delay"`
+	RetryMaxDelay time.Duration `yaml:"retry_max_delay" json:"retry_max_delay"`
+	// RetryStatuses are response statuses that are retried
+	RetryStatuses []int `yaml:"retry_statuses" json:"retry_statuses"`
+	// RetryMaxElapsed stops retrying after that time since the first attempt. Zero means no limit.
+	RetryMaxElapsed time.Duration `yaml:"retry_max_elapsed" json:"retry_max_elapsed"`
+	// RetryAttemptTimeout limits a single attempt. Zero means only HTTPTimeout applies.
+	RetryAttemptTimeout time.Duration `yaml:"retry_attempt_timeout" json:"retry_attempt_timeout"`
+	// RetryHonorRetryAfter waits as long as Retry-After response header asks
+	RetryHonorRetryAfter bool `yaml:"retry_honor_retry_after" json:"retry_honor_retry_after"`
+	// RetryAfterMax caps delays asked by Retry-After. Batches wait in the delay queue and Stop waits for them,
+	// so a response asking for an hour doesn't block either for that long. Zero means retry.DefaultMaxRetryAfter.
+	RetryAfterMax time.Duration `yaml:"retry_after_max" json:"retry_after_max"`
+
+	// RPS limits requests per second of all senders
+	RPS int `yaml:"rps" json:"rps"`
+
+	// Encoder is a name of codec.Codec used to encode batches, e.g. json or ndjson
+	Encoder string `yaml:"encoder" json:"encoder"`
+	// Headers are added to every request
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	Auth    AuthConfig        `yaml:"auth" json:"auth"`
+	// SigningSecret signs request bodies with HMAC-SHA256, see signature package. Empty disables signing
+	SigningSecret string `yaml:"signing_secret" json:"signing_secret"`
+	// Template renders every message with text/template, see transform.Template. Empty sends messages as is.
+	Template string `yaml:"template" json:"template"`
+	// Ordering is one of OrderingNone, OrderingKey or OrderingGlobal
+	Ordering string `yaml:"ordering" json:"ordering"`
+	// LogSampleInterval and LogSampleBurst limit warnings and errors with the same message to LogSampleBurst lines
+	// per LogSampleInterval, so an outage doesn't flood logs. Zero interval logs every line.
+	LogSampleInterval time.Duration `yaml:"log_sample_interval" json:"log_sample_interval"`
+	LogSampleBurst    int           `yaml:"log_sample_burst" json:"log_sample_burst"`
+	// Redaction removes personal data from messages that are logged. Messages are logged as is without rules.
+	Redaction redact.Config `yaml:"redaction" json:"redaction"`
+}
+
+// AuthConfig sets Authorization header of requests.
+type AuthConfig struct {
+	// Type is one of AuthTypeNone, AuthTypeBasic or AuthTypeBearer
+	Type     string `yaml:"type" json:"type"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+	Token    string `yaml:"token" json:"token"`
+}
+
+// DefaultConfig returns Config with the same values Default uses.
+func DefaultConfig() Config {
+	return Config{
+		InputChanSize:  DefaultInputChanSize,
+		OutputChanSize: DefaultOutputChanSize,
+		BatchSizeBytes: DefaultBatchSizeBytes,
+		FlushInterval:  DefaultFlushInterval,
+		SendersCount:   DefaultSendersCount,
+		HTTPTimeout:    DefaultHTTPTimeout,
+		RetryCount:     DefaultRetryCount,
+		RetryDelay:     DefaultRetryDelay,
+		RetryMaxDelay:  DefaultRetryMaxDelay,
+		RetryStatuses:  retry.DefaultRetryableStatuses,
+		RPS:            DefaultRPS,
+		Encoder:        codec.JSON.Name(),
+
+		AggregatorShards:     DefaultAggregatorShards,
+		RetryHonorRetryAfter: true,
+		RetryAfterMax:        retry.DefaultMaxRetryAfter,
+		StreamMaxBytes:       DefaultStreamMaxBytes,
+		StreamMaxAge:         DefaultStreamMaxAge,
+		LogSampleInterval:    DefaultLogSampleInterval,
+		LogSampleBurst:       DefaultLogSampleBurst,
+	}
+}
+
+// LoadConfig returns DefaultConfig overridden by the file at path (if path is not empty)
+// and then by NOTIFIER_* environment variables. The result is validated.
+func LoadConfig(path string) (Config, error) {
+	return DefaultConfig().Load(path)
+}
+
+// Load returns c overridden by the file at path (if path is not empty) and then by NOTIFIER_* environment variables.
+// The result is validated. JSON and YAML files are supported, unknown fields are rejected.
+func (c Config) Load(path string) (Config, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, errs.Wrap(err, "failed to read config file")
+		}
+
+		if err = c.decode(data); err != nil {
+			return Config{}, errs.Wrap(err, "failed to parse config file "+path)
+		}
+	}
+
+	if err := c.applyEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+
+	return c, nil
+}
+
+// decode overrides fields that are present in data. JSON is a subset of YAML, so both are handled by YAML decoder.
+func (c *Config) decode(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	if err := dec.Decode(c); err != nil {
+		return errs.Wrap(errs.ErrValidation, err.Error())
+	}
+
+	return nil
+}
+
+// applyEnv overrides fields by environment variables. Variable name is EnvPrefix followed by upper-cased yaml path
+// joined with underscores, e.g. NOTIFIER_AUTH_TOKEN. Lists are comma separated values and maps are comma separated
+// key=value pairs.
+func (c *Config) applyEnv(lookup func(key string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, lookup)
+}
+
+func applyEnv(v reflect.Value, prefix string, lookup func(key string) (string, bool)) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := prefix + strings.ToUpper(name)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field, key+"_", lookup); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		value, ok := lookup(key)
+		if !ok {
+			continue
+		}
+
+		if err := setField(field, value); err != nil {
+			return errs.Wrap(err, "invalid environment variable "+key)
+		}
+	}
+
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errs.Wrap(errs.ErrValidation, err.Error())
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errs.Wrap(errs.ErrValidation, err.Error())
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errs.Wrap(errs.ErrValidation, err.Error())
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Type() == reflect.TypeOf([]int(nil)):
+		var ints []int
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+
+			n, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return errs.Wrap(errs.ErrValidation, err.Error())
+			}
+			ints = append(ints, n)
+		}
+		field.Set(reflect.ValueOf(ints))
+	case field.Type() == reflect.TypeOf([]string(nil)):
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) != "" {
+				items = append(items, strings.TrimSpace(item))
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case field.Type() == reflect.TypeOf(map[string]string(nil)):
+		m := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			k, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return errs.Wrap(errs.ErrValidation, "expected key=value pairs, got "+pair)
+			}
+			m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+		}
+		field.Set(reflect.ValueOf(m))
+	default:
+		return errs.Wrap(errs.ErrInternal, "unsupported field type "+field.Type().String())
+	}
+
+	return nil
+}
+
+// Validate checks that Config can be used to build Notifier. All problems are reported at once.
+func (c Config) Validate() error {
+	return c.validate(nil)
+}
+
+// validate is Validate with the codec of WithEncoder. Encoder must name a registered codec only if enc is nil,
+// custom codecs are not registered by name.
+func (c Config) validate(enc codec.Codec) error {
+	var problems []error
+
+	check := func(ok bool, msg string) {
+		if !ok {
+			problems = append(problems, errs.Wrap(errs.ErrValidation, msg))
+		}
+	}
+
+	u, err := url.Parse(c.URL)
+	check(c.URL != "", "url is required")
+	check(c.URL == "" || (err == nil && u.Scheme != "" && u.Host != ""), "url must be absolute, got "+c.URL)
+
+	check(c.InputChanSize >= 0, "input_chan_size must not be negative")
+	check(c.OutputChanSize >= 0, "output_chan_size must not be negative")
+	check(c.BatchSizeBytes > 0, "batch_size_bytes must be positive")
+	check(c.FlushInterval > 0, "flush_interval must be positive")
+	check(c.AggregatorShards > 0, "aggregator_shards must be positive")
+	check(c.AggregatorShards <= 1 || c.Ordering == OrderingNone, "aggregator_shards must be 1 with ordering")
+	check(c.SendersCount > 0, "senders_count must be positive")
+	check(c.HTTPTimeout > 0, "http_timeout must be positive")
+	check(c.RetryCount >= 0, "retry_count must not be negative")
+	check(c.RetryDelay >= 0, "retry_delay must not be negative")
+	check(c.RetryMaxDelay >= c.RetryDelay, "retry_max_delay must not be less than retry_delay")
+	check(c.RetryMaxElapsed >= 0, "retry_max_elapsed must not be negative")
+	check(c.RetryAttemptTimeout >= 0, "retry_attempt_timeout must not be negative")
+	check(c.RetryAfterMax >= 0, "retry_after_max must not be negative")
+	for _, status := range c.RetryStatuses {
+		check(status >= 100 && status <= 599, "retry_statuses must be HTTP statuses, got "+strconv.Itoa(status))
+	}
+	check(c.RPS > 0, "rps must be positive")
+
+	if enc == nil {
+		if _, err = codec.ByName(c.Encoder); err != nil {
+			problems = append(problems, errs.Wrap(errs.ErrValidation, "encoder: "+err.Error()))
+		}
+	}
+
+	if c.Template != "" {
+		if _, err = transform.Template(c.Template); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if _, err = redact.New(c.Redaction); err != nil {
+		problems = append(problems, err)
+	}
+
+	switch c.Ordering {
+	case OrderingNone, OrderingKey, OrderingGlobal:
+	default:
+		check(false, "ordering must be one of key, global or empty, got "+c.Ordering)
+	}
+
+	check(c.LogSampleInterval >= 0, "log_sample_interval must not be negative")
+	check(c.LogSampleInterval == 0 || c.LogSampleBurst > 0, "log_sample_burst must be positive with log_sample_interval")
+
+	check(c.MemoryBudgetBytes >= 0, "memory_budget_bytes must not be negative")
+	switch c.Overflow {
+	case OverflowBlock, OverflowDrop:
+	default:
+		check(false, "overflow must be drop or empty, got "+c.Overflow)
+	}
+
+	switch c.Delivery {
+	case DeliveryBatch:
+	case DeliveryStream:
+		check(c.StreamMaxBytes > 0, "stream_max_bytes must be positive")
+		check(c.StreamMaxAge > 0, "stream_max_age must be positive")
+		check(c.StreamMaxAge < c.HTTPTimeout, "stream_max_age must be less than http_timeout")
+		check(c.Encoder == codec.NDJSON.Name(), "encoder must be ndjson with stream delivery")
+		check(c.Ordering == OrderingNone, "ordering is not supported with stream delivery")
+		check(c.InputQueue == InputQueueChannel, "input_queue must be empty with stream delivery")
+		check(c.SigningSecret == "", "signing_secret is not supported with stream delivery")
+	default:
+		check(false, "delivery must be stream or empty, got "+c.Delivery)
+	}
+
+	switch c.Transport {
+	case TransportHTTP:
+	case TransportGRPC:
+		check(c.Delivery == DeliveryBatch, "delivery must be empty with grpc transport")
+		check(c.SigningSecret == "", "signing_secret is not supported with grpc transport")
+	default:
+		check(false, "transport must be grpc or empty, got "+c.Transport)
+	}
+
+	switch c.InputQueue {
+	case InputQueueChannel, InputQueueRing:
+	default:
+		check(false, "input_queue must be ring or empty, got "+c.InputQueue)
+	}
+
+	switch c.Auth.Type {
+	case AuthTypeNone:
+	case AuthTypeBasic:
+		check(c.Auth.Username != "", "auth.username is required for basic auth")
+	case AuthTypeBearer:
+		check(c.Auth.Token != "", "auth.token is required for bearer auth")
+	default:
+		check(false, "auth.type must be one of basic, bearer or empty, got "+c.Auth.Type)
+	}
+
+	return errors.Join(problems...)
+}
+
+// retryPolicy builds retry.Policy from retry_* fields.
+func (c Config) retryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:       c.RetryCount + 1,
+		RetryableStatuses: c.RetryStatuses,
+		InitialDelay:      c.RetryDelay,
+		MaxDelay:          c.RetryMaxDelay,
+		Multiplier:        retry.DefaultMultiplier,
+		MaxElapsedTime:    c.RetryMaxElapsed,
+		PerAttemptTimeout: c.RetryAttemptTimeout,
+		HonorRetryAfter:   c.RetryHonorRetryAfter,
+		MaxRetryAfter:     c.RetryAfterMax,
+	}
+}
+
+// topology returns how messages flow from Notify to Senders with c.
+func (c Config) topology() topology {
+	topo := topology{ordering: c.Ordering, shards: c.AggregatorShards, ring: c.InputQueue == InputQueueRing}
+	if c.Delivery == DeliveryStream {
+		topo.stream = &internal.StreamOptions{MaxBytes: c.StreamMaxBytes, MaxAge: c.StreamMaxAge, Header: c.header()}
+	}
+
+	return topo
+}
+
+// logger returns base with tags of the Notifier, sampled if log_sample_interval is set.
+func (c Config) logger(base log.Logger, clk clock.Clock) log.Logger {
+	args := []interface{}{tag.Destination, destination(c.URL)}
+	if c.Name != "" {
+		args = append(args, tag.Notifier, c.Name)
+	}
+
+	l := log.With(base, args...)
+	if c.LogSampleInterval > 0 {
+		l = log.Sample(l, c.LogSampleInterval, c.LogSampleBurst, clk)
+	}
+
+	return l
+}
+
+// destination returns rawURL without credentials, query and fragment, so it can be logged.
+func destination(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+
+	return u.String()
+}
+
+// header builds headers that are sent with every request.
+func (c Config) header() http.Header {
+	h := http.Header{}
+	for k, v := range c.Headers {
+		h.Set(k, v)
+	}
+
+	switch c.Auth.Type {
+	case AuthTypeBasic:
+		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.Auth.Username+":"+c.Auth.Password)))
+	case AuthTypeBearer:
+		h.Set("Authorization", "Bearer "+c.Auth.Token)
+	}
+
+	return h
+}
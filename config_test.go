@@ -0,0 +1,406 @@
+package notifier
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/errs"
+	"notifier/notifiertest"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	want := DefaultConfig()
+	want.URL = "http://localhost:8080/notify"
+	want.BatchSizeBytes = 1024
+	want.FlushInterval = 200 * time.Millisecond
+	want.Encoder = "ndjson"
+	want.Headers = map[string]string{"X-Source": "billing"}
+	want.Auth = AuthConfig{Type: AuthTypeBearer, Token: "secret"}
+
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    Config
+		wantErr error
+	}{
+		{
+			name: "yaml",
+			file: "notifier.yaml",
+			data: `
+url: http://localhost:8080/notify
+batch_size_bytes: 1024
+flush_interval: 200ms
+encoder: ndjson
+headers:
+  X-Source: billing
+auth:
+  type: bearer
+  token: secret
+`,
+			want: want,
+		},
+		{
+			name: "json",
+			file: "notifier.json",
+			data: `{
+  "url": "http://localhost:8080/notify",
+  "batch_size_bytes": 1024,
+  "flush_interval": "200ms",
+  "encoder": "ndjson",
+  "headers": {"X-Source": "billing"},
+  "auth": {"type": "bearer", "token": "secret"}
+}`,
+			want: want,
+		},
+		{
+			name:    "unknown_field",
+			file:    "notifier.yaml",
+			data:    "url: http://localhost:8080/notify\nbatch_size: 10\n",
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "invalid_values",
+			file:    "notifier.yaml",
+			data:    "url: http://localhost:8080/notify\nsenders_count: -1\n",
+			wantErr: errs.ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				got, err := LoadConfig(writeFile(t, tt.file, tt.data))
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if tt.wantErr != nil {
+					return
+				}
+
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("LoadConfig() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestLoadConfig_Missing_File(t *testing.T) {
+	t.Parallel()
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadConfig() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestConfig_applyEnv(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    func(c *Config)
+		wantErr error
+	}{
+		{
+			name: "all_kinds_of_fields",
+			env: map[string]string{
+				"NOTIFIER_URL":            "http://example.com",
+				"NOTIFIER_SENDERS_COUNT":  "3",
+				"NOTIFIER_FLUSH_INTERVAL": "2s",
+				"NOTIFIER_HEADERS":        "X-A=1, X-B=2",
+				"NOTIFIER_AUTH_TYPE":      "basic",
+				"NOTIFIER_AUTH_USERNAME":  "user",
+				"NOTIFIER_SIGNING_SECRET": "s3cr3t",
+
+				"NOTIFIER_REDACTION_FIELDS": "user.email, card",
+			},
+			want: func(c *Config) {
+				c.URL = "http://example.com"
+				c.SendersCount = 3
+				c.FlushInterval = 2 * time.Second
+				c.Headers = map[string]string{"X-A": "1", "X-B": "2"}
+				c.Auth.Type = AuthTypeBasic
+				c.Auth.Username = "user"
+				c.SigningSecret = "s3cr3t"
+				c.Redaction.Fields = []string{"user.email", "card"}
+			},
+		},
+		{
+			name:    "invalid_int",
+			env:     map[string]string{"NOTIFIER_RPS": "many"},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "invalid_duration",
+			env:     map[string]string{"NOTIFIER_HTTP_TIMEOUT": "10"},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "invalid_map",
+			env:     map[string]string{"NOTIFIER_HEADERS": "X-A"},
+			wantErr: errs.ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				got := DefaultConfig()
+				err := got.applyEnv(
+					func(key string) (string, bool) {
+						v, ok := tt.env[key]
+						return v, ok
+					},
+				)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("applyEnv() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if tt.wantErr != nil {
+					return
+				}
+
+				want := DefaultConfig()
+				tt.want(&want)
+
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("applyEnv() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		modify   func(c *Config)
+		wantText []string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:     "missing_url",
+			modify:   func(c *Config) { c.URL = "" },
+			wantText: []string{"url is required"},
+		},
+		{
+			name:     "relative_url",
+			modify:   func(c *Config) { c.URL = "/notify" },
+			wantText: []string{"url must be absolute"},
+		},
+		{
+			name: "all_problems_reported",
+			modify: func(c *Config) {
+				c.BatchSizeBytes = 0
+				c.FlushInterval = -time.Second
+				c.RetryMaxDelay = 0
+			},
+			wantText: []string{
+				"batch_size_bytes must be positive",
+				"flush_interval must be positive",
+				"retry_max_delay must not be less than retry_delay",
+			},
+		},
+		{
+			name:     "negative_retry_after_max",
+			modify:   func(c *Config) { c.RetryAfterMax = -time.Second },
+			wantText: []string{"retry_after_max must not be negative"},
+		},
+		{
+			name:     "unknown_encoder",
+			modify:   func(c *Config) { c.Encoder = "xml" },
+			wantText: []string{"encoder: unknown codec xml"},
+		},
+		{
+			name:     "bearer_without_token",
+			modify:   func(c *Config) { c.Auth.Type = AuthTypeBearer },
+			wantText: []string{"auth.token is required"},
+		},
+		{
+			name:     "unknown_auth",
+			modify:   func(c *Config) { c.Auth.Type = "digest" },
+			wantText: []string{"auth.type must be one of"},
+		},
+		{
+			name:     "unknown_ordering",
+			modify:   func(c *Config) { c.Ordering = "fifo" },
+			wantText: []string{"ordering must be one of"},
+		},
+		{
+			name: "invalid_memory_budget",
+			modify: func(c *Config) {
+				c.MemoryBudgetBytes = -1
+				c.Overflow = "oldest"
+			},
+			wantText: []string{"memory_budget_bytes must not be negative", "overflow must be drop or empty"},
+		},
+		{
+			name: "stream_delivery",
+			modify: func(c *Config) {
+				c.Delivery = DeliveryStream
+				c.StreamMaxAge = c.HTTPTimeout
+				c.SigningSecret = "secret"
+			},
+			wantText: []string{
+				"stream_max_age must be less than http_timeout", "encoder must be ndjson",
+				"signing_secret is not supported",
+			},
+		},
+		{
+			name: "grpc_transport",
+			modify: func(c *Config) {
+				c.Transport = TransportGRPC
+				c.SigningSecret = "secret"
+			},
+			wantText: []string{"signing_secret is not supported with grpc transport"},
+		},
+		{
+			name:     "invalid_template",
+			modify:   func(c *Config) { c.Template = "{{.text" },
+			wantText: []string{"template: "},
+		},
+		{
+			name: "invalid_redaction",
+			modify: func(c *Config) {
+				c.Redaction.Mode = "drop"
+				c.Redaction.Patterns = []string{"("}
+			},
+			wantText: []string{"redaction mode must be hash, summary or empty"},
+		},
+		{
+			name: "invalid_log_sampling",
+			modify: func(c *Config) {
+				c.LogSampleInterval = -time.Second
+				c.LogSampleBurst = 0
+			},
+			wantText: []string{"log_sample_interval must not be negative", "log_sample_burst must be positive"},
+		},
+		{
+			name:     "unknown_transport",
+			modify:   func(c *Config) { c.Transport = "amqp" },
+			wantText: []string{"transport must be grpc or empty"},
+		},
+		{
+			name:     "unknown_input_queue",
+			modify:   func(c *Config) { c.InputQueue = "disruptor" },
+			wantText: []string{"input_queue must be ring or empty"},
+		},
+		{
+			name: "shards_with_ordering",
+			modify: func(c *Config) {
+				c.AggregatorShards = 4
+				c.Ordering = OrderingGlobal
+			},
+			wantText: []string{"aggregator_shards must be 1 with ordering"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				cfg := DefaultConfig()
+				cfg.URL = "http://localhost:8080/notify"
+				tt.modify(&cfg)
+
+				err := cfg.Validate()
+				if (err != nil) != (len(tt.wantText) > 0) {
+					t.Fatalf("Validate() error = %v, want %v", err, tt.wantText)
+				}
+
+				if err == nil {
+					return
+				}
+
+				if !errors.Is(err, errs.ErrValidation) {
+					t.Errorf("Validate() error = %v, want %v", err, errs.ErrValidation)
+				}
+
+				for _, text := range tt.wantText {
+					if !strings.Contains(err.Error(), text) {
+						t.Errorf("Validate() error = %v, want it to contain %q", err, text)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	cfg := DefaultConfig()
+	cfg.URL = server.URL
+	cfg.Encoder = "ndjson"
+	cfg.Headers = map[string]string{"X-Source": "billing"}
+	cfg.Auth = AuthConfig{Type: AuthTypeBasic, Username: "user", Password: "pass"}
+
+	n, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	server.AssertDelivered(t, "hello")
+
+	batch := server.Batches()[0]
+	if diff := cmp.Diff("ndjson", batch.Codec); diff != "" {
+		t.Errorf("Codec mismatch (-want +got):\n%s", diff)
+	}
+
+	wantHeader := map[string]string{
+		"Content-Type":  "application/x-ndjson",
+		"X-Source":      "billing",
+		"Authorization": "Basic dXNlcjpwYXNz",
+	}
+	for k, v := range wantHeader {
+		if diff := cmp.Diff(v, batch.Header.Get(k)); diff != "" {
+			t.Errorf("Header %s mismatch (-want +got):\n%s", k, diff)
+		}
+	}
+}
+
+func TestNewFromConfig_Invalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewFromConfig(DefaultConfig()); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("NewFromConfig() error = %v, want %v", err, errs.ErrValidation)
+	}
+}
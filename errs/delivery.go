@@ -0,0 +1,167 @@
+package errs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MaxBodySnippet limits the response body kept in DeliveryError.
+const MaxBodySnippet = 512
+
+var (
+	// ErrRetryable matches DeliveryError that may succeed if the batch is sent again, throttled ones included
+	ErrRetryable = fmt.Errorf("retryable")
+	// ErrPermanent matches DeliveryError that will fail again, auth failures included
+	ErrPermanent = fmt.Errorf("permanent")
+	// ErrThrottled matches DeliveryError caused by the receiver limiting the rate of requests
+	ErrThrottled = fmt.Errorf("throttled")
+	// ErrPartial matches DeliveryError of messages the receiver rejected in a batch it accepted otherwise
+	ErrPartial = fmt.Errorf("partially rejected")
+)
+
+// Class tells how a caller may react to a failed delivery.
+type Class int
+
+const (
+	// ClassRetryable is a transient failure: network errors, timeouts and 5xx
+	ClassRetryable Class = iota + 1
+	// ClassPermanent is a failure that won't go away by itself, e.g. 400 or 404
+	ClassPermanent
+	// ClassThrottled is 429
+	ClassThrottled
+	// ClassAuth is 401 and 403
+	ClassAuth
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassRetryable:
+		return "retryable"
+	case ClassPermanent:
+		return "permanent"
+	case ClassThrottled:
+		return "throttled"
+	case ClassAuth:
+		return "auth"
+	default:
+		return "unknown"
+	}
+}
+
+// Classify returns Class of a delivery that finished with status or with err if there is no response.
+func Classify(status int, err error) Class {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ClassAuth
+	case status == http.StatusTooManyRequests:
+		return ClassThrottled
+	case status == http.StatusRequestTimeout || status >= 500:
+		return ClassRetryable
+	case status >= 400:
+		return ClassPermanent
+	case errors.Is(err, context.Canceled):
+		return ClassPermanent
+	default:
+		return ClassRetryable
+	}
+}
+
+// DeliveryError describes a batch that was not delivered. It matches ErrRetryable, ErrPermanent, ErrThrottled
+// and ErrUnauthorized with errors.Is according to Class, ErrPartial if Rejected is set, and unwraps to its cause.
+type DeliveryError struct {
+	// StatusCode is 0 if no response was received
+	StatusCode int
+	// Body is the beginning of the response body, at most MaxBodySnippet bytes
+	Body   string
+	Header http.Header
+	// Attempts made before giving up. It's 0 for the error of a single request.
+	Attempts int
+	BatchID  string
+	Class    Class
+	// Rejected are indexes of messages rejected in the batch of the last attempt if the rest were accepted
+	Rejected []int
+	Err      error
+}
+
+// NewDeliveryError makes DeliveryError of a request that finished with resp and err, either of them may be nil.
+// The body of resp is restored after the snippet is read.
+func NewDeliveryError(resp *http.Response, err error) *DeliveryError {
+	e := &DeliveryError{Err: err}
+
+	if resp != nil {
+		e.StatusCode = resp.StatusCode
+		e.Header = resp.Header.Clone()
+		e.Body = snippet(resp)
+	}
+
+	e.Class = Classify(e.StatusCode, err)
+
+	return e
+}
+
+func snippet(resp *http.Response) string {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return ""
+	}
+
+	head, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySnippet))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToValidUTF8(string(head), "")
+}
+
+func (e *DeliveryError) Error() string {
+	var b strings.Builder
+
+	b.WriteString("delivery failed")
+	if e.BatchID != "" {
+		b.WriteString(": batch " + e.BatchID)
+	}
+	if e.StatusCode != 0 {
+		b.WriteString(fmt.Sprintf(": status %d", e.StatusCode))
+	}
+	if e.Attempts > 0 {
+		b.WriteString(fmt.Sprintf(": %d attempts", e.Attempts))
+	}
+	if len(e.Rejected) > 0 {
+		b.WriteString(fmt.Sprintf(": %d msgs rejected", len(e.Rejected)))
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+
+	return b.String()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DeliveryError) Is(target error) bool {
+	switch target {
+	case ErrRetryable:
+		return e.Class == ClassRetryable || e.Class == ClassThrottled
+	case ErrPermanent:
+		return e.Class == ClassPermanent || e.Class == ClassAuth
+	case ErrThrottled:
+		return e.Class == ClassThrottled
+	case ErrUnauthorized:
+		return e.Class == ClassAuth
+	case ErrPartial:
+		return len(e.Rejected) > 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,146 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   Class
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, want: ClassAuth},
+		{name: "forbidden", status: http.StatusForbidden, want: ClassAuth},
+		{name: "too_many_requests", status: http.StatusTooManyRequests, want: ClassThrottled},
+		{name: "request_timeout", status: http.StatusRequestTimeout, want: ClassRetryable},
+		{name: "service_unavailable", status: http.StatusServiceUnavailable, want: ClassRetryable},
+		{name: "bad_request", status: http.StatusBadRequest, want: ClassPermanent},
+		{name: "not_found", status: http.StatusNotFound, want: ClassPermanent},
+		{name: "network_error", err: syscall.ECONNRESET, want: ClassRetryable},
+		{name: "canceled", err: context.Canceled, want: ClassPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				if diff := cmp.Diff(tt.want, Classify(tt.status, tt.err)); diff != "" {
+					t.Errorf("Classify() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestDeliveryError_Is(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		class  Class
+		is     []error
+		isNot  []error
+		status int
+	}{
+		{
+			name:  "retryable",
+			class: ClassRetryable,
+			is:    []error{ErrRetryable, ErrInternal},
+			isNot: []error{ErrPermanent, ErrThrottled, ErrUnauthorized},
+		},
+		{
+			name:  "throttled_is_retryable",
+			class: ClassThrottled,
+			is:    []error{ErrRetryable, ErrThrottled},
+			isNot: []error{ErrPermanent, ErrUnauthorized},
+		},
+		{
+			name:  "permanent",
+			class: ClassPermanent,
+			is:    []error{ErrPermanent},
+			isNot: []error{ErrRetryable, ErrThrottled, ErrUnauthorized},
+		},
+		{
+			name:  "auth_is_permanent",
+			class: ClassAuth,
+			is:    []error{ErrPermanent, ErrUnauthorized},
+			isNot: []error{ErrRetryable, ErrThrottled},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				var err error = &DeliveryError{Class: tt.class, Err: Wrap(ErrInternal, "/notify")}
+
+				// wrapped by callers
+				err = Wrap(err, "send")
+
+				for _, target := range tt.is {
+					if !errors.Is(err, target) {
+						t.Errorf("errors.Is(%v, %v) = false", err, target)
+					}
+				}
+
+				for _, target := range tt.isNot {
+					if errors.Is(err, target) {
+						t.Errorf("errors.Is(%v, %v) = true", err, target)
+					}
+				}
+
+				var derr *DeliveryError
+				if !errors.As(err, &derr) || derr.Class != tt.class {
+					t.Errorf("errors.As() = %v, want DeliveryError of class %v", derr, tt.class)
+				}
+			},
+		)
+	}
+}
+
+func TestNewDeliveryError(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat("a", MaxBodySnippet) + "tail"
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": []string{"1"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+
+	err := NewDeliveryError(resp, nil)
+
+	want := &DeliveryError{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       strings.Repeat("a", MaxBodySnippet),
+		Header:     http.Header{"Retry-After": []string{"1"}},
+		Class:      ClassThrottled,
+	}
+	if diff := cmp.Diff(want, err); diff != "" {
+		t.Errorf("NewDeliveryError() mismatch (-want +got):\n%s", diff)
+	}
+
+	// body is still readable by others
+	rest, _ := io.ReadAll(resp.Body)
+	if diff := cmp.Diff(body, string(rest)); diff != "" {
+		t.Errorf("restored body mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("delivery failed: status 429", err.Error()); diff != "" {
+		t.Errorf("Error() mismatch (-want +got):\n%s", diff)
+	}
+}
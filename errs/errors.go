@@ -8,6 +8,8 @@ var (
 	ErrValidation = fmt.Errorf("validation error")
 	ErrInternal   = fmt.Errorf("internal error")
 	ErrNotFound   = fmt.Errorf("not found")
+	// ErrUnauthorized means a request is not authenticated, e.g. its signature is invalid
+	ErrUnauthorized = fmt.Errorf("unauthorized")
 )
 
 func Wrap(err error, msg string) error {
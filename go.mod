@@ -6,6 +6,7 @@ require (
 	github.com/go-resty/resty/v2 v2.17.0
 	github.com/google/go-cmp v0.7.0
 	golang.org/x/time v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/net v0.43.0 // indirect
@@ -0,0 +1,3 @@
+// Package interop tests the grpc package against grpc-go. It's a separate module, so the notifier module
+// doesn't depend on grpc-go. Run its tests from this directory with go test ./...
+package interop
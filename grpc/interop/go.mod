@@ -0,0 +1,22 @@
+module notifier/grpc/interop
+
+go 1.25.5
+
+require (
+	github.com/bufbuild/protocompile v0.14.1
+	github.com/google/go-cmp v0.7.0
+	google.golang.org/grpc v1.84.0
+	google.golang.org/protobuf v1.36.11
+	notifier v0.0.0
+)
+
+require (
+	github.com/go-resty/resty/v2 v2.17.0 // indirect
+	golang.org/x/net v0.57.0 // indirect
+	golang.org/x/sync v0.22.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260706201446-f0a921348800 // indirect
+)
+
+replace notifier => ../..
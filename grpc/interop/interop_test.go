@@ -0,0 +1,252 @@
+package interop
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/google/go-cmp/cmp"
+	ggrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	gstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"notifier/client"
+	"notifier/errs"
+	"notifier/grpc"
+	"notifier/retry"
+)
+
+// descriptors of notifier.proto, compiled from the file at test time, so the tests follow it without
+// generated code
+type descriptors struct {
+	service  protoreflect.ServiceDescriptor
+	message  protoreflect.MessageDescriptor
+	response protoreflect.MessageDescriptor
+}
+
+func compileProto(t *testing.T) descriptors {
+	t.Helper()
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{".."}}),
+	}
+	files, err := compiler.Compile(context.Background(), "notifier.proto")
+	if err != nil {
+		t.Fatalf("compile notifier.proto: %v", err)
+	}
+
+	file := files[0]
+	return descriptors{
+		service:  file.Services().ByName("Notifier"),
+		message:  file.Messages().ByName("Message"),
+		response: file.Messages().ByName("NotifyResponse"),
+	}
+}
+
+// call is a Notify call received by the grpc-go server.
+type call struct {
+	Bodies   []string
+	BatchIDs []string
+	Auth     []string
+}
+
+// newGoServer serves Notify of notifier.proto with grpc-go. Messages starting with "bad" are rejected,
+// a call with a message "fail" fails with UNAVAILABLE.
+func newGoServer(t *testing.T, desc descriptors) (string, func() []call) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		calls []call
+	)
+
+	method := desc.service.Methods().ByName("Notify")
+	server := ggrpc.NewServer()
+	server.RegisterService(
+		&ggrpc.ServiceDesc{
+			ServiceName: string(desc.service.FullName()),
+			HandlerType: (*any)(nil),
+			Streams: []ggrpc.StreamDesc{
+				{
+					StreamName:    string(method.Name()),
+					ClientStreams: true,
+					Handler: func(_ any, stream ggrpc.ServerStream) error {
+						md, _ := metadata.FromIncomingContext(stream.Context())
+						c := call{Auth: md.Get("authorization")}
+
+						response := dynamicpb.NewMessage(desc.response)
+						rejected := response.Mutable(desc.response.Fields().ByName("rejected")).List()
+
+						for i := 0; ; i++ {
+							msg := dynamicpb.NewMessage(desc.message)
+							err := stream.RecvMsg(msg)
+							if errors.Is(err, io.EOF) {
+								break
+							}
+							if err != nil {
+								return err
+							}
+
+							body := msg.Get(desc.message.Fields().ByName("body")).String()
+							c.Bodies = append(c.Bodies, body)
+							c.BatchIDs = append(c.BatchIDs, msg.Get(desc.message.Fields().ByName("batch_id")).String())
+
+							if strings.HasPrefix(body, "bad") {
+								rejected.Append(protoreflect.ValueOfInt32(int32(i)))
+							}
+						}
+
+						mu.Lock()
+						calls = append(calls, c)
+						mu.Unlock()
+
+						if len(c.Bodies) > 0 && c.Bodies[0] == "fail" {
+							return gstatus.Error(codes.Unavailable, "try later")
+						}
+
+						return stream.SendMsg(response)
+					},
+				},
+			},
+		}, nil,
+	)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	return "http://" + lis.Addr().String(), func() []call {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]call(nil), calls...)
+	}
+}
+
+func TestTransport_Send_To_GRPC_Go_Server(t *testing.T) {
+	t.Parallel()
+
+	desc := compileProto(t)
+	url, calls := newGoServer(t, desc)
+
+	transport := grpc.NewTransport(
+		url, grpc.Options{Header: http.Header{"Authorization": []string{"Bearer token"}}, Timeout: 5 * time.Second},
+	)
+	ctx := client.WithBatchID(context.Background(), "b1")
+
+	if err := transport.Send(ctx, []string{"a", "b"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	var derr *errs.DeliveryError
+	err := transport.Send(ctx, []string{"ok", "bad"})
+	if !errors.As(err, &derr) {
+		t.Fatalf("Send() error = %v, want *errs.DeliveryError", err)
+	}
+	if diff := cmp.Diff([]int{1}, derr.Rejected); diff != "" {
+		t.Errorf("rejected mismatch (-want +got):\n%s", diff)
+	}
+
+	var rerr *retry.Error
+	err = transport.Send(ctx, []string{"fail"})
+	if !errors.As(err, &rerr) || rerr.Response == nil {
+		t.Fatalf("Send() error = %v, want *retry.Error with response", err)
+	}
+	if diff := cmp.Diff(http.StatusServiceUnavailable, rerr.Response.StatusCode); diff != "" {
+		t.Errorf("status mismatch (-want +got):\n%s", diff)
+	}
+
+	want := []call{
+		{Bodies: []string{"a", "b"}, BatchIDs: []string{"b1", "b1"}, Auth: []string{"Bearer token"}},
+		{Bodies: []string{"ok", "bad"}, BatchIDs: []string{"b1", "b1"}, Auth: []string{"Bearer token"}},
+		{Bodies: []string{"fail"}, BatchIDs: []string{"b1"}, Auth: []string{"Bearer token"}},
+	}
+	if diff := cmp.Diff(want, calls()); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewHandler_Serves_GRPC_Go_Client(t *testing.T) {
+	t.Parallel()
+
+	desc := compileProto(t)
+
+	server := httptest.NewUnstartedServer(
+		grpc.NewHandler(
+			func(_ context.Context, _ http.Header, msgs []string) ([]int, error) {
+				if msgs[0] == "fail" {
+					return nil, &grpc.Status{Code: grpc.ResourceExhausted, Message: "slow down"}
+				}
+
+				return []int{len(msgs) - 1}, nil
+			},
+		),
+	)
+	server.Config.Protocols = &http.Protocols{}
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	conn, err := ggrpc.NewClient(
+		strings.TrimPrefix(server.URL, "http://"), ggrpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	notify := func(bodies ...string) (*dynamicpb.Message, error) {
+		stream, err := conn.NewStream(
+			context.Background(), &ggrpc.StreamDesc{ClientStreams: true}, grpc.Path,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, body := range bodies {
+			msg := dynamicpb.NewMessage(desc.message)
+			msg.Set(desc.message.Fields().ByName("body"), protoreflect.ValueOfString(body))
+			if err = stream.SendMsg(msg); err != nil {
+				return nil, err
+			}
+		}
+		if err = stream.CloseSend(); err != nil {
+			return nil, err
+		}
+
+		response := dynamicpb.NewMessage(desc.response)
+		return response, stream.RecvMsg(response)
+	}
+
+	response, err := notify("a", "b", "c")
+	if err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	rejected := response.Get(desc.response.Fields().ByName("rejected")).List()
+	if rejected.Len() != 1 || rejected.Get(0).Int() != 2 {
+		t.Errorf("rejected = %v, want [2]", rejected)
+	}
+
+	_, err = notify("fail")
+	if diff := cmp.Diff(codes.ResourceExhausted, gstatus.Code(err)); diff != "" {
+		t.Errorf("code mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("slow down", gstatus.Convert(err).Message()); diff != "" {
+		t.Errorf("message mismatch (-want +got):\n%s", diff)
+	}
+}
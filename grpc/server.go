@@ -0,0 +1,80 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NotifyFunc receives messages of a Notify call with its metadata. rejected are indexes of messages that are
+// not accepted, they are sent again. The call fails with the code of *Status error, Internal for other errors.
+type NotifyFunc func(ctx context.Context, md http.Header, msgs []string) (rejected []int, err error)
+
+// NewHandler returns http.Handler that serves Notify of notifier.proto with notify. It must be served with
+// HTTP/2, e.g. by http.Server with Protocols that allow unencrypted HTTP/2.
+func NewHandler(notify NotifyFunc) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != Path {
+				writeStatus(w, &Status{Code: Unimplemented, Message: "unknown method " + r.URL.Path})
+				return
+			}
+
+			if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+				http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			var msgs []string
+			for {
+				frame, err := readFrame(r.Body)
+				if err == io.EOF {
+					break
+				}
+
+				var body string
+				if err == nil {
+					body, _, err = decodeMessage(frame)
+				}
+				if err != nil {
+					writeStatus(w, &Status{Code: InvalidArgument, Message: err.Error()})
+					return
+				}
+
+				msgs = append(msgs, body)
+			}
+
+			rejected, err := notify(r.Context(), r.Header, msgs)
+			if err != nil {
+				var st *Status
+				if !errors.As(err, &st) {
+					st = &Status{Code: Internal, Message: err.Error()}
+				}
+
+				writeStatus(w, st)
+				return
+			}
+
+			w.Header().Set("Content-Type", ContentType)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(appendNotifyResponse(nil, rejected))
+
+			w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(OK)))
+		},
+	)
+}
+
+// writeStatus answers with a trailers-only response of a failed call.
+func writeStatus(w http.ResponseWriter, st *Status) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(st.Code)))
+	w.Header().Set("Grpc-Message", percentEncode(st.Message))
+	if st.RetryPushback > 0 {
+		w.Header().Set("Grpc-Retry-Pushback-Ms", strconv.FormatInt(st.RetryPushback.Milliseconds(), 10))
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
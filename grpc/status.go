@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Code is gRPC status code.
+type Code uint32
+
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	DeadlineExceeded   Code = 4
+	NotFound           Code = 5
+	AlreadyExists      Code = 6
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Aborted            Code = 10
+	OutOfRange         Code = 11
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+	DataLoss           Code = 15
+	Unauthenticated    Code = 16
+)
+
+var codeNames = [...]string{
+	"OK", "Canceled", "Unknown", "InvalidArgument", "DeadlineExceeded", "NotFound", "AlreadyExists",
+	"PermissionDenied", "ResourceExhausted", "FailedPrecondition", "Aborted", "OutOfRange", "Unimplemented",
+	"Internal", "Unavailable", "DataLoss", "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+
+	return "Code(" + strconv.Itoa(int(c)) + ")"
+}
+
+// httpStatuses are the closest HTTP statuses of codes, the same grpc-gateway uses
+var httpStatuses = map[Code]int{
+	OK:                 http.StatusOK,
+	Canceled:           499,
+	Unknown:            http.StatusInternalServerError,
+	InvalidArgument:    http.StatusBadRequest,
+	DeadlineExceeded:   http.StatusGatewayTimeout,
+	NotFound:           http.StatusNotFound,
+	AlreadyExists:      http.StatusConflict,
+	PermissionDenied:   http.StatusForbidden,
+	ResourceExhausted:  http.StatusTooManyRequests,
+	FailedPrecondition: http.StatusBadRequest,
+	Aborted:            http.StatusConflict,
+	OutOfRange:         http.StatusBadRequest,
+	Unimplemented:      http.StatusNotImplemented,
+	Internal:           http.StatusInternalServerError,
+	Unavailable:        http.StatusServiceUnavailable,
+	DataLoss:           http.StatusInternalServerError,
+	Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus returns the closest HTTP status of c, so retry.Policy classifies gRPC failures like HTTP ones.
+func HTTPStatus(c Code) int {
+	if status, ok := httpStatuses[c]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// CodeFromHTTPStatus is the reverse of HTTPStatus. Statuses without a code of their own are Unknown.
+func CodeFromHTTPStatus(status int) Code {
+	switch {
+	case status >= 200 && status <= 399:
+		return OK
+	case status == http.StatusRequestTimeout:
+		return DeadlineExceeded
+	case status == http.StatusBadGateway:
+		return Unavailable
+	}
+
+	for _, c := range []Code{
+		Canceled, InvalidArgument, DeadlineExceeded, NotFound, Aborted, PermissionDenied, ResourceExhausted,
+		Unimplemented, Internal, Unavailable, Unauthenticated,
+	} {
+		if httpStatuses[c] == status {
+			return c
+		}
+	}
+
+	return Unknown
+}
+
+// Status is a failed call. It's returned by NotifyFunc to answer with a code other than Internal.
+type Status struct {
+	Code    Code
+	Message string
+	// RetryPushback asks the client to wait before the next attempt, it's sent as grpc-retry-pushback-ms.
+	// Transport turns it into Retry-After.
+	RetryPushback time.Duration
+}
+
+func (s *Status) Error() string {
+	return "rpc error: code = " + s.Code.String() + " desc = " + s.Message
+}
+
+// percentEncode encodes grpc-message header value.
+func percentEncode(msg string) string {
+	const upperHex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(upperHex[c>>4])
+		b.WriteByte(upperHex[c&0xF])
+	}
+
+	return b.String()
+}
+
+// percentDecode decodes grpc-message header value. Invalid encoding is returned as is.
+func percentDecode(msg string) string {
+	decoded, err := url.PathUnescape(msg)
+	if err != nil {
+		return msg
+	}
+
+	return decoded
+}
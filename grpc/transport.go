@@ -0,0 +1,191 @@
+// Package grpc delivers batches as client-streaming Notify calls of notifier.proto. It speaks gRPC over
+// HTTP/2 of net/http with hand-written protobuf encoding, so it needs neither grpc-go nor generated code.
+// Interoperability with grpc-go clients and servers is tested by the grpc/interop module.
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"notifier/client"
+	"notifier/errs"
+	"notifier/retry"
+)
+
+const (
+	// Path is the method of Notify calls
+	Path = "/notifier.v1.Notifier/Notify"
+	// ContentType of gRPC calls with protobuf messages
+	ContentType = "application/grpc+proto"
+)
+
+// Options of Transport.
+type Options struct {
+	// Header is sent as metadata of every call, e.g. Authorization
+	Header http.Header
+	// Timeout limits a call and is sent to the server as grpc-timeout. Zero means no limit.
+	Timeout time.Duration
+	// Client sends calls. If it's nil, a client with HTTP/2 is used: cleartext for http:// targets
+	// and TLS for https:// ones.
+	Client *http.Client
+}
+
+// Transport is client.Transport that sends every batch as a single Notify call. Every message is a separate
+// frame of the client stream. Failed calls are *retry.Error with the closest HTTP status of their gRPC code.
+type Transport struct {
+	url     string
+	header  http.Header
+	timeout time.Duration
+	client  *http.Client
+}
+
+var _ client.Transport = (*Transport)(nil)
+
+// NewTransport returns Transport that calls Notify of the server at target, e.g. http://localhost:9090.
+func NewTransport(target string, opts Options) *Transport {
+	c := opts.Client
+	if c == nil {
+		protocols := &http.Protocols{}
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+
+		c = &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	}
+
+	return &Transport{
+		url:     strings.TrimSuffix(target, "/") + Path,
+		header:  opts.Header,
+		timeout: opts.Timeout,
+		client:  c,
+	}
+}
+
+func (t *Transport) Send(ctx context.Context, msgs []string) error {
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	batchID := client.BatchID(ctx)
+
+	var body []byte
+	for _, msg := range msgs {
+		body = appendMessage(body, msg, batchID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return errs.Wrap(errs.ErrValidation, err.Error())
+	}
+
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Te", "trailers")
+	if batchID != "" {
+		req.Header.Set(client.HeaderBatchID, batchID)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(max(time.Until(deadline).Milliseconds(), 1), 10)+"m")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return errs.NewDeliveryError(nil, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// trailers are read with the body
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errs.NewDeliveryError(nil, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// the call didn't reach a gRPC server, e.g. a proxy answered
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		err = errs.Wrap(errs.ErrInternal, "unexpected HTTP status")
+		return &retry.Error{Response: resp, Err: errs.NewDeliveryError(resp, err)}
+	}
+
+	if st := status(resp); st.Code != OK {
+		failed := failedResponse(req, resp, st)
+		return &retry.Error{Response: failed, Err: errs.NewDeliveryError(failed, st)}
+	}
+
+	return rejected(resp, data, len(msgs))
+}
+
+// status returns the status of the call from trailers or headers of a trailers-only response.
+func status(resp *http.Response) *Status {
+	value := resp.Trailer.Get("Grpc-Status")
+	header := resp.Trailer
+	if value == "" {
+		value, header = resp.Header.Get("Grpc-Status"), resp.Header
+	}
+
+	code, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return &Status{Code: Unknown, Message: "invalid grpc-status " + strconv.Quote(value)}
+	}
+
+	st := &Status{Code: Code(code), Message: percentDecode(header.Get("Grpc-Message"))}
+	if ms, err := strconv.ParseInt(header.Get("Grpc-Retry-Pushback-Ms"), 10, 64); err == nil && ms >= 0 {
+		st.RetryPushback = time.Duration(ms) * time.Millisecond
+	}
+
+	return st
+}
+
+// failedResponse describes a failed call as HTTP response, so it's classified by retry.Policy.
+func failedResponse(req *http.Request, resp *http.Response, st *Status) *http.Response {
+	header := resp.Header.Clone()
+	if st.RetryPushback > 0 {
+		// Retry-After has seconds precision
+		header.Set("Retry-After", strconv.FormatInt(int64((st.RetryPushback+time.Second-1)/time.Second), 10))
+	}
+
+	return &http.Response{
+		Status:     st.Code.String(),
+		StatusCode: HTTPStatus(st.Code),
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(st.Message)),
+		Request:    req,
+	}
+}
+
+// rejected returns *errs.DeliveryError with indexes of messages the server rejected, or nil if all are accepted.
+func rejected(resp *http.Response, data []byte, n int) error {
+	frame, err := readFrame(bytes.NewReader(data))
+	if err == io.EOF {
+		// a response without the message accepts all messages
+		return nil
+	}
+
+	var indexes []int
+	if err == nil {
+		indexes, err = decodeNotifyResponse(frame)
+	}
+	if err == nil {
+		err = client.CheckRejected(indexes, n)
+	}
+	if err != nil {
+		return errs.NewDeliveryError(resp, errs.Wrap(errs.ErrValidation, "parse response: "+err.Error()))
+	}
+
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	derr := errs.NewDeliveryError(resp, nil)
+	derr.Rejected = indexes
+
+	return derr
+}
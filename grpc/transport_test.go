@@ -0,0 +1,258 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/client"
+	"notifier/errs"
+	"notifier/retry"
+)
+
+// newServer serves handler over unencrypted HTTP/2 until the test finishes.
+func newServer(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.Protocols = &http.Protocols{}
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestTransport_Send(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		rejected []int
+		err      error
+		// handler replaces the gRPC server
+		handler http.HandlerFunc
+
+		wantStatus     int
+		wantRetryAfter string
+		wantRejected   []int
+		wantErrText    string
+	}{
+		{
+			name: "accepted",
+		},
+		{
+			name:         "rejected",
+			rejected:     []int{1},
+			wantStatus:   http.StatusOK,
+			wantRejected: []int{1},
+		},
+		{
+			name: "status",
+			err: &Status{
+				Code: ResourceExhausted, Message: "slow down, 100%", RetryPushback: 1500 * time.Millisecond,
+			},
+			wantStatus:     http.StatusTooManyRequests,
+			wantRetryAfter: "2",
+			wantErrText:    "code = ResourceExhausted desc = slow down, 100%",
+		},
+		{
+			name:        "error",
+			err:         errors.New("boom"),
+			wantStatus:  http.StatusInternalServerError,
+			wantErrText: "code = Internal desc = boom",
+		},
+		{
+			name: "not_grpc",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+			},
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				var (
+					gotMsgs []string
+					gotMD   http.Header
+				)
+				var handler http.Handler = NewHandler(
+					func(_ context.Context, md http.Header, msgs []string) ([]int, error) {
+						gotMsgs, gotMD = msgs, md
+						return tt.rejected, tt.err
+					},
+				)
+				if tt.handler != nil {
+					handler = tt.handler
+				}
+				server := newServer(t, handler)
+
+				transport := NewTransport(
+					server.URL+"/", Options{Header: http.Header{"X-Source": []string{"test"}}, Timeout: time.Second},
+				)
+				msgs := []string{"msg1", `{"id":"2"}`, ""}
+				err := transport.Send(client.WithBatchID(context.Background(), "batch1"), msgs)
+
+				if tt.handler == nil {
+					if diff := cmp.Diff(msgs, gotMsgs); diff != "" {
+						t.Errorf("messages mismatch (-want +got):\n%s", diff)
+					}
+					if diff := cmp.Diff("test", gotMD.Get("X-Source")); diff != "" {
+						t.Errorf("metadata mismatch (-want +got):\n%s", diff)
+					}
+					if diff := cmp.Diff("batch1", gotMD.Get(client.HeaderBatchID)); diff != "" {
+						t.Errorf("batch ID mismatch (-want +got):\n%s", diff)
+					}
+					if gotMD.Get("Grpc-Timeout") == "" {
+						t.Error("grpc-timeout is not sent")
+					}
+				}
+
+				if tt.wantStatus == 0 {
+					if err != nil {
+						t.Fatalf("Send() error = %v", err)
+					}
+					return
+				}
+
+				var derr *errs.DeliveryError
+				if !errors.As(err, &derr) {
+					t.Fatalf("Send() error = %v, want *errs.DeliveryError", err)
+				}
+				if diff := cmp.Diff(tt.wantRejected, derr.Rejected); diff != "" {
+					t.Errorf("rejected mismatch (-want +got):\n%s", diff)
+				}
+				if tt.wantRejected != nil {
+					return
+				}
+
+				resp, _ := retry.Result(err)
+				if resp == nil {
+					t.Fatalf("Send() error = %v, want *retry.Error with response", err)
+				}
+				if diff := cmp.Diff(tt.wantStatus, resp.StatusCode); diff != "" {
+					t.Errorf("status mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantRetryAfter, resp.Header.Get("Retry-After")); diff != "" {
+					t.Errorf("Retry-After mismatch (-want +got):\n%s", diff)
+				}
+				if tt.wantErrText != "" {
+					var st *Status
+					if !errors.As(err, &st) {
+						t.Fatalf("Send() error = %v, want *Status", err)
+					}
+					if diff := cmp.Diff(tt.wantErrText, st.Error()[len("rpc error: "):]); diff != "" {
+						t.Errorf("status mismatch (-want +got):\n%s", diff)
+					}
+				}
+			},
+		)
+	}
+}
+
+func TestNewHandler_Unknown_Method(t *testing.T) {
+	t.Parallel()
+
+	server := newServer(t, NewHandler(func(context.Context, http.Header, []string) ([]int, error) { return nil, nil }))
+
+	transport := NewTransport(server.URL+"/other", Options{})
+	err := transport.Send(context.Background(), []string{"msg"})
+
+	resp, _ := retry.Result(err)
+	if resp == nil {
+		t.Fatalf("Send() error = %v, want *retry.Error with response", err)
+	}
+	if diff := cmp.Diff(http.StatusNotImplemented, resp.StatusCode); diff != "" {
+		t.Errorf("status mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCodeFromHTTPStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		status int
+		want   Code
+	}{
+		{status: http.StatusOK, want: OK},
+		{status: http.StatusBadRequest, want: InvalidArgument},
+		{status: http.StatusRequestTimeout, want: DeadlineExceeded},
+		{status: http.StatusTooManyRequests, want: ResourceExhausted},
+		{status: http.StatusBadGateway, want: Unavailable},
+		{status: http.StatusServiceUnavailable, want: Unavailable},
+		{status: http.StatusTeapot, want: Unknown},
+	}
+
+	for _, tt := range tests {
+		got := CodeFromHTTPStatus(tt.status)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("CodeFromHTTPStatus(%d) mismatch (-want +got):\n%s", tt.status, diff)
+		}
+		if tt.want != Unknown && tt.status != http.StatusRequestTimeout && tt.status != http.StatusBadGateway {
+			if diff := cmp.Diff(tt.status, HTTPStatus(got)); diff != "" {
+				t.Errorf("HTTPStatus(%v) mismatch (-want +got):\n%s", got, diff)
+			}
+		}
+	}
+}
+
+func TestWire(t *testing.T) {
+	t.Parallel()
+
+	var data []byte
+	data = appendMessage(data, "msg1 ✓", "batch1")
+	data = appendMessage(data, "", "")
+	data = appendNotifyResponse(data, []int{0, 300})
+
+	r := bytes.NewReader(data)
+
+	type message struct{ Body, BatchID string }
+	var got []message
+	for range 2 {
+		frame, err := readFrame(r)
+		if err != nil {
+			t.Fatalf("readFrame() error = %v", err)
+		}
+
+		body, batchID, err := decodeMessage(frame)
+		if err != nil {
+			t.Fatalf("decodeMessage() error = %v", err)
+		}
+		got = append(got, message{body, batchID})
+	}
+	if diff := cmp.Diff([]message{{"msg1 ✓", "batch1"}, {"", ""}}, got); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+
+	frame, err := readFrame(r)
+	if err != nil {
+		t.Fatalf("readFrame() error = %v", err)
+	}
+	rejected, err := decodeNotifyResponse(frame)
+	if err != nil {
+		t.Fatalf("decodeNotifyResponse() error = %v", err)
+	}
+	if diff := cmp.Diff([]int{0, 300}, rejected); diff != "" {
+		t.Errorf("rejected mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err = readFrame(r); !errors.Is(err, io.EOF) {
+		t.Errorf("readFrame() error = %v, want %v", err, io.EOF)
+	}
+
+	msg := "100% done\n✓"
+	if diff := cmp.Diff(msg, percentDecode(percentEncode(msg))); diff != "" {
+		t.Errorf("percent encoding mismatch (-want +got):\n%s", diff)
+	}
+}
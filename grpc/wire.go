@@ -0,0 +1,202 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+)
+
+const (
+	// frameHeaderSize is the compression flag and the big endian length of a frame
+	frameHeaderSize = 5
+	// maxFrameSize is the default limit of gRPC servers
+	maxFrameSize = 4 << 20
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+
+	// protobuf tags are field number << 3 | wire type
+	tagMessageBody    = 1<<3 | wireBytes
+	tagMessageBatchID = 2<<3 | wireBytes
+	tagRejectedPacked = 1<<3 | wireBytes
+	tagRejectedVarint = 1<<3 | wireVarint
+)
+
+var (
+	errFrameTooLarge = errors.New("frame is larger than 4 MB")
+	errCompressed    = errors.New("compressed frames are not supported")
+	errMalformed     = errors.New("malformed protobuf message")
+)
+
+// appendMessage appends Message of notifier.proto as a frame.
+func appendMessage(dst []byte, body, batchID string) []byte {
+	size := 1 + varintSize(uint64(len(body))) + len(body)
+	if batchID != "" {
+		size += 1 + varintSize(uint64(len(batchID))) + len(batchID)
+	}
+
+	dst = appendFrameHeader(dst, size)
+	dst = appendString(dst, tagMessageBody, body)
+	if batchID != "" {
+		dst = appendString(dst, tagMessageBatchID, batchID)
+	}
+
+	return dst
+}
+
+// appendNotifyResponse appends NotifyResponse of notifier.proto as a frame. Rejected indexes are packed.
+func appendNotifyResponse(dst []byte, rejected []int) []byte {
+	if len(rejected) == 0 {
+		return appendFrameHeader(dst, 0)
+	}
+
+	packed := 0
+	for _, i := range rejected {
+		packed += varintSize(uint64(int64(i)))
+	}
+
+	dst = appendFrameHeader(dst, 1+varintSize(uint64(packed))+packed)
+	dst = append(dst, tagRejectedPacked)
+	dst = binary.AppendUvarint(dst, uint64(packed))
+	for _, i := range rejected {
+		// int32 is encoded as sign extended 64 bit value
+		dst = binary.AppendUvarint(dst, uint64(int64(i)))
+	}
+
+	return dst
+}
+
+func appendFrameHeader(dst []byte, size int) []byte {
+	dst = append(dst, 0)
+	return binary.BigEndian.AppendUint32(dst, uint32(size))
+}
+
+func appendString(dst []byte, tag byte, s string) []byte {
+	dst = append(dst, tag)
+	dst = binary.AppendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+func varintSize(v uint64) int {
+	return 1 + (bits.Len64(v|1)-1)/7
+}
+
+// readFrame reads the next frame of r. It returns io.EOF if r ends between frames.
+func readFrame(r io.Reader) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	if header[0] != 0 {
+		return nil, errCompressed
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return frame, nil
+}
+
+// decodeMessage decodes Message of notifier.proto. Unknown fields are skipped.
+func decodeMessage(b []byte) (body, batchID string, err error) {
+	err = decodeFields(
+		b, func(tag uint64, value []byte, _ uint64) error {
+			switch tag {
+			case tagMessageBody:
+				body = string(value)
+			case tagMessageBatchID:
+				batchID = string(value)
+			}
+
+			return nil
+		},
+	)
+
+	return body, batchID, err
+}
+
+// decodeNotifyResponse decodes NotifyResponse of notifier.proto. Both packed and unpacked indexes are accepted.
+func decodeNotifyResponse(b []byte) ([]int, error) {
+	var rejected []int
+
+	err := decodeFields(
+		b, func(tag uint64, value []byte, v uint64) error {
+			switch tag {
+			case tagRejectedVarint:
+				rejected = append(rejected, int(int32(v)))
+			case tagRejectedPacked:
+				for len(value) > 0 {
+					i, n := binary.Uvarint(value)
+					if n <= 0 {
+						return errMalformed
+					}
+
+					rejected = append(rejected, int(int32(i)))
+					value = value[n:]
+				}
+			}
+
+			return nil
+		},
+	)
+
+	return rejected, err
+}
+
+// decodeFields calls field for every field of protobuf message b. value is the content of length delimited
+// fields, v is the value of varint ones.
+func decodeFields(b []byte, field func(tag uint64, value []byte, v uint64) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errMalformed
+		}
+		b = b[n:]
+
+		var (
+			value []byte
+			v     uint64
+		)
+
+		switch tag & 7 {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errMalformed
+			}
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		case wireBytes:
+			size, m := binary.Uvarint(b)
+			if m <= 0 || size > uint64(len(b)-m) {
+				return errMalformed
+			}
+			value, n = b[m:m+int(size)], m+int(size)
+		default:
+			return errMalformed
+		}
+
+		if n > len(b) {
+			return errMalformed
+		}
+		b = b[n:]
+
+		if err := field(tag, value, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,10 @@
 package internal
 
 import (
+	"sync/atomic"
 	"time"
 
+	"notifier/clock"
 	"notifier/log"
 )
 
@@ -12,19 +14,73 @@ const (
 	FlushReasonShutdown = "shutdown"
 
 	maxBatchSizeBytesTag = "max_batch_size_b"
+
+	// ringDrainLimit is the number of messages handled from the ring between checks of settings and the timer
+	ringDrainLimit = 1024
 )
 
 type Aggregator struct {
 	// input channel with messages
 	inputChan <-chan string
-	// output channel with batched messages
+	// ring is an alternative to inputChan, Aggregator reads either of them
+	ring *Ring
+	// output channel with batched messages. It's shared by shards.
 	outputChan chan []string
+	// running is the number of shards sharing outputChan that have not finished yet
+	running *atomic.Int64
+	// budget is released for messages the Aggregator drops. It may be nil.
+	budget *Budget
 
 	// if batch cannot be flushed by overflow condition
 	// (number of incoming events too low) then we flush periodically by timer
 	flushInterval time.Duration
 
 	batch *batch
+
+	// settings requested by Reconfigure that were not yet applied by Handle
+	reconfigured chan aggregatorSettings
+
+	// clock drives the flush timer and batch age. Real clock is used if it's nil.
+	clock clock.Clock
+	// log has tags of the Notifier. Default() is used if it's nil.
+	log log.Logger
+	// batchStartedAt is the time the first message was added to the current batch
+	batchStartedAt time.Time
+}
+
+type aggregatorSettings struct {
+	maxBatchSizeBytes int
+	flushInterval     time.Duration
+	// limitBatchSizeBytes lowers the batch size, but never raises it
+	limitBatchSizeBytes int
+}
+
+// merge overrides s with non-zero fields of newer. Explicit batch size drops limits requested before it.
+func (s aggregatorSettings) merge(newer aggregatorSettings) aggregatorSettings {
+	if newer.maxBatchSizeBytes > 0 {
+		s.maxBatchSizeBytes = newer.maxBatchSizeBytes
+		s.limitBatchSizeBytes = 0
+	}
+	if newer.flushInterval > 0 {
+		s.flushInterval = newer.flushInterval
+	}
+	if newer.limitBatchSizeBytes > 0 &&
+		(s.limitBatchSizeBytes == 0 || newer.limitBatchSizeBytes < s.limitBatchSizeBytes) {
+		s.limitBatchSizeBytes = newer.limitBatchSizeBytes
+	}
+
+	return s
+}
+
+// Input is a source of messages of an Aggregator: either a channel or a Ring. The Aggregator stops
+// once the channel or the Ring is closed.
+type Input struct {
+	Chan <-chan string
+	Ring *Ring
+	// Budget holds bytes of messages of the input. It may be nil.
+	Budget *Budget
+	// Logger writes lines of the Aggregator. log.Default() is used if it's nil.
+	Logger log.Logger
 }
 
 func NewAggregator(
@@ -32,25 +88,111 @@ func NewAggregator(
 	outputChanSize int,
 	maxBatchSizeBytes int,
 	flushInterval time.Duration,
+	clk clock.Clock,
 ) *Aggregator {
-	return &Aggregator{
-		inputChan:     inputChan,
-		outputChan:    make(chan []string, outputChanSize),
-		batch:         newBatch(maxBatchSizeBytes),
-		flushInterval: flushInterval,
+	return NewShards([]Input{{Chan: inputChan}}, outputChanSize, maxBatchSizeBytes, flushInterval, clk)[0]
+}
+
+// NewShards returns an Aggregator per input. Every shard has its own batch and flush timer,
+// but they flush into the same output channel, which is closed once all shards finish.
+func NewShards(
+	inputs []Input,
+	outputChanSize int,
+	maxBatchSizeBytes int,
+	flushInterval time.Duration,
+	clk clock.Clock,
+) []*Aggregator {
+	outputChan := make(chan []string, outputChanSize)
+	running := &atomic.Int64{}
+	running.Store(int64(len(inputs)))
+
+	shards := make([]*Aggregator, 0, len(inputs))
+	for _, input := range inputs {
+		shards = append(
+			shards, &Aggregator{
+				inputChan:     input.Chan,
+				ring:          input.Ring,
+				outputChan:    outputChan,
+				running:       running,
+				budget:        input.Budget,
+				batch:         newBatch(maxBatchSizeBytes),
+				flushInterval: flushInterval,
+				reconfigured:  make(chan aggregatorSettings, 1),
+				clock:         clk,
+				log:           log.OrDefault(input.Logger),
+			},
+		)
 	}
+
+	return shards
 }
 
 func (a *Aggregator) OutputChan() <-chan []string {
 	return a.outputChan
 }
 
+// Reconfigure changes batch size and flush interval of a running Aggregator.
+// Settings are applied by Handle between messages, so the call never blocks.
+// Zero values keep the current settings.
+func (a *Aggregator) Reconfigure(maxBatchSizeBytes int, flushInterval time.Duration) {
+	a.reconfigure(aggregatorSettings{maxBatchSizeBytes: maxBatchSizeBytes, flushInterval: flushInterval})
+}
+
+// LimitBatchSize lowers batch size of a running Aggregator to maxBatchSizeBytes if it's bigger.
+// It's used when the receiver rejects batches as too large.
+func (a *Aggregator) LimitBatchSize(maxBatchSizeBytes int) {
+	a.reconfigure(aggregatorSettings{limitBatchSizeBytes: maxBatchSizeBytes})
+}
+
+func (a *Aggregator) reconfigure(settings aggregatorSettings) {
+	// the channel keeps only the latest settings, not yet applied ones are merged
+	for {
+		select {
+		case a.reconfigured <- settings:
+			return
+		case prev := <-a.reconfigured:
+			settings = prev.merge(settings)
+		}
+	}
+}
+
 func (a *Aggregator) Handle() {
-	timer := time.NewTimer(a.flushInterval)
+	a.clock = clock.OrReal(a.clock)
+	a.log = log.OrDefault(a.log)
+
+	// apply settings that were requested before Handle started
+	select {
+	case settings := <-a.reconfigured:
+		a.apply(settings)
+	default:
+	}
+
+	timer := a.clock.NewTimer(a.flushInterval)
 	defer timer.Stop()
 
 	for {
+		// ready is nil unless messages come from the ring
+		var ready <-chan struct{}
+		if a.ring != nil {
+			if !a.drain(timer) {
+				a.flush(FlushReasonShutdown)
+				a.finishAggregator()
+				return
+			}
+
+			ready = a.ring.Ready()
+		}
+
 		select {
+		case settings := <-a.reconfigured:
+			a.apply(settings)
+
+			// batch can be over the new limit already
+			if a.batch.SizeBytes() >= a.batch.MaxBatchSizeBytes() {
+				a.flush(FlushReasonFull)
+			}
+			resetTimer(timer, a.flushInterval)
+
 		case msg, ok := <-a.inputChan:
 			if !ok {
 				a.flush(FlushReasonShutdown)
@@ -58,33 +200,83 @@ func (a *Aggregator) Handle() {
 				return
 			}
 
-			if a.batch.Add(msg) {
-				continue
-			}
+			a.handle(msg, timer)
 
-			a.flush(FlushReasonFull)
+		case <-ready:
+
+		case <-timer.C():
+			a.flush(FlushReasonTimer)
 			resetTimer(timer, a.flushInterval)
+		}
+	}
+}
 
-			if !a.batch.Add(msg) {
-				log.Error(
-					"failed to add message after flush. msg not sent",
-					maxBatchSizeBytesTag, a.batch.maxSizeBytes,
-				)
+// drain handles messages of the ring until it's empty or ringDrainLimit messages are handled, so settings
+// and the timer are not starved. It returns false when the ring is closed and drained.
+func (a *Aggregator) drain(timer clock.Timer) bool {
+	for range ringDrainLimit {
+		msg, ok := a.ring.Pop()
+		if !ok {
+			break
+		}
 
-				continue
-			}
+		a.handle(msg, timer)
+	}
 
-		case <-timer.C:
-			a.flush(FlushReasonTimer)
-			resetTimer(timer, a.flushInterval)
+	return !a.ring.Drained()
+}
+
+// handle adds msg to the batch and flushes the batch if it's full.
+func (a *Aggregator) handle(msg string, timer clock.Timer) {
+	if a.add(msg) {
+		return
+	}
+
+	a.flush(FlushReasonFull)
+	resetTimer(timer, a.flushInterval)
+
+	if !a.add(msg) {
+		a.log.Error(
+			"failed to add message after flush. msg not sent",
+			maxBatchSizeBytesTag, a.batch.maxSizeBytes,
+		)
+
+		if a.budget != nil {
+			a.budget.Release(len(msg))
 		}
 	}
 }
 
-func resetTimer(timer *time.Timer, flushInterval time.Duration) {
+func (a *Aggregator) apply(settings aggregatorSettings) {
+	if settings.maxBatchSizeBytes > 0 {
+		a.batch.SetMaxBatchSizeBytes(settings.maxBatchSizeBytes)
+	}
+	if settings.flushInterval > 0 {
+		a.flushInterval = settings.flushInterval
+	}
+	if settings.limitBatchSizeBytes > 0 && settings.limitBatchSizeBytes < a.batch.MaxBatchSizeBytes() {
+		a.batch.SetMaxBatchSizeBytes(settings.limitBatchSizeBytes)
+	}
+
+	a.log.Debug(
+		"Aggregator: reconfigured",
+		maxBatchSizeBytesTag, a.batch.MaxBatchSizeBytes(), "flush_period_ms", a.flushInterval.Milliseconds(),
+	)
+}
+
+// add adds msg to the batch and remembers when an empty batch got its first message.
+func (a *Aggregator) add(msg string) bool {
+	if len(a.batch.data) == 0 {
+		a.batchStartedAt = a.clock.Now()
+	}
+
+	return a.batch.Add(msg)
+}
+
+func resetTimer(timer clock.Timer, flushInterval time.Duration) {
 	if !timer.Stop() {
 		select {
-		case <-timer.C:
+		case <-timer.C():
 		default:
 		}
 	}
@@ -97,17 +289,21 @@ func (a *Aggregator) flush(reason string) {
 		return
 	}
 
-	log.Debug(
+	a.log.Debug(
 		"batch flushing",
 		"reason", reason, "batch_size_b", sizeBytes, maxBatchSizeBytesTag, a.batch.MaxBatchSizeBytes(),
 		"flush_period_ms", a.flushInterval.Milliseconds(),
+		"batch_age_ms", a.clock.Since(a.batchStartedAt).Milliseconds(),
 	)
 
 	a.outputChan <- data
 }
 
 func (a *Aggregator) finishAggregator() {
-	log.Debug("Aggregator: graceful shutdown in progress...")
-	close(a.outputChan)
-	log.Debug("Aggregator: finished")
+	a.log.Debug("Aggregator: graceful shutdown in progress...")
+	// the last shard closes the shared channel, Aggregator without shards owns it
+	if a.running == nil || a.running.Add(-1) == 0 {
+		close(a.outputChan)
+	}
+	a.log.Debug("Aggregator: finished")
 }
@@ -1,11 +1,15 @@
 package internal
 
 import (
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+
+	"notifier/clock"
 )
 
 func BenchmarkAggregator_Handle(b *testing.B) {
@@ -21,7 +25,7 @@ func BenchmarkAggregator_Handle(b *testing.B) {
 
 	// Initialize Aggregator
 	// Note: Assuming NewAggregator sets up the internal batch and other fields correctly
-	agg := NewAggregator(inputChan, outputChanSize, maxBatchSizeBytes, flushInterval)
+	agg := NewAggregator(inputChan, outputChanSize, maxBatchSizeBytes, flushInterval, nil)
 
 	// Sample message payload
 	msg := "benchmark_payload_data_string_normal_sized_string_less_than_120_symbols_but_pretty_average_readable_string"
@@ -56,7 +60,7 @@ func BenchmarkAggregator_Handle(b *testing.B) {
 
 func BenchmarkAggregator_Handle_Parallel(b *testing.B) {
 	inputChan := make(chan string, 1000)
-	agg := NewAggregator(inputChan, 100, 1024*10, 1*time.Minute)
+	agg := NewAggregator(inputChan, 100, 1024*10, 1*time.Minute, nil)
 
 	// Drain output
 	go func() {
@@ -92,6 +96,58 @@ func BenchmarkAggregator_Handle_Parallel(b *testing.B) {
 	wg.Wait()
 }
 
+func BenchmarkAggregator_Shards_Parallel(b *testing.B) {
+	shards := runtime.GOMAXPROCS(0)
+
+	inputChans := make([]chan string, shards)
+	inputs := make([]Input, shards)
+	for i := range inputChans {
+		inputChans[i] = make(chan string, 1000)
+		inputs[i] = Input{Chan: inputChans[i]}
+	}
+
+	aggs := NewShards(inputs, 100, 1024*10, 1*time.Minute, nil)
+
+	// Drain output
+	go func() {
+		for range aggs[0].OutputChan() {
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, agg := range aggs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agg.Handle()
+		}()
+	}
+
+	msg := "benchmark_payload_data_string_normal_sized_string_less_than_120_symbols_but_pretty_average_readable_string"
+	msgLen := len(msg)
+
+	// round-robin like Notifier.Notify
+	var next atomic.Uint64
+
+	b.ReportAllocs()
+	b.SetBytes(int64(msgLen))
+	b.ResetTimer()
+
+	b.RunParallel(
+		func(pb *testing.PB) {
+			for pb.Next() {
+				inputChans[next.Add(1)%uint64(shards)] <- msg
+			}
+		},
+	)
+	b.StopTimer()
+
+	for _, inputChan := range inputChans {
+		close(inputChan)
+	}
+	wg.Wait()
+}
+
 func TestAggregator_Handle(t *testing.T) {
 	t.Parallel()
 
@@ -195,3 +251,202 @@ func TestAggregator_Handle(t *testing.T) {
 		)
 	}
 }
+
+func TestAggregator_Reconfigure(t *testing.T) {
+	t.Parallel()
+
+	inputChan := make(chan string, 10)
+	agg := NewAggregator(inputChan, 10, 100, time.Hour, nil)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agg.Handle()
+	}()
+
+	inputChan <- "1"
+	inputChan <- "2"
+
+	// batch is over the new limit, so it's flushed right away
+	agg.Reconfigure(2, 50*time.Millisecond)
+
+	if diff := cmp.Diff([]string{"1", "2"}, <-agg.OutputChan()); diff != "" {
+		t.Errorf("flush after Reconfigure() mismatch (-want +got):\n%s", diff)
+	}
+
+	inputChan <- "3"
+	inputChan <- "4"
+	inputChan <- "5"
+
+	if diff := cmp.Diff([]string{"3", "4"}, <-agg.OutputChan()); diff != "" {
+		t.Errorf("flush by new batch size mismatch (-want +got):\n%s", diff)
+	}
+
+	// flushed by the new interval instead of an hour
+	select {
+	case got := <-agg.OutputChan():
+		if diff := cmp.Diff([]string{"5"}, got); diff != "" {
+			t.Errorf("flush by new interval mismatch (-want +got):\n%s", diff)
+		}
+	case <-time.After(time.Second):
+		t.Error("batch was not flushed by the new interval")
+	}
+
+	close(inputChan)
+	wg.Wait()
+}
+
+func TestAggregator_Reconfigure_Before_Handle(t *testing.T) {
+	t.Parallel()
+
+	agg := NewAggregator(make(chan string), 10, 100, time.Hour, nil)
+
+	agg.Reconfigure(10, 0)
+	agg.Reconfigure(0, time.Minute)
+
+	settings := <-agg.reconfigured
+	if diff := cmp.Diff(aggregatorSettings{maxBatchSizeBytes: 10, flushInterval: time.Minute}, settings,
+		cmp.AllowUnexported(aggregatorSettings{})); diff != "" {
+		t.Errorf("merged settings mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewShards(t *testing.T) {
+	t.Parallel()
+
+	first, second := make(chan string), make(chan string)
+	shards := NewShards([]Input{{Chan: first}, {Chan: second}}, 10, 100, time.Hour, nil)
+
+	wg := &sync.WaitGroup{}
+	for _, shard := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shard.Handle()
+		}()
+	}
+
+	first <- "1"
+	second <- "2"
+	close(first)
+
+	// the first shard is flushed on shutdown, the output is still open for the second one
+	if diff := cmp.Diff([]string{"1"}, <-shards[1].OutputChan()); diff != "" {
+		t.Errorf("first shard batch mismatch (-want +got):\n%s", diff)
+	}
+
+	close(second)
+
+	if diff := cmp.Diff([]string{"2"}, <-shards[0].OutputChan()); diff != "" {
+		t.Errorf("second shard batch mismatch (-want +got):\n%s", diff)
+	}
+
+	wg.Wait()
+
+	if _, ok := <-shards[0].OutputChan(); ok {
+		t.Error("output channel is not closed after all shards finished")
+	}
+}
+
+func TestAggregator_LimitBatchSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		calls func(agg *Aggregator)
+		want  int
+	}{
+		{
+			name: "lowers_batch_size",
+			calls: func(agg *Aggregator) {
+				agg.LimitBatchSize(50)
+			},
+			want: 50,
+		},
+		{
+			name: "never_raises_batch_size",
+			calls: func(agg *Aggregator) {
+				agg.LimitBatchSize(500)
+			},
+			want: 100,
+		},
+		{
+			name: "lowest_limit_wins",
+			calls: func(agg *Aggregator) {
+				agg.LimitBatchSize(30)
+				agg.LimitBatchSize(50)
+			},
+			want: 30,
+		},
+		{
+			name: "explicit_size_drops_limit",
+			calls: func(agg *Aggregator) {
+				agg.LimitBatchSize(30)
+				agg.Reconfigure(80, 0)
+			},
+			want: 80,
+		},
+		{
+			name: "limit_after_explicit_size",
+			calls: func(agg *Aggregator) {
+				agg.Reconfigure(80, 0)
+				agg.LimitBatchSize(60)
+			},
+			want: 60,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				agg := NewAggregator(make(chan string), 10, 100, time.Hour, nil)
+				tt.calls(agg)
+				agg.apply(<-agg.reconfigured)
+
+				if diff := cmp.Diff(tt.want, agg.batch.MaxBatchSizeBytes()); diff != "" {
+					t.Errorf("batch size mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestAggregator_Handle_Flushes_By_Timer(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// unbuffered, so a sent message is already taken by Handle
+	inputChan := make(chan string)
+	agg := NewAggregator(inputChan, 10, 100, time.Minute, clk)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agg.Handle()
+	}()
+
+	clk.BlockUntil(1)
+	inputChan <- "1"
+
+	clk.Advance(time.Minute - time.Second)
+
+	select {
+	case got := <-agg.OutputChan():
+		t.Fatalf("batch %v was flushed before the interval", got)
+	default:
+	}
+
+	clk.Advance(time.Second)
+
+	if diff := cmp.Diff([]string{"1"}, <-agg.OutputChan()); diff != "" {
+		t.Errorf("flush by timer mismatch (-want +got):\n%s", diff)
+	}
+
+	close(inputChan)
+	wg.Wait()
+}
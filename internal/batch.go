@@ -18,6 +18,27 @@ func (b *batch) MaxBatchSizeBytes() int {
 	return b.maxSizeBytes
 }
 
+// SetMaxBatchSizeBytes changes the limit for subsequent Add calls.
+// Messages that are already in the batch are kept even if they exceed the new limit.
+func (b *batch) SetMaxBatchSizeBytes(maxSizeBytes int) {
+	b.maxSizeBytes = maxSizeBytes
+}
+
+// SizeBytes returns the current size of the batch.
+func (b *batch) SizeBytes() int {
+	return b.sizeBytes
+}
+
+// sizeBytes returns the size msgs take in a batch.
+func sizeBytes(msgs []string) int {
+	size := 0
+	for _, msg := range msgs {
+		size += len(msg)
+	}
+
+	return size
+}
+
 func (b *batch) Add(s string) bool {
 	addSize := len(s)
 
@@ -31,12 +52,15 @@ func (b *batch) Add(s string) bool {
 	return true
 }
 
+// Flush hands the collected messages over to the caller, the next batch gets a new slice of the same size.
 func (b *batch) Flush() ([]string, int) {
-	data := make([]string, len(b.data))
-	copy(data, b.data)
+	data := b.data
+	if data == nil {
+		data = []string{}
+	}
 
-	// optimization to reduce slice allocations
-	b.data = make([]string, 0, len(b.data))
+	// the slice is owned by the caller now, so only one allocation per batch is left
+	b.data = make([]string, 0, len(data))
 	sizeBytes := b.sizeBytes
 	b.sizeBytes = 0
 
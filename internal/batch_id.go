@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+
+	"notifier/client"
+)
+
+// HeaderBatchID is sent with every attempt of a batch, see client.HeaderBatchID for how IDs of retries are derived.
+const HeaderBatchID = client.HeaderBatchID
+
+// WithBatchID returns ctx that carries ID of the batch being sent.
+func WithBatchID(ctx context.Context, id string) context.Context {
+	return client.WithBatchID(ctx, id)
+}
+
+// BatchID returns ID of the batch being sent or empty string if ctx doesn't carry it.
+func BatchID(ctx context.Context) string {
+	return client.BatchID(ctx)
+}
+
+type senderIDKey struct{}
+
+// withSenderID returns ctx that carries ID of the Sender Run loop, it's passed to SenderFunc.
+func withSenderID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, senderIDKey{}, id)
+}
+
+func senderID(ctx context.Context) int {
+	id, _ := ctx.Value(senderIDKey{}).(int)
+	return id
+}
+
+func newBatchID() string {
+	return strconv.FormatUint(rand.Uint64(), 36)
+}
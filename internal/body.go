@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+
+	"notifier/codec"
+)
+
+// maxPooledBufferBytes keeps buffers of unusually large batches out of the pool
+const maxPooledBufferBytes = 16 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// pooledBody is a request body encoded into a pooled buffer. HTTP transports close request bodies once
+// they are written, so the buffer is returned to the pool on Close. A body that is never closed is just
+// collected by GC.
+type pooledBody struct {
+	// mu guards against Close called by a transport while another goroutine is still reading
+	mu  sync.Mutex
+	buf *[]byte
+	r   bytes.Reader
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.r.Read(p)
+}
+
+func (b *pooledBody) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf == nil {
+		return nil
+	}
+
+	b.r.Reset(nil)
+	if cap(*b.buf) <= maxPooledBufferBytes {
+		*b.buf = (*b.buf)[:0]
+		bufferPool.Put(b.buf)
+	}
+	b.buf = nil
+
+	return nil
+}
+
+// encodeBody encodes s with enc. Codecs implementing codec.Appender encode into a pooled buffer that is
+// streamed to the connection and reused by the next batch once the body is closed.
+func encodeBody(_ context.Context, enc codec.Codec, s []string) (io.ReadCloser, int, error) {
+	appender, ok := enc.(codec.Appender)
+	if !ok {
+		b, err := enc.Encode(s)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		return io.NopCloser(bytes.NewReader(b)), len(b), nil
+	}
+
+	buf := bufferPool.Get().(*[]byte)
+
+	b, err := appender.AppendEncode((*buf)[:0], s)
+	if err != nil {
+		bufferPool.Put(buf)
+		return nil, 0, err
+	}
+	*buf = b
+
+	body := &pooledBody{buf: buf}
+	body.r.Reset(b)
+
+	return body, len(b), nil
+}
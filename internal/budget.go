@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Budget limits the total size of messages held by Notifier: queued in inputs, collected into batches,
+// being sent or waiting for retries. Messages are released once they are delivered or dropped.
+// Zero limit only counts them.
+type Budget struct {
+	limit int64
+	used  atomic.Int64
+
+	// producers wait for released bytes on released
+	mu       sync.Mutex
+	released *sync.Cond
+	waiting  atomic.Int64
+}
+
+// NewBudget returns Budget of limit bytes, zero means no limit.
+func NewBudget(limit int) *Budget {
+	b := &Budget{limit: int64(limit)}
+	b.released = sync.NewCond(&b.mu)
+
+	return b
+}
+
+// Limit returns the size of the Budget in bytes, zero means no limit.
+func (b *Budget) Limit() int {
+	return int(b.limit)
+}
+
+// Used returns the number of bytes held by messages.
+func (b *Budget) Used() int {
+	return int(b.used.Load())
+}
+
+// TryAcquire reserves n bytes if they fit into the Budget. A message larger than the whole Budget fits only
+// into the empty one, so it's not rejected forever.
+func (b *Budget) TryAcquire(n int) bool {
+	for {
+		used := b.used.Load()
+		if b.limit > 0 && used > 0 && used+int64(n) > b.limit {
+			return false
+		}
+
+		if b.used.CompareAndSwap(used, used+int64(n)) {
+			return true
+		}
+	}
+}
+
+// Acquire reserves n bytes and blocks until they fit into the Budget.
+func (b *Budget) Acquire(n int) {
+	if b.TryAcquire(n) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.waiting.Add(1)
+	defer b.waiting.Add(-1)
+
+	for !b.TryAcquire(n) {
+		b.released.Wait()
+	}
+}
+
+// Release returns n bytes of delivered or dropped messages to the Budget.
+func (b *Budget) Release(n int) {
+	b.used.Add(-int64(n))
+
+	if b.waiting.Load() > 0 {
+		b.mu.Lock()
+		b.released.Broadcast()
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBudget_TryAcquire(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		limit    int
+		acquire  []int
+		want     []bool
+		wantUsed int
+	}{
+		{name: "fits", limit: 10, acquire: []int{4, 6}, want: []bool{true, true}, wantUsed: 10},
+		{name: "exhausted", limit: 10, acquire: []int{4, 7, 6}, want: []bool{true, false, true}, wantUsed: 10},
+		{name: "larger_than_empty_budget", limit: 10, acquire: []int{20, 1}, want: []bool{true, false}, wantUsed: 20},
+		{name: "no_limit", limit: 0, acquire: []int{1 << 30, 1 << 30}, want: []bool{true, true}, wantUsed: 1 << 31},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				b := NewBudget(tt.limit)
+
+				got := make([]bool, 0, len(tt.acquire))
+				for _, n := range tt.acquire {
+					got = append(got, b.TryAcquire(n))
+				}
+
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("TryAcquire() mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantUsed, b.Used()); diff != "" {
+					t.Errorf("Used() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestBudget_Acquire_Waits_For_Release(t *testing.T) {
+	t.Parallel()
+
+	b := NewBudget(10)
+	b.Acquire(8)
+
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		b.Acquire(5)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire() returned while the budget is exhausted")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.Release(8)
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() is blocked after Release()")
+	}
+
+	if diff := cmp.Diff(5, b.Used()); diff != "" {
+		t.Errorf("Used() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"notifier/clock"
+)
+
+// retryItem is a batch that failed at least once and waits for its next attempt.
+type retryItem struct {
+	// id is the same for all attempts of a batch, so receivers can deduplicate it
+	id   string
+	msgs []string
+	// attempts made so far
+	attempts int
+	// firstAttempt is used to cut off batches that are retried for too long
+	firstAttempt time.Time
+	due          time.Time
+}
+
+type itemHeap []*retryItem
+
+func (h itemHeap) Len() int           { return len(h) }
+func (h itemHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h itemHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap) Push(x any)        { *h = append(*h, x.(*retryItem)) }
+
+func (h *itemHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+
+	return item
+}
+
+// delayQueue holds failed batches until their backoff expires and then re-dispatches them to Senders via Out.
+// It also counts batches that are being sent, so Out is closed only when the input is closed
+// and no batch can be re-queued anymore.
+type delayQueue struct {
+	mu    sync.Mutex
+	items itemHeap
+	// pending is the number of batches in the queue plus batches taken by Senders and not marked Done yet
+	pending int
+	closing bool
+
+	// wake interrupts Run waiting when the queue changes
+	wake  chan struct{}
+	out   chan *retryItem
+	clock clock.Clock
+}
+
+func newDelayQueue(clk clock.Clock) *delayQueue {
+	return &delayQueue{
+		wake:  make(chan struct{}, 1),
+		out:   make(chan *retryItem),
+		clock: clock.OrReal(clk),
+	}
+}
+
+// Out returns channel with batches which backoff expired. It's closed after Close once nothing is pending.
+func (q *delayQueue) Out() <-chan *retryItem {
+	return q.out
+}
+
+// Track marks a fresh batch taken by Sender as pending. Every Track must be followed by Done.
+func (q *delayQueue) Track() {
+	q.mu.Lock()
+	q.pending++
+	q.mu.Unlock()
+}
+
+// Push schedules item to be re-dispatched after delay. Sender still calls Done for the attempt that failed.
+func (q *delayQueue) Push(item *retryItem, delay time.Duration) {
+	item.due = q.clock.Now().Add(delay)
+
+	q.mu.Lock()
+	heap.Push(&q.items, item)
+	q.pending++
+	q.mu.Unlock()
+
+	q.notify()
+}
+
+// Done marks that Sender finished with a batch: it was sent, dropped or pushed back.
+func (q *delayQueue) Done() {
+	q.mu.Lock()
+	q.pending--
+	q.mu.Unlock()
+
+	q.notify()
+}
+
+// Close tells the queue that no fresh batches will be tracked anymore. It's safe to call Close several times.
+func (q *delayQueue) Close() {
+	q.mu.Lock()
+	q.closing = true
+	q.mu.Unlock()
+
+	q.notify()
+}
+
+// Len returns the number of batches waiting for their backoff to expire.
+func (q *delayQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+func (q *delayQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches due batches to Out until the queue is closed and nothing is pending.
+func (q *delayQueue) Run() {
+	for {
+		q.mu.Lock()
+		if q.closing && q.pending == 0 {
+			q.mu.Unlock()
+			close(q.out)
+			return
+		}
+
+		var next *retryItem
+		if len(q.items) > 0 {
+			next = q.items[0]
+		}
+		q.mu.Unlock()
+
+		if next == nil {
+			<-q.wake
+			continue
+		}
+
+		if wait := next.due.Sub(q.clock.Now()); wait > 0 && !q.wait(wait) {
+			// queue changed, maybe an earlier batch was pushed
+			continue
+		}
+
+		q.mu.Lock()
+		item := heap.Pop(&q.items).(*retryItem)
+		q.mu.Unlock()
+
+		// item stays pending until Sender marks it Done
+		q.out <- item
+	}
+}
+
+// wait waits for d and returns false if it was interrupted by a change of the queue.
+func (q *delayQueue) wait(d time.Duration) bool {
+	timer := q.clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-q.wake:
+		return false
+	case <-timer.C():
+		return true
+	}
+}
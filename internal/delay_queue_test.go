@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/clock"
+)
+
+func TestDelayQueue_Dispatches_By_Due_Time(t *testing.T) {
+	t.Parallel()
+
+	q := newDelayQueue(nil)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Run()
+	}()
+
+	q.Push(&retryItem{msgs: []string{"late"}}, 60*time.Millisecond)
+	q.Push(&retryItem{msgs: []string{"early"}}, 20*time.Millisecond)
+	q.Push(&retryItem{msgs: []string{"now"}}, 0)
+
+	q.Close()
+
+	var got []string
+	for item := range q.Out() {
+		got = append(got, item.msgs...)
+		q.Done()
+	}
+
+	wg.Wait()
+
+	if diff := cmp.Diff([]string{"now", "early", "late"}, got); diff != "" {
+		t.Errorf("dispatch order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDelayQueue_Waits_For_Tracked_Batches(t *testing.T) {
+	t.Parallel()
+
+	q := newDelayQueue(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run()
+	}()
+
+	// batch is being sent by Sender, it can still be re-queued
+	q.Track()
+	q.Close()
+
+	select {
+	case <-done:
+		t.Fatal("Run() finished while a batch was pending")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	q.Push(&retryItem{msgs: []string{"retry"}}, 0)
+	q.Done()
+
+	item := <-q.Out()
+	if diff := cmp.Diff([]string{"retry"}, item.msgs); diff != "" {
+		t.Errorf("item mismatch (-want +got):\n%s", diff)
+	}
+
+	q.Done()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() didn't finish after all batches were done")
+	}
+
+	if _, ok := <-q.Out(); ok {
+		t.Error("Out() is not closed")
+	}
+}
+
+func TestDelayQueue_Waits_For_Backoff(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	q := newDelayQueue(clk)
+
+	q.Push(&retryItem{msgs: []string{"late"}}, 2*time.Minute)
+	q.Push(&retryItem{msgs: []string{"early"}}, time.Minute)
+	q.Close()
+
+	go q.Run()
+
+	for _, want := range []string{"early", "late"} {
+		clk.BlockUntil(1)
+
+		select {
+		case item := <-q.Out():
+			t.Fatalf("item %v was dispatched before its backoff expired", item.msgs)
+		default:
+		}
+
+		clk.Advance(time.Minute)
+
+		item := <-q.Out()
+		if diff := cmp.Diff([]string{want}, item.msgs); diff != "" {
+			t.Errorf("item mismatch (-want +got):\n%s", diff)
+		}
+
+		q.Done()
+	}
+
+	if _, ok := <-q.Out(); ok {
+		t.Error("Out() is not closed")
+	}
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// ringSlot holds a message of position seq-1. seq equals the position while the slot is free for it.
+type ringSlot struct {
+	seq atomic.Uint64
+	msg string
+}
+
+// Ring is a bounded multi-producer single-consumer queue of messages, an alternative to a buffered channel.
+// Producers reserve slots with a single CAS, so a batch of messages costs about as much as one message.
+// Producers block while the Ring is full, the consumer is woken up through Ready.
+type Ring struct {
+	slots []ringSlot
+	mask  uint64
+
+	// head is the next position to reserve by producers
+	head atomic.Uint64
+	// tail is the next position to read, it's owned by the consumer
+	tail uint64
+
+	closed atomic.Bool
+
+	// sleeping is set by the consumer before it waits on ready
+	sleeping atomic.Bool
+	ready    chan struct{}
+
+	// producers wait for free slots on notFull
+	mu      sync.Mutex
+	notFull *sync.Cond
+	waiting atomic.Int64
+}
+
+// minRingSize is the smallest capacity. A free slot is marked by its position plus the capacity, with a single
+// slot it would equal the mark of the published message.
+const minRingSize = 2
+
+// NewRing returns Ring that holds at least size messages. Size is rounded up to a power of two, and at least
+// minRingSize.
+func NewRing(size int) *Ring {
+	size = max(size, minRingSize)
+
+	capacity := uint64(1) << bits.Len64(uint64(size-1))
+
+	r := &Ring{
+		slots: make([]ringSlot, capacity),
+		mask:  capacity - 1,
+		ready: make(chan struct{}, 1),
+	}
+	r.notFull = sync.NewCond(&r.mu)
+
+	for i := range r.slots {
+		r.slots[i].seq.Store(uint64(i))
+	}
+
+	return r
+}
+
+// Cap returns the number of messages the Ring holds.
+func (r *Ring) Cap() int {
+	return len(r.slots)
+}
+
+// Push adds msg and blocks while the Ring is full. It returns false if the Ring is closed.
+func (r *Ring) Push(msg string) bool {
+	return r.PushBatch([]string{msg})
+}
+
+// TryPush adds msg if there is a free slot. It returns false if the Ring is full or closed.
+func (r *Ring) TryPush(msg string) bool {
+	if r.closed.Load() {
+		return false
+	}
+
+	pos, ok := r.reserve(1)
+	if !ok {
+		return false
+	}
+
+	r.publish(pos, []string{msg})
+
+	return true
+}
+
+// PushBatch adds msgs in order, reserving as many slots as possible at once. It blocks while the Ring is full
+// and returns false if the Ring is closed. Messages of concurrent PushBatch calls are not interleaved
+// unless msgs is longer than Cap.
+func (r *Ring) PushBatch(msgs []string) bool {
+	for len(msgs) > 0 {
+		if r.closed.Load() {
+			return false
+		}
+
+		n := min(len(msgs), len(r.slots))
+
+		pos, ok := r.reserve(n)
+		if !ok {
+			r.waitNotFull(n)
+			continue
+		}
+
+		r.publish(pos, msgs[:n])
+		msgs = msgs[n:]
+	}
+
+	return true
+}
+
+// reserve claims n consecutive positions. It fails if the last of them is not consumed yet.
+func (r *Ring) reserve(n int) (uint64, bool) {
+	for {
+		pos := r.head.Load()
+		last := pos + uint64(n) - 1
+
+		// the consumer frees slots in order, so all positions are free if the last one is
+		seq := r.slots[last&r.mask].seq.Load()
+
+		switch diff := int64(seq - last); {
+		case diff == 0:
+			if r.head.CompareAndSwap(pos, pos+uint64(n)) {
+				return pos, true
+			}
+		case diff < 0:
+			return 0, false
+		}
+		// another producer moved head, try again
+	}
+}
+
+// publish writes msgs to reserved positions starting at pos and wakes the consumer up.
+func (r *Ring) publish(pos uint64, msgs []string) {
+	for i, msg := range msgs {
+		p := pos + uint64(i)
+		slot := &r.slots[p&r.mask]
+		slot.msg = msg
+		slot.seq.Store(p + 1)
+	}
+
+	r.wake()
+}
+
+// waitNotFull blocks until n slots may be free or the Ring is closed.
+func (r *Ring) waitNotFull(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.waiting.Add(1)
+	defer r.waiting.Add(-1)
+
+	for !r.closed.Load() && !r.free(n) {
+		r.notFull.Wait()
+	}
+}
+
+// free reports whether the next n positions are consumed.
+func (r *Ring) free(n int) bool {
+	last := r.head.Load() + uint64(n) - 1
+
+	return int64(r.slots[last&r.mask].seq.Load()-last) >= 0
+}
+
+// Pop returns the next message. It's called by the single consumer and never blocks.
+func (r *Ring) Pop() (string, bool) {
+	slot := &r.slots[r.tail&r.mask]
+	if slot.seq.Load() != r.tail+1 {
+		return "", false
+	}
+
+	msg := slot.msg
+	slot.msg = ""
+	slot.seq.Store(r.tail + uint64(len(r.slots)))
+	r.tail++
+
+	if r.waiting.Load() > 0 {
+		r.mu.Lock()
+		r.notFull.Broadcast()
+		r.mu.Unlock()
+	}
+
+	return msg, true
+}
+
+// Ready returns the channel that receives a value when messages may be available or the Ring is closed.
+// The consumer calls it after Pop returned nothing, wake-ups may be spurious.
+func (r *Ring) Ready() <-chan struct{} {
+	r.sleeping.Store(true)
+
+	// a message could be published before sleeping was set
+	if r.slots[r.tail&r.mask].seq.Load() == r.tail+1 || r.closed.Load() {
+		r.wake()
+	}
+
+	return r.ready
+}
+
+func (r *Ring) wake() {
+	if r.sleeping.Load() && r.sleeping.CompareAndSwap(true, false) {
+		select {
+		case r.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close makes producers fail. Messages that are already pushed can still be popped.
+func (r *Ring) Close() {
+	r.closed.Store(true)
+	r.wake()
+
+	r.mu.Lock()
+	r.notFull.Broadcast()
+	r.mu.Unlock()
+}
+
+// Drained reports whether the Ring is closed and every pushed message is popped. It's called by the consumer.
+func (r *Ring) Drained() bool {
+	if !r.closed.Load() {
+		return false
+	}
+
+	// producers that passed the closed check before Close may still publish
+	return r.head.Load() == r.tail
+}
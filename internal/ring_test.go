@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func BenchmarkAggregator_Ring_Parallel(b *testing.B) {
+	benchmarkRing(b, 1)
+}
+
+func BenchmarkAggregator_Ring_Batch_Parallel(b *testing.B) {
+	benchmarkRing(b, 64)
+}
+
+// benchmarkRing is BenchmarkAggregator_Handle_Parallel with the ring instead of the channel.
+// Producers push batchSize messages at once.
+func benchmarkRing(b *testing.B, batchSize int) {
+	ring := NewRing(1000)
+	agg := NewShards([]Input{{Ring: ring}}, 100, 1024*10, 1*time.Minute, nil)[0]
+
+	// Drain output
+	go func() {
+		for range agg.OutputChan() {
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		agg.Handle()
+	}()
+
+	msg := "benchmark_payload_data_string_normal_sized_string_less_than_120_symbols_but_pretty_average_readable_string"
+	msgLen := len(msg)
+
+	msgs := make([]string, batchSize)
+	for i := range msgs {
+		msgs[i] = msg
+	}
+
+	b.ReportAllocs()
+	b.SetBytes(int64(msgLen * batchSize))
+	b.ResetTimer()
+
+	b.RunParallel(
+		func(pb *testing.PB) {
+			for pb.Next() {
+				ring.PushBatch(msgs)
+			}
+		},
+	)
+	b.StopTimer()
+
+	ring.Close()
+	wg.Wait()
+}
+
+func TestRing_Push_Pop(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		size int
+		push [][]string
+	}{
+		{name: "single", size: 4, push: [][]string{{"1"}, {"2"}, {"3"}}},
+		{name: "batch", size: 4, push: [][]string{{"1", "2"}, {"3", "4"}}},
+		{name: "wraps_around", size: 2, push: [][]string{{"1"}, {"2", "3"}, {"4", "5", "6"}}},
+		{name: "size_zero", size: 0, push: [][]string{{"1"}, {"2", "3"}, {"4", "5", "6"}}},
+		{name: "size_one", size: 1, push: [][]string{{"1"}, {"2", "3"}, {"4", "5", "6"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				ring := NewRing(tt.size)
+
+				var want []string
+				for _, msgs := range tt.push {
+					want = append(want, msgs...)
+				}
+
+				// a slow consumer, so producers wait for free slots
+				done := make(chan []string)
+				go func() {
+					var got []string
+					for len(got) < len(want) {
+						if msg, ok := ring.Pop(); ok {
+							got = append(got, msg)
+							continue
+						}
+
+						<-ring.Ready()
+					}
+					done <- got
+				}()
+
+				for _, msgs := range tt.push {
+					if !ring.PushBatch(msgs) {
+						t.Fatalf("PushBatch(%v) = false", msgs)
+					}
+				}
+
+				if diff := cmp.Diff(want, <-done); diff != "" {
+					t.Errorf("popped messages mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestRing_TryPush_Full(t *testing.T) {
+	t.Parallel()
+
+	ring := NewRing(2)
+
+	if diff := cmp.Diff([]bool{true, true, false}, []bool{ring.TryPush("1"), ring.TryPush("2"), ring.TryPush("3")}); diff != "" {
+		t.Errorf("TryPush() mismatch (-want +got):\n%s", diff)
+	}
+
+	ring.Pop()
+
+	if !ring.TryPush("3") {
+		t.Error("TryPush() = false after Pop()")
+	}
+}
+
+func TestRing_Close(t *testing.T) {
+	t.Parallel()
+
+	ring := NewRing(2)
+	ring.PushBatch([]string{"1", "2"})
+
+	// blocked by the full ring until Close
+	pushed := make(chan bool)
+	go func() {
+		pushed <- ring.Push("3")
+	}()
+
+	ring.Close()
+
+	if <-pushed {
+		t.Error("Push() to closed ring = true")
+	}
+
+	if ring.Drained() {
+		t.Error("Drained() = true before the pushed message is popped")
+	}
+
+	for _, want := range []string{"1", "2"} {
+		if msg, ok := ring.Pop(); !ok || msg != want {
+			t.Errorf("Pop() = %q, %v, want %s, true", msg, ok, want)
+		}
+	}
+
+	if !ring.Drained() {
+		t.Error("Drained() = false after all messages are popped")
+	}
+}
+
+func TestRing_Concurrent_Producers(t *testing.T) {
+	t.Parallel()
+
+	const (
+		producers = 8
+		batches   = 100
+		batchSize = 5
+	)
+
+	ring := NewRing(16)
+	agg := NewShards([]Input{{Ring: ring}}, 100, 1<<20, time.Hour, nil)[0]
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		agg.Handle()
+	}()
+
+	wg := &sync.WaitGroup{}
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for b := range batches {
+				msgs := make([]string, batchSize)
+				for i := range msgs {
+					msgs[i] = fmt.Sprintf("%d-%03d-%d", p, b, i)
+				}
+				ring.PushBatch(msgs)
+			}
+		}()
+	}
+
+	wg.Wait()
+	ring.Close()
+
+	var got []string
+	for batch := range agg.OutputChan() {
+		got = append(got, batch...)
+	}
+	<-done
+
+	// messages of a batch are not interleaved with other producers
+	if diff := cmp.Diff(producers*batches*batchSize, len(got)); diff != "" {
+		t.Fatalf("messages count mismatch (-want +got):\n%s", diff)
+	}
+
+	for i := 0; i < len(got); i += batchSize {
+		for j := 1; j < batchSize; j++ {
+			if want := got[i][:len(got[i])-1] + fmt.Sprint(j); got[i+j] != want {
+				t.Fatalf("message %d = %q, want %q", i+j, got[i+j], want)
+			}
+		}
+	}
+}
@@ -1,85 +1,508 @@
 package internal
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"io"
+	"errors"
 	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
 
 	"notifier/client"
+	"notifier/clock"
+	"notifier/codec"
+	"notifier/errs"
 	"notifier/log"
 	"notifier/log/tag"
+	"notifier/retry"
 )
 
 type SenderFunc func(ctx context.Context, senderID int, httpClient client.HTTPClient, msg []string) error
 
+// FailureFunc is called with messages that were not delivered after all attempts.
+type FailureFunc func(msgs []string, err error)
+
+// SuccessFunc is called with messages that were delivered.
+type SuccessFunc func(msgs []string)
+
 type Sender struct {
-	inputChan  <-chan []string
+	inputChan <-chan []string
+	transport client.Transport
+
+	policy    retry.Policy
+	retries   *delayQueue
+	onFailure FailureFunc
+	onSuccess SuccessFunc
+	// onTooLarge is called with the batch size learned from batches rejected with 413
+	onTooLarge func(maxBatchSizeBytes int)
+	limiter    *rate.Limiter
+	clock      clock.Clock
+	// ordered retries failed batches in place instead of re-queueing them
+	ordered bool
+	log     log.Logger
+
+	// receivers is the number of Run loops that may still take a fresh batch. The retry queue is closed
+	// once the input is closed and none is left, so a batch taken right before the close can still be re-queued.
+	receivers   atomic.Int64
+	inputClosed atomic.Bool
+}
+
+// SenderOptions are optional dependencies of Sender.
+type SenderOptions struct {
+	// Policy decides which failed batches are re-queued and when. Zero Policy makes a single attempt.
+	Policy retry.Policy
+	// OnFailure is called with batches that are dropped. It may be nil.
+	OnFailure FailureFunc
+	// OnSuccess is called with batches that are delivered. It may be nil.
+	OnSuccess SuccessFunc
+	// OnTooLarge is called with a lower batch size after the receiver rejected a batch with 413 and the Sender
+	// split it in halves. The size is the one of the larger half. It may be nil.
+	OnTooLarge func(maxBatchSizeBytes int)
+	// Limiter limits attempts of all Senders sharing it. It may be nil.
+	Limiter *rate.Limiter
+	// Clock is used for backoff and rate limiting. Real clock is used if it's nil.
+	Clock clock.Clock
+	// Ordered makes the Sender retry failed batches in place, so a single Run delivers batches in order.
+	// Retries block the Run then, including halves of batches rejected with 413.
+	Ordered bool
+	// Budget is released for messages that are delivered or dropped. It may be nil.
+	Budget *Budget
+	// Transport replaces the HTTP client and SenderFunc if it's set. Policy.PerAttemptTimeout limits its Send.
+	Transport client.Transport
+	// Logger writes lines of the Sender. Every attempt adds tags of its batch and passes the logger to the transport
+	// with log.NewContext. log.Default() is used if it's nil.
+	Logger log.Logger
+}
+
+// httpTransport sends batches with SenderFunc.
+type httpTransport struct {
 	httpClient client.HTTPClient
 	senderFunc SenderFunc
 }
 
-func encodeBody(_ context.Context, s []string) (io.ReadCloser, error) {
-	resp := struct {
-		Messages []string `json:"messages"`
-	}{Messages: s}
+func (t *httpTransport) Send(ctx context.Context, msgs []string) error {
+	return t.senderFunc(ctx, senderID(ctx), t.httpClient, msgs)
+}
 
-	b, err := json.Marshal(resp)
-	if err != nil {
-		return nil, err
-	}
+// timeoutTransport limits every Send of next by timeout.
+type timeoutTransport struct {
+	next    client.Transport
+	timeout time.Duration
+}
 
-	return io.NopCloser(bytes.NewReader(b)), nil
+func (t *timeoutTransport) Send(ctx context.Context, msgs []string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	return t.next.Send(ctx, msgs)
 }
 
+// NewSender makes every request of httpClient a single attempt. Failed batches are re-queued according to policy
+// instead of blocking the Sender for the whole backoff, so it works with any client.HTTPClient.
+// httpClient and senderFunc are ignored if opts.Transport is set.
 func NewSender(
 	inputChan <-chan []string,
 	httpClient client.HTTPClient,
 	senderFunc SenderFunc,
+	opts SenderOptions,
 ) *Sender {
+	clk := clock.OrReal(opts.Clock)
+	if opts.Policy.Clock == nil {
+		opts.Policy.Clock = clk
+	}
+
+	if budget := opts.Budget; budget != nil {
+		onSuccess, onFailure := opts.OnSuccess, opts.OnFailure
+
+		opts.OnSuccess = func(msgs []string) {
+			if onSuccess != nil {
+				onSuccess(msgs)
+			}
+			budget.Release(sizeBytes(msgs))
+		}
+		opts.OnFailure = func(msgs []string, err error) {
+			if onFailure != nil {
+				onFailure(msgs, err)
+			}
+			budget.Release(sizeBytes(msgs))
+		}
+	}
+
+	var transport client.Transport = &httpTransport{
+		httpClient: retry.Once(httpClient, opts.Policy.PerAttemptTimeout),
+		senderFunc: senderFunc,
+	}
+	if opts.Transport != nil {
+		transport = opts.Transport
+		if opts.Policy.PerAttemptTimeout > 0 {
+			transport = &timeoutTransport{next: transport, timeout: opts.Policy.PerAttemptTimeout}
+		}
+	}
+
 	return &Sender{
 		inputChan:  inputChan,
-		httpClient: httpClient,
-		senderFunc: senderFunc,
+		transport:  transport,
+		policy:     opts.Policy,
+		retries:    newDelayQueue(clk),
+		onFailure:  opts.OnFailure,
+		onSuccess:  opts.OnSuccess,
+		onTooLarge: opts.OnTooLarge,
+		limiter:    opts.Limiter,
+		clock:      clk,
+		ordered:    opts.Ordered,
+		log:        log.OrDefault(opts.Logger),
+	}
+}
+
+// RunRetries re-dispatches failed batches to Senders when their backoff expires.
+// It returns when the input channel is closed and all batches are delivered or dropped.
+func (s *Sender) RunRetries() {
+	s.retries.Run()
+	s.log.Debug("sender: retries finished")
+}
+
+// Retrying returns the number of batches waiting for their next attempt.
+func (s *Sender) Retrying() int {
+	return s.retries.Len()
+}
+
+// Run consumes fresh and re-queued batches until the input channel is closed and no batch waits for retry,
+// or stop is closed. Batch that is being sent when stop is closed is sent till the end.
+func (s *Sender) Run(id int, stop <-chan struct{}) {
+	s.log.Debug("sender started", tag.ID, id)
+
+	input := s.inputChan
+	s.receivers.Add(1)
+
+	for {
+		select {
+		case <-stop:
+			if input != nil {
+				s.leave(false)
+			}
+
+			s.log.Debug("sender stopped", tag.ID, id)
+			return
+		case msg, ok := <-input:
+			if !ok {
+				// wait for retries to finish
+				input = nil
+				s.leave(true)
+				continue
+			}
+
+			s.retries.Track()
+			s.attempt(id, &retryItem{id: newBatchID(), msgs: msg, firstAttempt: s.clock.Now()})
+		case item, ok := <-s.retries.Out():
+			if !ok {
+				s.log.Debug("sender finished", tag.ID, id)
+				return
+			}
+
+			s.attempt(id, item)
+		}
 	}
 }
 
-func (s *Sender) Run(id int) {
-	log.Debug("sender started", "id", id)
+// leave marks that Run doesn't take fresh batches anymore.
+func (s *Sender) leave(inputClosed bool) {
+	if inputClosed {
+		s.inputClosed.Store(true)
+	}
 
-	for msg := range s.inputChan {
-		ctx := context.Background()
+	if s.receivers.Add(-1) == 0 && s.inputClosed.Load() {
+		s.retries.Close()
+	}
+}
 
-		if err := s.senderFunc(ctx, id, s.httpClient, msg); err != nil {
-			continue
+// attempt sends the batch once and re-queues it if the failure is retryable. Ordered Sender retries it in place.
+func (s *Sender) attempt(id int, item *retryItem) {
+	defer s.retries.Done()
+
+	next := s.try(id, item)
+	if !s.ordered {
+		for _, r := range next {
+			s.retries.Push(r.item, r.delay)
 		}
+
+		return
+	}
+
+	// retries block the Sender, so the next batch is not sent until this one is delivered or dropped
+	for len(next) > 0 {
+		r := next[0]
+		s.sleep(r.delay)
+		next = append(s.try(id, r.item), next[1:]...)
 	}
+}
 
-	log.Debug("sender finished", "id", id)
+// requeued is a batch that is sent again after delay.
+type requeued struct {
+	item  *retryItem
+	delay time.Duration
 }
 
+// try sends the batch once and returns batches to send again: the batch itself, its rejected messages or halves.
+func (s *Sender) try(id int, item *retryItem) []requeued {
+	item.attempts++
+
+	logger := log.With(s.log, tag.ID, id, tag.BatchID, item.id, tag.Attempt, item.attempts)
+	ctx := log.NewContext(withSenderID(WithBatchID(context.Background(), item.id), id), logger)
+
+	var latency time.Duration
+	err := s.wait(ctx)
+	if err == nil {
+		start := s.clock.Now()
+		err = s.transport.Send(ctx, item.msgs)
+		latency = s.clock.Since(start)
+	}
+	if err == nil {
+		logger.DebugContext(ctx, "sender: messages sent", tag.Msgs, len(item.msgs), tag.Latency, latency.Milliseconds())
+
+		if s.onSuccess != nil {
+			s.onSuccess(item.msgs)
+		}
+
+		return nil
+	}
+
+	resp, cause := retry.Result(err)
+	if resp != nil && resp.StatusCode == http.StatusRequestEntityTooLarge && len(item.msgs) > 1 {
+		return s.split(ctx, id, item)
+	}
+
+	elapsed := s.clock.Since(item.firstAttempt)
+
+	var (
+		delay time.Duration
+		ok    bool
+	)
+
+	var partial *errs.DeliveryError
+	if errors.As(err, &partial) && len(partial.Rejected) > 0 {
+		// the receiver accepted the batch except for some messages, only they are tried again under a derived ID,
+		// so receivers that deduplicate by ID don't drop them as a repeated batch
+		var accepted []string
+		accepted, item.msgs = splitRejected(item.msgs, partial.Rejected)
+		item.id += ".r" + strconv.Itoa(item.attempts)
+
+		if s.onSuccess != nil && len(accepted) > 0 {
+			s.onSuccess(accepted)
+		}
+
+		delay, ok = s.policy.Delay(item.attempts, elapsed, resp)
+	} else {
+		delay, ok = s.policy.Next(item.attempts, elapsed, resp, cause)
+	}
+
+	if !ok {
+		derr := deliveryError(item, resp, err)
+
+		logger.ErrorContext(
+			ctx, "sender: dropping msgs", tag.Err, err, tag.Msgs, len(item.msgs), tag.Latency, latency.Milliseconds(),
+			"class", derr.Class,
+		)
+
+		if s.onFailure != nil {
+			s.onFailure(item.msgs, derr)
+		}
+
+		return nil
+	}
+
+	logger.WarnContext(
+		ctx, "sender: msgs re-queued", tag.Err, err, tag.Msgs, len(item.msgs), tag.Latency, latency.Milliseconds(),
+		"delay_ms", delay.Milliseconds(),
+	)
+
+	return []requeued{{item: item, delay: delay}}
+}
+
+// split returns halves of item that the receiver rejected as too large to be sent right away.
+// Halves have their own attempts, so a batch can be bisected down to single messages.
+func (s *Sender) split(ctx context.Context, id int, item *retryItem) []requeued {
+	mid := len(item.msgs) / 2
+	halves := [][]string{item.msgs[:mid], item.msgs[mid:]}
+	largest := max(sizeBytes(halves[0]), sizeBytes(halves[1]))
+
+	log.FromContext(ctx).WarnContext(
+		ctx, "sender: batch is too large, msgs split", tag.Msgs, len(item.msgs),
+		"batch_size_b", sizeBytes(item.msgs), maxBatchSizeBytesTag, largest,
+	)
+
+	// fresh batches are limited before the halves are sent
+	if s.onTooLarge != nil {
+		s.onTooLarge(largest)
+	}
+
+	next := make([]requeued, 0, len(halves))
+	for i, msgs := range halves {
+		next = append(
+			next, requeued{item: &retryItem{id: item.id + "." + strconv.Itoa(i), msgs: msgs, firstAttempt: item.firstAttempt}},
+		)
+	}
+
+	return next
+}
+
+// sleep blocks the Sender for d.
+func (s *Sender) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := s.clock.NewTimer(d)
+	defer timer.Stop()
+
+	<-timer.C()
+}
+
+// splitRejected splits msgs into accepted ones and ones at rejected indexes keeping their order.
+func splitRejected(msgs []string, rejected []int) (accepted, rest []string) {
+	isRejected := make([]bool, len(msgs))
+	for _, i := range rejected {
+		if i >= 0 && i < len(msgs) {
+			isRejected[i] = true
+		}
+	}
+
+	for i, msg := range msgs {
+		if isRejected[i] {
+			rest = append(rest, msg)
+		} else {
+			accepted = append(accepted, msg)
+		}
+	}
+
+	return accepted, rest
+}
+
+// deliveryError describes the last failed attempt of item. DeliveryError returned by the HTTP client is copied,
+// so it's not shared between attempts.
+func deliveryError(item *retryItem, resp *http.Response, err error) *errs.DeliveryError {
+	var derr *errs.DeliveryError
+	if errors.As(err, &derr) {
+		c := *derr
+		derr = &c
+	} else {
+		derr = errs.NewDeliveryError(resp, err)
+	}
+
+	derr.Attempts = item.attempts
+	derr.BatchID = item.id
+
+	return derr
+}
+
+// wait blocks until the rate limiter allows an attempt.
+func (s *Sender) wait(ctx context.Context) error {
+	if s.limiter == nil {
+		return nil
+	}
+
+	now := s.clock.Now()
+
+	r := s.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return errs.Wrap(errs.ErrInternal, "rate limiter doesn't allow any attempt")
+	}
+
+	delay := r.DelayFrom(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := s.clock.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		r.CancelAt(s.clock.Now())
+
+		return ctx.Err()
+	}
+}
+
+// DefaultSend sends messages as JSON body of POST request.
 func DefaultSend(ctx context.Context, id int, httpClient client.HTTPClient, msg []string) error {
-	body, err := encodeBody(ctx, msg)
+	return send(ctx, httpClient, codec.JSON, nil, nil, msg)
+}
+
+// NewSenderFunc returns SenderFunc that encodes messages with enc and sends them with additional header.
+// If parser is not nil, successful responses are parsed for rejected messages, they are reported
+// as *errs.DeliveryError with Rejected indexes.
+func NewSenderFunc(enc codec.Codec, header http.Header, parser client.ResponseParser) SenderFunc {
+	return func(ctx context.Context, id int, httpClient client.HTTPClient, msg []string) error {
+		return send(ctx, httpClient, enc, header, parser, msg)
+	}
+}
+
+// send posts msgs with httpClient. Its result is logged by Sender.
+func send(
+	ctx context.Context,
+	httpClient client.HTTPClient,
+	enc codec.Codec,
+	header http.Header,
+	parser client.ResponseParser,
+	msg []string,
+) error {
+	body, size, err := encodeBody(ctx, enc, msg)
 	if err != nil {
-		log.ErrorContext(ctx, "failed to encode body. dropping msgs", tag.ID, id, tag.Err, err, tag.Msgs, len(msg))
+		log.FromContext(ctx).ErrorContext(
+			ctx, "failed to encode body. dropping msgs", tag.Err, err, tag.Msgs, len(msg),
+		)
 
 		return err
 	}
 
-	_, err = httpClient.Do(
+	reqHeader := header.Clone()
+	if reqHeader == nil {
+		reqHeader = http.Header{}
+	}
+	reqHeader.Set("Content-Type", enc.ContentType())
+	if batchID := BatchID(ctx); batchID != "" {
+		reqHeader.Set(HeaderBatchID, batchID)
+	}
+
+	resp, err := httpClient.Do(
 		ctx, &http.Request{
-			Method: http.MethodPost,
-			Body:   body,
+			Method:        http.MethodPost,
+			Header:        reqHeader,
+			Body:          body,
+			ContentLength: int64(size),
 		},
 	)
 	if err != nil {
-		log.ErrorContext(ctx, "sender: failed to send msgs", tag.ID, id, tag.Err, err, tag.Msgs, len(msg))
-
 		return err
 	}
 
-	log.DebugContext(ctx, "sender: messages sent", tag.ID, id, tag.Msgs, len(msg))
+	if parser != nil {
+		return parseResponse(parser, resp, len(msg))
+	}
 
 	return nil
 }
+
+// parseResponse returns *errs.DeliveryError if parser finds rejected messages or fails to read resp.
+func parseResponse(parser client.ResponseParser, resp *http.Response, n int) error {
+	rejected, err := parser(resp, n)
+	if err == nil {
+		err = client.CheckRejected(rejected, n)
+	}
+	if err != nil {
+		return errs.NewDeliveryError(resp, errs.Wrap(err, "parse response"))
+	}
+
+	if len(rejected) == 0 {
+		return nil
+	}
+
+	derr := errs.NewDeliveryError(resp, nil)
+	derr.Rejected = rejected
+
+	return derr
+}
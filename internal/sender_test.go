@@ -1,10 +1,24 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"io"
+	"net/http"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"golang.org/x/time/rate"
+
+	"notifier/clock"
+
+	"notifier/codec"
+	"notifier/retry"
 )
 
 func TestDefaultBodyEncoder(t *testing.T) {
@@ -63,7 +77,7 @@ func TestDefaultBodyEncoder(t *testing.T) {
 			tt.name, func(t *testing.T) {
 				t.Parallel()
 
-				got, err := encodeBody(tt.args.in0, tt.args.s)
+				got, size, err := encodeBody(tt.args.in0, codec.JSON, tt.args.s)
 				if (err != nil) != tt.wantErr {
 					t.Errorf("encodeBody() error = %v, wantErr %v", err, tt.wantErr)
 					return
@@ -82,6 +96,17 @@ func TestDefaultBodyEncoder(t *testing.T) {
 				if gotBody != tt.wantBody {
 					t.Errorf("encodeBody() gotBody = %v, want %v", gotBody, tt.wantBody)
 				}
+				if size != len(tt.wantBody) {
+					t.Errorf("encodeBody() size = %v, want %v", size, len(tt.wantBody))
+				}
+
+				// the buffer goes back to the pool, reads after Close get nothing
+				if err = got.Close(); err != nil {
+					t.Errorf("Close() error = %v", err)
+				}
+				if rest := readBody(got); rest != "" {
+					t.Errorf("body after Close() = %q, want empty", rest)
+				}
 			},
 		)
 	}
@@ -118,8 +143,325 @@ func BenchmarkDefaultBodyEncoder(b *testing.B) {
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		// We discard the result to avoid compiler optimizations removing the function call,
-		// but we don't need to read the body as we are benchmarking the Encoder logic itself.
-		_, _ = encodeBody(ctx, input)
+		// We don't need to read the body as we are benchmarking the Encoder logic itself,
+		// but it's closed like HTTP transports do, so the buffer is reused.
+		body, _, _ := encodeBody(ctx, codec.JSON, input)
+		_ = body.Close()
+	}
+}
+
+// BenchmarkEncodeBody_1MB compares encoding of a 1 MB batch into a pooled buffer with a fresh one per batch.
+func BenchmarkEncodeBody_1MB(b *testing.B) {
+	msg := strings.Repeat("x", 100)
+	input := make([]string, 1<<20/len(msg))
+	for i := range input {
+		input[i] = msg
+	}
+
+	b.Run(
+		"pooled", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(1 << 20)
+
+			for i := 0; i < b.N; i++ {
+				body, _, _ := encodeBody(context.Background(), codec.JSON, input)
+				_, _ = io.Copy(io.Discard, body)
+				_ = body.Close()
+			}
+		},
+	)
+
+	// the body like it was made before buffers were pooled
+	b.Run(
+		"marshal", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(1 << 20)
+
+			for i := 0; i < b.N; i++ {
+				data, _ := json.Marshal(map[string][]string{"messages": input})
+				_, _ = io.Copy(io.Discard, io.NopCloser(bytes.NewReader(data)))
+			}
+		},
+	)
+}
+
+// BenchmarkAggregator_Flush_1MB measures allocations of batches handed over to Senders.
+func BenchmarkAggregator_Flush_1MB(b *testing.B) {
+	msg := strings.Repeat("x", 100)
+	batch := newBatch(1 << 20)
+
+	b.ReportAllocs()
+	b.SetBytes(1 << 20)
+
+	for i := 0; i < b.N; i++ {
+		for batch.Add(msg) {
+		}
+		_, _ = batch.Flush()
+	}
+}
+
+// flakyClient fails every request of a batch that starts with "bad" failures times and then succeeds.
+type flakyClient struct {
+	mu       sync.Mutex
+	failures int
+	attempts map[string]int
+	sent     []string
+}
+
+func (c *flakyClient) Do(_ context.Context, req *http.Request) (*http.Response, error) {
+	msgs, err := codec.JSON.Decode(mustReadAll(req.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts[msgs[0]]++
+	if strings.HasPrefix(msgs[0], "bad") && c.attempts[msgs[0]] <= c.failures {
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+	}
+
+	c.sent = append(c.sent, msgs[0])
+
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func mustReadAll(r io.Reader) []byte {
+	b, _ := io.ReadAll(r)
+	return b
+}
+
+func TestSender_Run_Requeues_Failed_Batches(t *testing.T) {
+	t.Parallel()
+
+	policy := retry.DefaultPolicy()
+	policy.InitialDelay = 50 * time.Millisecond
+	policy.MaxDelay = 50 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		failures     int
+		ordered      bool
+		wantSent     []string
+		wantFailed   []string
+		wantAttempts int
+	}{
+		{
+			name:         "delivered_after_retries",
+			failures:     2,
+			wantSent:     []string{"good", "bad"},
+			wantAttempts: 3,
+		},
+		{
+			name:         "dropped_after_max_attempts",
+			failures:     100,
+			wantSent:     []string{"good"},
+			wantFailed:   []string{"bad"},
+			wantAttempts: retry.DefaultMaxAttempts,
+		},
+		{
+			name:         "ordered_retries_block_next_batch",
+			failures:     2,
+			ordered:      true,
+			wantSent:     []string{"bad", "good"},
+			wantAttempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				c := &flakyClient{failures: tt.failures, attempts: make(map[string]int)}
+
+				var (
+					mu     sync.Mutex
+					failed []string
+				)
+
+				input := make(chan []string, 2)
+				s := NewSender(
+					input, c, DefaultSend, SenderOptions{
+						Policy:  policy,
+						Ordered: tt.ordered,
+						OnFailure: func(msgs []string, err error) {
+							mu.Lock()
+							defer mu.Unlock()
+							failed = append(failed, msgs...)
+						},
+					},
+				)
+
+				wg := &sync.WaitGroup{}
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					s.RunRetries()
+				}()
+				// single Sender proves that a failing batch doesn't block healthy ones during backoff
+				go func() {
+					defer wg.Done()
+					s.Run(0, nil)
+				}()
+
+				input <- []string{"bad"}
+				input <- []string{"good"}
+				close(input)
+				wg.Wait()
+
+				if diff := cmp.Diff(tt.wantSent, c.sent); diff != "" {
+					t.Errorf("sent mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantFailed, failed); diff != "" {
+					t.Errorf("failed mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantAttempts, c.attempts["bad"]); diff != "" {
+					t.Errorf("attempts mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestSender_Run_Waits_For_Rate_Limiter(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	c := &flakyClient{attempts: make(map[string]int)}
+
+	// unbuffered, so the previous batch is sent once the next one is taken
+	input := make(chan []string)
+	s := NewSender(
+		input, c, DefaultSend, SenderOptions{
+			Policy:  retry.NoRetry(),
+			Limiter: rate.NewLimiter(1, 1),
+			Clock:   clk,
+		},
+	)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.RunRetries()
+	}()
+	go func() {
+		defer wg.Done()
+		s.Run(0, nil)
+	}()
+
+	input <- []string{"1"}
+	input <- []string{"2"}
+
+	// the second batch waits for a token
+	clk.BlockUntil(1)
+
+	c.mu.Lock()
+	if diff := cmp.Diff([]string{"1"}, c.sent); diff != "" {
+		t.Errorf("sent before token mismatch (-want +got):\n%s", diff)
+	}
+	c.mu.Unlock()
+
+	clk.Advance(time.Second)
+	close(input)
+	wg.Wait()
+
+	if diff := cmp.Diff([]string{"1", "2"}, c.sent); diff != "" {
+		t.Errorf("sent mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// limitedClient rejects batches bigger than maxSizeBytes with 413.
+type limitedClient struct {
+	maxSizeBytes int
+
+	mu   sync.Mutex
+	sent [][]string
+}
+
+func (c *limitedClient) Do(_ context.Context, req *http.Request) (*http.Response, error) {
+	msgs, err := codec.JSON.Decode(mustReadAll(req.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	status := http.StatusOK
+	if sizeBytes(msgs) > c.maxSizeBytes {
+		status = http.StatusRequestEntityTooLarge
+	} else {
+		c.mu.Lock()
+		c.sent = append(c.sent, msgs)
+		c.mu.Unlock()
+	}
+
+	return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+}
+
+func TestSender_Run_Splits_Too_Large_Batches(t *testing.T) {
+	t.Parallel()
+
+	c := &limitedClient{maxSizeBytes: 4}
+
+	var (
+		mu      sync.Mutex
+		limits  []int
+		failed  []string
+		success []string
+	)
+
+	input := make(chan []string, 1)
+	s := NewSender(
+		input, c, DefaultSend, SenderOptions{
+			Policy: retry.NoRetry(),
+			OnTooLarge: func(maxBatchSizeBytes int) {
+				mu.Lock()
+				defer mu.Unlock()
+				limits = append(limits, maxBatchSizeBytes)
+			},
+			OnSuccess: func(msgs []string) {
+				mu.Lock()
+				defer mu.Unlock()
+				success = append(success, msgs...)
+			},
+			OnFailure: func(msgs []string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, msgs...)
+			},
+		},
+	)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.RunRetries()
+	}()
+	go func() {
+		defer wg.Done()
+		s.Run(0, nil)
+	}()
+
+	// "toolong" can't be split and is dropped
+	input <- []string{"aa", "bb", "cc", "toolong"}
+	close(input)
+	wg.Wait()
+
+	// halves are re-queued at the same time, so their order is not defined
+	sortBatches := cmpopts.SortSlices(func(a, b []string) bool { return a[0] < b[0] })
+	if diff := cmp.Diff([][]string{{"aa", "bb"}, {"cc"}}, c.sent, sortBatches); diff != "" {
+		t.Errorf("sent mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"aa", "bb", "cc"}, success, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Errorf("success mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"toolong"}, failed); diff != "" {
+		t.Errorf("failed mismatch (-want +got):\n%s", diff)
+	}
+	// bytes of the larger half: [aa bb] [cc toolong], then [cc] [toolong]
+	if diff := cmp.Diff([]int{9, 7}, limits); diff != "" {
+		t.Errorf("learned limits mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -0,0 +1,311 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"notifier/client"
+	"notifier/clock"
+	"notifier/codec"
+	"notifier/log"
+	"notifier/log/tag"
+	"notifier/retry"
+)
+
+// errStreamEnded fails writes to a stream whose request is over
+var errStreamEnded = errors.New("stream ended")
+
+// StreamOptions configure Streamers.
+type StreamOptions struct {
+	// MaxBytes rotates the stream once that many bytes are written into it
+	MaxBytes int
+	// MaxAge rotates the stream once it's open that long. It must be less than the HTTP client timeout.
+	MaxAge time.Duration
+	// Header is sent with every stream, Content-Type is NDJSON
+	Header http.Header
+	// Policy delays opening of a stream after failed ones
+	Policy retry.Policy
+	// OnSuccess is called with messages of streams the receiver accepted. It may be nil.
+	OnSuccess SuccessFunc
+	// Budget is released for messages of accepted streams. It may be nil.
+	Budget *Budget
+	// Clock is used for rotation and backoff. Real clock is used if it's nil.
+	Clock clock.Clock
+	// Logger writes lines of Streamers, every stream adds its batch ID. log.Default() is used if it's nil.
+	Logger log.Logger
+}
+
+// Streamer is an alternative to Aggregator. It keeps a chunked request open and writes messages of its input
+// into it as NDJSON lines as soon as they arrive. The stream is rotated when it reaches MaxBytes or MaxAge
+// or fails. Messages of a failed stream are flushed into the output channel, so Sender delivers them as
+// a batch with its retry policy.
+type Streamer struct {
+	inputChan  <-chan string
+	outputChan chan []string
+	// running is the number of Streamers sharing outputChan that have not finished yet
+	running *atomic.Int64
+
+	httpClient client.HTTPClient
+	opts       StreamOptions
+	clock      clock.Clock
+	log        log.Logger
+
+	// line is the buffer the current message is encoded into
+	line []byte
+	// failures is the number of streams that failed in a row
+	failures atomic.Int64
+	// closing waits for responses of rotated streams
+	closing sync.WaitGroup
+}
+
+// stream is a single open request.
+type stream struct {
+	id  string
+	log log.Logger
+	pw  *io.PipeWriter
+	// msgs are written into the stream, they are delivered once the receiver accepts it
+	msgs []string
+	// written is the number of msgs the request took. The receiver may answer before the stream is closed,
+	// msgs after written never reached it then.
+	written   int
+	sizeBytes int
+	timer     clock.Timer
+
+	// ended is closed once the request is over, err is its result
+	ended chan struct{}
+	err   error
+}
+
+// NewStreams returns a Streamer per input channel. They flush messages of failed streams into
+// the same output channel, which is closed once all Streamers finish.
+func NewStreams(
+	inputs []<-chan string,
+	outputChanSize int,
+	httpClient client.HTTPClient,
+	opts StreamOptions,
+) []*Streamer {
+	outputChan := make(chan []string, outputChanSize)
+	running := &atomic.Int64{}
+	running.Store(int64(len(inputs)))
+
+	if budget, onSuccess := opts.Budget, opts.OnSuccess; budget != nil {
+		opts.OnSuccess = func(msgs []string) {
+			if onSuccess != nil {
+				onSuccess(msgs)
+			}
+			budget.Release(sizeBytes(msgs))
+		}
+	}
+
+	streamers := make([]*Streamer, 0, len(inputs))
+	for _, input := range inputs {
+		streamers = append(
+			streamers, &Streamer{
+				inputChan:  input,
+				outputChan: outputChan,
+				running:    running,
+				// statuses are returned as errors, request bodies are not buffered
+				httpClient: retry.Once(httpClient, 0),
+				opts:       opts,
+				clock:      clock.OrReal(opts.Clock),
+				log:        log.OrDefault(opts.Logger),
+			},
+		)
+	}
+
+	return streamers
+}
+
+func (s *Streamer) OutputChan() <-chan []string {
+	return s.outputChan
+}
+
+// Handle writes messages into streams until the input channel is closed. The last stream is closed then,
+// and Handle returns once responses of all streams are received.
+func (s *Streamer) Handle() {
+	var cur *stream
+
+	for {
+		// nil channels block until a stream is open
+		var (
+			expired <-chan time.Time
+			ended   <-chan struct{}
+		)
+		if cur != nil {
+			expired, ended = cur.timer.C(), cur.ended
+		}
+
+		select {
+		case msg, ok := <-s.inputChan:
+			if !ok {
+				s.rotate(cur, "shutdown")
+				s.finishStreamer()
+				return
+			}
+
+			cur = s.write(cur, msg)
+
+		case <-expired:
+			s.rotate(cur, "age")
+			cur = nil
+
+		case <-ended:
+			// the receiver answered before the stream was closed
+			s.rotate(cur, "ended")
+			cur = nil
+		}
+	}
+}
+
+// write writes msg into cur, opening a stream if there is none. It returns the stream to write next messages to,
+// nil if cur was rotated.
+func (s *Streamer) write(cur *stream, msg string) *stream {
+	if cur == nil {
+		cur = s.open()
+	}
+
+	// the message belongs to the stream even if it's not written, so it's flushed with the stream if it fails
+	cur.msgs = append(cur.msgs, msg)
+
+	// the pipe returns once the request took the whole line, so a successful write is a line the receiver got
+	s.line, _ = codec.NDJSON.(codec.Appender).AppendEncode(s.line[:0], []string{msg})
+	if _, err := cur.pw.Write(s.line); err != nil {
+		s.rotate(cur, "error")
+		return nil
+	}
+	cur.written++
+
+	cur.sizeBytes += len(s.line)
+	if cur.sizeBytes >= s.opts.MaxBytes {
+		s.rotate(cur, "size")
+		return nil
+	}
+
+	return cur
+}
+
+// open starts a request that streams the body written into the returned stream.
+// It waits for backoff if previous streams failed.
+func (s *Streamer) open() *stream {
+	if failures := s.failures.Load(); failures > 0 {
+		s.sleep(s.opts.Policy.Backoff(int(failures), nil))
+	}
+
+	pr, pw := io.Pipe()
+	id := newBatchID()
+	st := &stream{
+		id:    id,
+		log:   log.With(s.log, tag.BatchID, id),
+		pw:    pw,
+		timer: s.clock.NewTimer(s.opts.MaxAge),
+		ended: make(chan struct{}),
+	}
+
+	header := s.opts.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", codec.NDJSON.ContentType())
+	header.Set(HeaderBatchID, st.id)
+
+	go func() {
+		defer close(st.ended)
+
+		resp, err := s.httpClient.Do(
+			log.NewContext(WithBatchID(context.Background(), st.id), st.log),
+			&http.Request{Method: http.MethodPost, Header: header, Body: pr},
+		)
+		if resp != nil && resp.Body != nil {
+			_ = resp.Body.Close()
+		}
+		st.err = err
+
+		// writes fail once the request is over
+		_ = pr.CloseWithError(errStreamEnded)
+	}()
+
+	st.log.Debug("stream: opened")
+
+	return st
+}
+
+// rotate closes the body of cur. Its messages are reported once the response is received.
+func (s *Streamer) rotate(cur *stream, reason string) {
+	if cur == nil {
+		return
+	}
+
+	cur.timer.Stop()
+	_ = cur.pw.Close()
+
+	cur.log.Debug("stream: rotating", "reason", reason, tag.Msgs, len(cur.msgs), "size_b", cur.sizeBytes)
+
+	select {
+	case <-cur.ended:
+		// the next stream waits for backoff if this one failed
+		s.finish(cur)
+	default:
+		s.closing.Add(1)
+		go func() {
+			defer s.closing.Done()
+
+			<-cur.ended
+			s.finish(cur)
+		}()
+	}
+}
+
+// finish reports messages of an accepted stream or flushes them into the output channel if it failed.
+// Messages that were not written before the receiver answered are flushed too.
+func (s *Streamer) finish(st *stream) {
+	if st.err == nil {
+		s.failures.Store(0)
+
+		sent, unsent := st.msgs[:st.written], st.msgs[st.written:]
+		st.log.Debug("stream: messages sent", tag.Msgs, len(sent))
+
+		if s.opts.OnSuccess != nil && len(sent) > 0 {
+			s.opts.OnSuccess(sent)
+		}
+
+		if len(unsent) > 0 {
+			st.log.Warn("stream: ended before msgs were written, they are sent as a batch", tag.Msgs, len(unsent))
+			s.outputChan <- unsent
+		}
+
+		return
+	}
+
+	s.failures.Add(1)
+	st.log.Warn("stream: failed, msgs are sent as a batch", tag.Err, st.err, tag.Msgs, len(st.msgs))
+
+	s.outputChan <- st.msgs
+}
+
+// sleep blocks the Streamer for d.
+func (s *Streamer) sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	timer := s.clock.NewTimer(d)
+	defer timer.Stop()
+
+	<-timer.C()
+}
+
+func (s *Streamer) finishStreamer() {
+	s.log.Debug("Streamer: graceful shutdown in progress...")
+	s.closing.Wait()
+
+	// the last Streamer closes the shared channel
+	if s.running.Add(-1) == 0 {
+		close(s.outputChan)
+	}
+	s.log.Debug("Streamer: finished")
+}
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"notifier/client"
+	"notifier/clock"
+	"notifier/codec"
+	"notifier/notifiertest"
+	"notifier/retry"
+)
+
+func TestStreamer_Handle_Rotates_Streams(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		maxBytes int
+		// advance is the time the fake clock is advanced by after every message
+		advance     time.Duration
+		wantStreams [][]string
+	}{
+		{
+			name:        "by_size",
+			maxBytes:    10,
+			wantStreams: [][]string{{"msg1", "msg2"}, {"msg3", "msg4"}, {"msg5"}},
+		},
+		{
+			name:        "by_age",
+			maxBytes:    1 << 20,
+			advance:     time.Minute,
+			wantStreams: [][]string{{"msg1"}, {"msg2"}, {"msg3"}, {"msg4"}, {"msg5"}},
+		},
+		{
+			name:        "on_shutdown",
+			maxBytes:    1 << 20,
+			wantStreams: [][]string{{"msg1", "msg2", "msg3", "msg4", "msg5"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				server := notifiertest.NewServer(t)
+				clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+				var (
+					mu        sync.Mutex
+					delivered []string
+				)
+				input := make(chan string)
+				streamer := NewStreams(
+					[]<-chan string{input}, 1, newStreamClient(server.URL), StreamOptions{
+						MaxBytes: tt.maxBytes,
+						MaxAge:   time.Minute,
+						Clock:    clk,
+						OnSuccess: func(msgs []string) {
+							mu.Lock()
+							defer mu.Unlock()
+
+							delivered = append(delivered, msgs...)
+						},
+					},
+				)[0]
+
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					streamer.Handle()
+				}()
+
+				for _, msg := range []string{"msg1", "msg2", "msg3", "msg4", "msg5"} {
+					input <- msg
+
+					if tt.advance > 0 {
+						// the stream timer is armed once the message is written
+						clk.BlockUntil(1)
+						clk.Advance(tt.advance)
+						server.WaitForMessages(t, len(server.Messages())+1, time.Second)
+					}
+				}
+				close(input)
+				<-done
+
+				var got [][]string
+				for _, b := range server.Batches() {
+					got = append(got, b.Messages)
+
+					if b.Header.Get(HeaderBatchID) == "" {
+						t.Error("stream id header is not sent")
+					}
+				}
+
+				// rotated streams are answered concurrently
+				if diff := cmp.Diff(tt.wantStreams, got, sortStreams); diff != "" {
+					t.Errorf("streams mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(
+					[]string{"msg1", "msg2", "msg3", "msg4", "msg5"}, delivered, cmpopts.SortSlices(strings.Compare),
+				); diff != "" {
+					t.Errorf("delivered messages mismatch (-want +got):\n%s", diff)
+				}
+				if _, ok := <-streamer.OutputChan(); ok {
+					t.Error("messages of accepted streams are flushed")
+				}
+			},
+		)
+	}
+}
+
+func TestStreamer_Handle_Flushes_Failed_Streams(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.SetDefault(notifiertest.Fail(http.StatusServiceUnavailable))
+
+	input := make(chan string)
+	streamer := NewStreams(
+		[]<-chan string{input}, 10, newStreamClient(server.URL), StreamOptions{
+			MaxBytes: 10,
+			MaxAge:   time.Minute,
+			Policy:   retry.NoRetry(),
+		},
+	)[0]
+
+	go streamer.Handle()
+
+	for _, msg := range []string{"msg1", "msg2", "msg3"} {
+		input <- msg
+	}
+	close(input)
+
+	var got [][]string
+	for msgs := range streamer.OutputChan() {
+		got = append(got, msgs)
+	}
+
+	if diff := cmp.Diff([][]string{{"msg1", "msg2"}, {"msg3"}}, got, sortStreams); diff != "" {
+		t.Errorf("flushed messages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStreamer_Handle_Flushes_Unwritten_Messages(t *testing.T) {
+	t.Parallel()
+
+	c := &earlyClient{}
+	input := make(chan string)
+
+	var (
+		mu        sync.Mutex
+		delivered []string
+	)
+	streamer := NewStreams(
+		[]<-chan string{input}, 20, c, StreamOptions{
+			MaxBytes: 1 << 20,
+			MaxAge:   time.Minute,
+			Policy:   retry.NoRetry(),
+			OnSuccess: func(msgs []string) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				delivered = append(delivered, msgs...)
+			},
+		},
+	)[0]
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		streamer.Handle()
+	}()
+
+	var all []string
+	for i := range 20 {
+		msg := fmt.Sprintf("msg%02d", i)
+		all = append(all, msg)
+		input <- msg
+	}
+	close(input)
+	<-done
+
+	var flushed []string
+	for msgs := range streamer.OutputChan() {
+		flushed = append(flushed, msgs...)
+	}
+
+	// streams end after the first line, the rest is either written into the next stream or flushed
+	if diff := cmp.Diff(c.Read(), delivered, cmpopts.SortSlices(strings.Compare)); diff != "" {
+		t.Errorf("delivered messages mismatch (-read +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(all, append(delivered, flushed...), cmpopts.SortSlices(strings.Compare)); diff != "" {
+		t.Errorf("delivered and flushed messages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// earlyClient reads the first line of a stream and answers without reading the rest.
+type earlyClient struct {
+	mu   sync.Mutex
+	read []string
+}
+
+func (c *earlyClient) Do(_ context.Context, req *http.Request) (*http.Response, error) {
+	line, err := bufio.NewReader(req.Body).ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := codec.NDJSON.Decode(line)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.read = append(c.read, msgs...)
+	c.mu.Unlock()
+
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func (c *earlyClient) Read() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.read...)
+}
+
+// sortStreams orders streams by their first message
+var sortStreams = cmpopts.SortSlices(func(a, b []string) bool { return a[0] < b[0] })
+
+func newStreamClient(url string) client.HTTPClient {
+	return client.NewDefaultHTTPClient(resty.New().SetBaseURL(url), nil)
+}
@@ -0,0 +1,120 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"notifier/clock"
+	"notifier/log/tag"
+)
+
+// sampler passes at most burst warnings and errors with the same message per interval. Debug and info lines
+// are not sampled.
+type sampler struct {
+	next     Logger
+	interval time.Duration
+	burst    int
+	clock    clock.Clock
+
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// window counts lines with the same message since start.
+type window struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// maxWindows bounds the memory of messages that are not constant, windows are forgotten once it's reached
+const maxWindows = 1024
+
+// Sample returns Logger that writes at most burst warnings and errors with the same message to l per interval,
+// so an outage doesn't flood logs with the same failure. The first line after suppressed ones has
+// tag.Suppressed with their number. Real clock is used if clk is nil.
+func Sample(l Logger, interval time.Duration, burst int, clk clock.Clock) Logger {
+	return &sampler{
+		next:     OrDefault(l),
+		interval: interval,
+		burst:    burst,
+		clock:    clock.OrReal(clk),
+		windows:  make(map[string]*window),
+	}
+}
+
+// allow reports whether a line with msg is written and returns args with the number of suppressed lines.
+func (s *sampler) allow(msg string, args []interface{}) ([]interface{}, bool) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[msg]
+	if !ok || now.Sub(w.start) >= s.interval {
+		if !ok && len(s.windows) >= maxWindows {
+			clear(s.windows)
+		}
+
+		suppressed := 0
+		if ok {
+			suppressed = w.suppressed
+		}
+
+		w = &window{start: now}
+		s.windows[msg] = w
+
+		if suppressed > 0 {
+			args = append(args[:len(args):len(args)], tag.Suppressed, suppressed)
+		}
+	}
+
+	if w.count >= s.burst {
+		w.suppressed++
+		return nil, false
+	}
+	w.count++
+
+	return args, true
+}
+
+func (s *sampler) DebugContext(ctx context.Context, msg string, data ...interface{}) {
+	s.next.DebugContext(ctx, msg, data...)
+}
+
+func (s *sampler) InfoContext(ctx context.Context, msg string, data ...interface{}) {
+	s.next.InfoContext(ctx, msg, data...)
+}
+
+func (s *sampler) WarnContext(ctx context.Context, msg string, args ...interface{}) {
+	if args, ok := s.allow(msg, args); ok {
+		s.next.WarnContext(ctx, msg, args...)
+	}
+}
+
+func (s *sampler) ErrorContext(ctx context.Context, msg string, args ...interface{}) {
+	if args, ok := s.allow(msg, args); ok {
+		s.next.ErrorContext(ctx, msg, args...)
+	}
+}
+
+func (s *sampler) Debug(msg string, data ...interface{}) {
+	s.next.Debug(msg, data...)
+}
+
+func (s *sampler) Info(msg string, data ...interface{}) {
+	s.next.Info(msg, data...)
+}
+
+func (s *sampler) Warn(msg string, args ...interface{}) {
+	if args, ok := s.allow(msg, args); ok {
+		s.next.Warn(msg, args...)
+	}
+}
+
+func (s *sampler) Error(msg string, args ...interface{}) {
+	if args, ok := s.allow(msg, args); ok {
+		s.next.Error(msg, args...)
+	}
+}
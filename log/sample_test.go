@@ -0,0 +1,45 @@
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/clock"
+	"notifier/log/tag"
+)
+
+func TestSample(t *testing.T) {
+	t.Parallel()
+
+	rec := &recorder{}
+	clk := clock.NewFake(time.Unix(0, 0))
+	l := Sample(rec, time.Second, 2, clk)
+
+	for range 5 {
+		l.Error("request failed", tag.Attempt, 1)
+		l.Warn("dropped")
+		l.Debug("request sent")
+	}
+	clk.Advance(time.Second)
+	l.Error("request failed", tag.Attempt, 2)
+	l.Warn("dropped")
+
+	want := []line{
+		{Level: "error", Msg: "request failed", Args: []interface{}{tag.Attempt, 1}},
+		{Level: "warn", Msg: "dropped"},
+		{Level: "debug", Msg: "request sent"},
+		{Level: "error", Msg: "request failed", Args: []interface{}{tag.Attempt, 1}},
+		{Level: "warn", Msg: "dropped"},
+		{Level: "debug", Msg: "request sent"},
+		{Level: "debug", Msg: "request sent"},
+		{Level: "debug", Msg: "request sent"},
+		{Level: "debug", Msg: "request sent"},
+		{Level: "error", Msg: "request failed", Args: []interface{}{tag.Attempt, 2, tag.Suppressed, 3}},
+		{Level: "warn", Msg: "dropped", Args: []interface{}{tag.Suppressed, 3}},
+	}
+	if diff := cmp.Diff(want, rec.Lines()); diff != "" {
+		t.Errorf("lines mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -6,4 +6,14 @@ const (
 	Msg      = "msg"
 	Msgs     = "msgs"
 	ID       = "id"
+	BatchID  = "batch_id"
+	Attempt  = "attempt"
+	// Notifier is the name of the Notifier instance
+	Notifier = "notifier"
+	// Destination is the URL batches are sent to, without credentials and query
+	Destination = "destination"
+	// Latency of an attempt in milliseconds
+	Latency = "latency_ms"
+	// Suppressed is the number of sampled out lines with the same message
+	Suppressed = "suppressed"
 )
@@ -0,0 +1,104 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+// withLogger adds args to every line of next. nil next is DefaultLogger at the time of logging, so loggers
+// derived before DefaultLogger is replaced follow it.
+type withLogger struct {
+	next Logger
+	args []interface{}
+}
+
+// Default returns Logger that writes to DefaultLogger at the time of logging.
+func Default() Logger {
+	return withLogger{}
+}
+
+// OrDefault returns l or Default() if l is nil.
+func OrDefault(l Logger) Logger {
+	if l == nil {
+		return Default()
+	}
+
+	return l
+}
+
+// With returns Logger that adds args, e.g. tag.BatchID and its value, to every line of l.
+// nil l is the same as Default().
+func With(l Logger, args ...interface{}) Logger {
+	switch l := OrDefault(l).(type) {
+	case *slog.Logger:
+		return l.With(args...)
+	case withLogger:
+		return withLogger{next: l.next, args: append(l.args[:len(l.args):len(l.args)], args...)}
+	default:
+		return withLogger{next: l, args: args}
+	}
+}
+
+func (l withLogger) logger() Logger {
+	if l.next == nil {
+		return DefaultLogger
+	}
+
+	return l.next
+}
+
+func (l withLogger) with(args []interface{}) []interface{} {
+	if len(l.args) == 0 {
+		return args
+	}
+
+	return append(l.args[:len(l.args):len(l.args)], args...)
+}
+
+func (l withLogger) DebugContext(ctx context.Context, msg string, data ...interface{}) {
+	l.logger().DebugContext(ctx, msg, l.with(data)...)
+}
+
+func (l withLogger) InfoContext(ctx context.Context, msg string, data ...interface{}) {
+	l.logger().InfoContext(ctx, msg, l.with(data)...)
+}
+
+func (l withLogger) WarnContext(ctx context.Context, msg string, args ...interface{}) {
+	l.logger().WarnContext(ctx, msg, l.with(args)...)
+}
+
+func (l withLogger) ErrorContext(ctx context.Context, msg string, args ...interface{}) {
+	l.logger().ErrorContext(ctx, msg, l.with(args)...)
+}
+
+func (l withLogger) Debug(msg string, data ...interface{}) {
+	l.logger().Debug(msg, l.with(data)...)
+}
+
+func (l withLogger) Info(msg string, data ...interface{}) {
+	l.logger().Info(msg, l.with(data)...)
+}
+
+func (l withLogger) Warn(msg string, args ...interface{}) {
+	l.logger().Warn(msg, l.with(args)...)
+}
+
+func (l withLogger) Error(msg string, args ...interface{}) {
+	l.logger().Error(msg, l.with(args)...)
+}
+
+type loggerKey struct{}
+
+// NewContext returns ctx that carries l, e.g. a logger with tags of the batch being sent.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns Logger carried by ctx or Default() if there is none.
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+
+	return Default()
+}
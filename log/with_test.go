@@ -0,0 +1,106 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/log/tag"
+)
+
+// line is a line written to recorder.
+type line struct {
+	Level string
+	Msg   string
+	Args  []interface{}
+}
+
+// recorder is Logger that keeps written lines.
+type recorder struct {
+	mu    sync.Mutex
+	lines []line
+}
+
+func (r *recorder) write(level, msg string, args []interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lines = append(r.lines, line{Level: level, Msg: msg, Args: args})
+}
+
+func (r *recorder) Lines() []line {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]line(nil), r.lines...)
+}
+
+func (r *recorder) DebugContext(_ context.Context, msg string, data ...interface{}) {
+	r.write("debug", msg, data)
+}
+
+func (r *recorder) InfoContext(_ context.Context, msg string, data ...interface{}) {
+	r.write("info", msg, data)
+}
+
+func (r *recorder) WarnContext(_ context.Context, msg string, args ...interface{}) {
+	r.write("warn", msg, args)
+}
+
+func (r *recorder) ErrorContext(_ context.Context, msg string, args ...interface{}) {
+	r.write("error", msg, args)
+}
+
+func (r *recorder) Debug(msg string, data ...interface{}) { r.write("debug", msg, data) }
+func (r *recorder) Info(msg string, data ...interface{})  { r.write("info", msg, data) }
+func (r *recorder) Warn(msg string, args ...interface{})  { r.write("warn", msg, args) }
+func (r *recorder) Error(msg string, args ...interface{}) { r.write("error", msg, args) }
+
+func TestWith(t *testing.T) {
+	t.Parallel()
+
+	rec := &recorder{}
+	base := With(rec, tag.Notifier, "billing")
+	batch := With(base, tag.BatchID, "b1")
+	other := With(base, tag.BatchID, "b2")
+
+	batch.Warn("failed", tag.Attempt, 2)
+	other.ErrorContext(context.Background(), "dropped")
+	base.Info("started")
+
+	want := []line{
+		{Level: "warn", Msg: "failed", Args: []interface{}{tag.Notifier, "billing", tag.BatchID, "b1", tag.Attempt, 2}},
+		{Level: "error", Msg: "dropped", Args: []interface{}{tag.Notifier, "billing", tag.BatchID, "b2"}},
+		{Level: "info", Msg: "started", Args: []interface{}{tag.Notifier, "billing"}},
+	}
+	if diff := cmp.Diff(want, rec.Lines()); diff != "" {
+		t.Errorf("lines mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWith_Slog(t *testing.T) {
+	t.Parallel()
+
+	l := slog.New(slog.DiscardHandler)
+	if _, ok := With(l, tag.BatchID, "b1").(*slog.Logger); !ok {
+		t.Errorf("With() of *slog.Logger is %T, want *slog.Logger", With(l))
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := FromContext(context.Background()).(withLogger); !ok {
+		t.Errorf("FromContext() without logger is %T, want Default()", FromContext(context.Background()))
+	}
+
+	rec := &recorder{}
+	FromContext(NewContext(context.Background(), rec)).Warn("failed")
+
+	if diff := cmp.Diff([]line{{Level: "warn", Msg: "failed"}}, rec.Lines()); diff != "" {
+		t.Errorf("lines mismatch (-want +got):\n%s", diff)
+	}
+}
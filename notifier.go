@@ -1,6 +1,7 @@
 package notifier
 
 import (
+	"hash/fnv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -9,7 +10,14 @@ import (
 	"golang.org/x/time/rate"
 
 	"notifier/client"
+	"notifier/codec"
+	"notifier/grpc"
 	"notifier/internal"
+	"notifier/log"
+	"notifier/redact"
+	"notifier/retry"
+	"notifier/signature"
+	"notifier/transform"
 )
 
 const (
@@ -23,6 +31,9 @@ const (
 	// DefaultOutputChanSize sets the size of a channel that sends batched messages to senders
 	DefaultOutputChanSize = DefaultSendersCount * 10
 
+	// DefaultAggregatorShards is a single Aggregator
+	DefaultAggregatorShards = 1
+
 	// DefaultSendersCount sets the number of workers that will send batched messages to specified URL
 	DefaultSendersCount = 10
 	// DefaultHTTPTimeout default timeout for sender
@@ -36,61 +47,305 @@ const (
 
 	// DefaultRPS sets limit of RPS for senders
 	DefaultRPS = 1000
+
+	// DefaultStreamMaxBytes rotates streams of DeliveryStream after 8 MB
+	DefaultStreamMaxBytes = 8 * 1024 * 1024
+	// DefaultStreamMaxAge rotates streams of DeliveryStream before DefaultHTTPTimeout cuts them
+	DefaultStreamMaxAge = 5 * time.Second
+
+	// DefaultLogSampleInterval and DefaultLogSampleBurst log at most 10 warnings or errors with the same message
+	// per second
+	DefaultLogSampleInterval = time.Second
+	DefaultLogSampleBurst    = 10
+)
+
+const (
+	// OrderingNone sends batches with all senders in parallel, so they may be delivered out of order
+	OrderingNone = ""
+	// OrderingKey delivers messages with the same key in order. Keys are hashed to SendersCount lanes,
+	// each with its own Aggregator and a single sender that retries failed batches in place.
+	OrderingKey = "key"
+	// OrderingGlobal delivers all messages in order with a single sender
+	OrderingGlobal = "global"
+)
+
+const (
+	// InputQueueChannel passes messages to Aggregators through buffered channels
+	InputQueueChannel = ""
+	// InputQueueRing passes messages to Aggregators through lock-free rings of at least InputChanSize messages.
+	// It has less contention with many producers, and NotifyBatch enqueues all messages at once. The size is
+	// rounded up to a power of two and is at least 2, so Notify is never synchronous with the ring.
+	InputQueueRing = "ring"
+)
+
+const (
+	// OverflowBlock makes Notify, NotifyKey, NotifyBytes and NotifyBatch wait while the memory budget is exhausted
+	OverflowBlock = ""
+	// OverflowDrop makes them drop messages and return false while the memory budget is exhausted
+	OverflowDrop = "drop"
+)
+
+const (
+	// DeliveryBatch collects messages into batches that are posted by Senders
+	DeliveryBatch = ""
+	// DeliveryStream writes messages as NDJSON lines into long-lived chunked requests as they arrive.
+	// Messages of failed streams are posted as batches by Senders.
+	DeliveryStream = "stream"
 )
 
+const (
+	// TransportHTTP posts batches encoded with the encoder
+	TransportHTTP = ""
+	// TransportGRPC sends every batch as a client-streaming Notify call of grpc/notifier.proto
+	TransportGRPC = "grpc"
+)
+
+// HeaderBatchID is sent with every request. Retries of the same messages have the same ID, so receivers can
+// deduplicate them. Retries of some of the messages have derived IDs, see client.HeaderBatchID.
+const HeaderBatchID = internal.HeaderBatchID
+
+// FailureHandler is called with messages that were not delivered after all retry attempts
+// or that failed with a non-retryable error. err is *errs.DeliveryError. It's called from Sender goroutines, so it must be concurrent safe.
+type FailureHandler func(msgs []string, err error)
+
+// SuccessHandler is called with messages that were delivered. It's called from Sender goroutines,
+// so it must be concurrent safe.
+type SuccessHandler func(msgs []string)
+
 type Options struct {
 	InputChanSize  int
 	OutputChanSize int
 	BatchSize      int
 	SendersCount   int
 	FlushInterval  time.Duration
+	// RPS limits requests per second of all senders including retries. Not applied to notifiers created by NewNotifier.
+	RPS int
 }
 
 // Default sets up Notifier with optimal configuration.
 // You can additionally tweak some settings and pass them as Options arg.
-// However, you can use NewNotifier to tweak almost everything.
-func Default(url string, opt ...Options) *Notifier {
-	options := parseOptional(opt)
-
-	c := resty.New()
-	c.SetTimeout(DefaultHTTPTimeout)
-	c.SetBaseURL(url)
-
-	c.SetRateLimiter(rate.NewLimiter(rate.Limit(DefaultRPS), DefaultRPS))
-
-	// Backoff retry mechanism
-	c.SetRetryWaitTime(DefaultRetryDelay)
-	c.SetRetryMaxWaitTime(DefaultRetryMaxDelay)
-	c.SetRetryCount(DefaultRetryCount)
-	c.AddRetryCondition(client.DefaultRetryCondition)
-
-	return NewNotifier(
-		client.NewDefaultHTTPClient(
-			c,
-			client.DefaultErrorHandler,
-		),
-		options.InputChanSize,
-		options.OutputChanSize,
-		options.BatchSize,
-		options.SendersCount,
-		options.FlushInterval,
-		internal.DefaultSend,
+// Default is a thin wrapper around New, it returns an error wrapping errs.ErrValidation on invalid url or Options.
+// Use New to tweak almost everything.
+func Default(url string, opt ...Options) (*Notifier, error) {
+	return New(url, WithOptions(opt...))
+}
+
+// NewFromConfig validates cfg and sets up Notifier with it.
+func NewFromConfig(cfg Config) (*Notifier, error) {
+	return New(cfg.URL, WithConfig(cfg))
+}
+
+// New sets up Notifier that sends notifications to url. It starts with DefaultConfig, applies opts in order
+// and validates the result.
+func New(url string, opts ...Option) (*Notifier, error) {
+	s := &settings{cfg: DefaultConfig()}
+	s.cfg.URL = url
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	if url != "" {
+		s.cfg.URL = url
+	}
+
+	cfg := s.cfg
+	if err := cfg.validate(s.encoder); err != nil {
+		return nil, err
+	}
+
+	enc := s.encoder
+	if enc == nil {
+		var err error
+		if enc, err = codec.ByName(cfg.Encoder); err != nil {
+			return nil, err
+		}
+	}
+
+	policy := cfg.retryPolicy()
+	if s.retryPolicy != nil {
+		policy = *s.retryPolicy
+	}
+
+	httpClient := s.httpClient
+	if httpClient == nil {
+		c := resty.New()
+		c.SetTimeout(cfg.HTTPTimeout)
+		c.SetBaseURL(cfg.URL)
+
+		httpClient = client.NewDefaultHTTPClient(c, s.errorHandler)
+	}
+
+	if cfg.SigningSecret != "" {
+		httpClient = signature.NewClient(httpClient, []byte(cfg.SigningSecret), s.clock)
+	}
+
+	transport := s.transport
+	if transport == nil && cfg.Transport == TransportGRPC {
+		transport = grpc.NewTransport(cfg.URL, grpc.Options{Header: cfg.header(), Timeout: cfg.HTTPTimeout})
+	}
+	if transport != nil && cfg.Delivery == DeliveryStream {
+		return nil, invalid("WithTransport", "transport is not supported with stream delivery")
+	}
+
+	var redactor *redact.Redactor
+	if cfg.Redaction.Enabled() {
+		var err error
+		if redactor, err = redact.New(cfg.Redaction); err != nil {
+			return nil, err
+		}
+	}
+
+	onFailure := s.onFailure
+	if redactor != nil && cfg.Redaction.DeadLetters && onFailure != nil {
+		onFailure = func(msgs []string, err error) {
+			s.onFailure(redactor.RedactAll(msgs), err)
+		}
+	}
+
+	// the template renders messages shaped by transformers of options
+	transformers := s.transformers
+	if cfg.Template != "" {
+		tmpl, err := transform.Template(cfg.Template)
+		if err != nil {
+			return nil, err
+		}
+		transformers = append(transformers, tmpl)
+	}
+
+	limiter := rate.NewLimiter(rate.Limit(cfg.RPS), cfg.RPS)
+	logger := cfg.logger(s.logger, s.clock)
+
+	n := newNotifier(
+		httpClient,
+		cfg.InputChanSize,
+		cfg.OutputChanSize,
+		cfg.BatchSizeBytes,
+		cfg.SendersCount,
+		cfg.FlushInterval,
+		internal.NewSenderFunc(enc, cfg.header(), s.responseParser),
+		internal.SenderOptions{
+			Policy:    policy,
+			OnFailure: internal.FailureFunc(onFailure),
+			OnSuccess: internal.SuccessFunc(s.onSuccess),
+			Limiter:   limiter,
+			Clock:     s.clock,
+			Budget:    internal.NewBudget(cfg.MemoryBudgetBytes),
+			Transport: transport,
+			Logger:    logger,
+		},
+		cfg.topology(),
 	)
+	n.limiter = limiter
+	n.options.RPS = cfg.RPS
+	n.overflow = cfg.Overflow
+	n.redactor = redactor
+	if len(transformers) > 0 {
+		n.transform = transform.Chain(transformers...)
+	}
+
+	return n, nil
 }
 
 type Notifier struct {
-	inputChan chan string
+	// lanes are Aggregators with their input channels. There is a single lane unless ordering is OrderingKey
+	// or aggregator shards are set.
+	lanes []*lane
+	// pools consume batches of lanes. A pool per lane with OrderingKey, a single pool otherwise.
+	pools []*pool
+	// ordering is one of Ordering* modes
+	ordering string
+	// next spreads messages without a key over lanes
+	next atomic.Uint64
 
-	aggregator *internal.Aggregator
+	// budget holds bytes of messages from Notify until they are delivered or dropped
+	budget *internal.Budget
+	// overflow is one of Overflow* behaviours applied when budget is exhausted
+	overflow string
+
+	// log writes lines of the Notifier with its tags. Aggregators and Senders write with the same logger.
+	log log.Logger
+
+	// redactor removes personal data from logged messages. It's nil without redaction rules.
+	redactor *redact.Redactor
+	// transform shapes messages before they are queued. It's nil without transformers.
+	transform transform.Transformer
 
-	sendersCount int
-	sender       *internal.Sender
+	// limiter is shared by all senders. It's nil if Notifier was created by NewNotifier.
+	limiter *rate.Limiter
 
+	// mu guards options, senderStops of pools, senderIDs and isStarted
+	mu        sync.Mutex
+	options   Options
+	isStarted bool
+	// senderIDs is the number of Senders started so far, every Sender gets the next ID
+	senderIDs int
+
+	// inputMu guards inputChan of lanes from being closed while messages are sent into it
+	inputMu           sync.RWMutex
 	isInputChanLocked atomic.Bool
 
 	wg *sync.WaitGroup
 }
 
+// topology decides how messages flow from Notify to Senders.
+type topology struct {
+	// ordering is one of Ordering* modes
+	ordering string
+	// shards is the number of Aggregators sharing a pool without ordering
+	shards int
+	// ring replaces input channels with internal.Ring
+	ring bool
+	// stream replaces Aggregators with internal.Streamer if it's not nil. Policy, OnSuccess, Budget, Clock
+	// and Logger are taken from Sender options.
+	stream *internal.StreamOptions
+}
+
+// lane is an Aggregator with its input channel or ring.
+type lane struct {
+	inputChan chan string
+	ring      *internal.Ring
+
+	// aggregator is nil if streamer consumes the input instead
+	aggregator *internal.Aggregator
+	streamer   *internal.Streamer
+}
+
+// send puts msg into the input queue of the lane. It returns false if the queue is full and wait is false.
+func (l *lane) send(msg string, wait bool) bool {
+	if l.ring != nil {
+		if wait {
+			return l.ring.Push(msg)
+		}
+
+		return l.ring.TryPush(msg)
+	}
+
+	if wait {
+		l.inputChan <- msg
+		return true
+	}
+
+	select {
+	case l.inputChan <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// pool is a Sender with its running Run loops.
+type pool struct {
+	sender *internal.Sender
+	// senderStops has a stop channel per running sender
+	senderStops []chan struct{}
+}
+
+// NewNotifier sets up Notifier with custom senderFunc.
+//
+// Deprecated: positional arguments are easy to mix up, use New with Options instead.
 func NewNotifier(
 	httpClient client.HTTPClient,
 	inputChanSize int,
@@ -100,48 +355,152 @@ func NewNotifier(
 	flushInterval time.Duration,
 	senderFunc internal.SenderFunc,
 ) *Notifier {
+	return newNotifier(
+		httpClient, inputChanSize, outputChanSize, batchSize, sendersCount, flushInterval, senderFunc,
+		internal.SenderOptions{Policy: retry.NoRetry()}, topology{shards: 1},
+	)
+}
+
+func newNotifier(
+	httpClient client.HTTPClient,
+	inputChanSize int,
+	outputChanSize int,
+	batchSize int,
+	sendersCount int,
+	flushInterval time.Duration,
+	senderFunc internal.SenderFunc,
+	senderOpts internal.SenderOptions,
+	topo topology,
+) *Notifier {
+	// shards of a pool share its output channel
+	pools, shardsPerPool := 1, topo.shards
+	switch topo.ordering {
+	case OrderingKey:
+		// every lane is served by a single sender
+		pools, shardsPerPool = sendersCount, 1
+	case OrderingGlobal:
+		sendersCount = 1
+	}
+
+	if senderOpts.Budget == nil {
+		// usage is counted even without a limit
+		senderOpts.Budget = internal.NewBudget(0)
+	}
+
 	n := &Notifier{
-		inputChan:         make(chan string, inputChanSize),
+		ordering:          topo.ordering,
+		budget:            senderOpts.Budget,
+		log:               log.OrDefault(senderOpts.Logger),
 		isInputChanLocked: atomic.Bool{},
-		sendersCount:      sendersCount,
-		wg:                &sync.WaitGroup{},
+		options: Options{
+			InputChanSize:  inputChanSize,
+			OutputChanSize: outputChanSize,
+			BatchSize:      batchSize,
+			SendersCount:   sendersCount,
+			FlushInterval:  flushInterval,
+		},
+		wg: &sync.WaitGroup{},
 	}
 
-	n.aggregator = internal.NewAggregator(n.inputChan, outputChanSize, batchSize, flushInterval)
+	senderOpts.Ordered = topo.ordering != OrderingNone
+	onTooLarge := senderOpts.OnTooLarge
 
-	n.sender = internal.NewSender(n.aggregator.OutputChan(), httpClient, senderFunc)
+	for range pools {
+		lanes := make([]*lane, 0, shardsPerPool)
+		inputs := make([]internal.Input, 0, shardsPerPool)
+		for range shardsPerPool {
+			l := &lane{}
+			if topo.ring {
+				l.ring = internal.NewRing(inputChanSize)
+			} else {
+				l.inputChan = make(chan string, inputChanSize)
+			}
 
-	return n
-}
+			lanes = append(lanes, l)
+			inputs = append(
+				inputs,
+				internal.Input{Chan: l.inputChan, Ring: l.ring, Budget: senderOpts.Budget, Logger: senderOpts.Logger},
+			)
+		}
 
-func parseOptional(opt []Options) Options {
-	if len(opt) == 0 {
-		return Options{
-			InputChanSize:  DefaultInputChanSize,
-			OutputChanSize: DefaultOutputChanSize,
-			BatchSize:      DefaultBatchSizeBytes,
-			SendersCount:   DefaultSendersCount,
-			FlushInterval:  DefaultFlushInterval,
+		var (
+			aggregators []*internal.Aggregator
+			output      <-chan []string
+		)
+		if topo.stream != nil {
+			streamers := n.newStreams(lanes, outputChanSize, httpClient, *topo.stream, senderOpts)
+			output = streamers[0].OutputChan()
+		} else {
+			aggregators = internal.NewShards(inputs, outputChanSize, batchSize, flushInterval, senderOpts.Clock)
+			for i, l := range lanes {
+				l.aggregator = aggregators[i]
+			}
+			output = aggregators[0].OutputChan()
 		}
-	}
 
-	result := opt[0]
+		senderOpts.OnTooLarge = onTooLarge
+		if senderOpts.OnTooLarge == nil {
+			// batches rejected with 413 teach the aggregators a batch size the receiver accepts
+			senderOpts.OnTooLarge = func(maxBatchSizeBytes int) {
+				for _, a := range aggregators {
+					a.LimitBatchSize(maxBatchSizeBytes)
+				}
+			}
+		}
 
-	if result.InputChanSize == 0 {
-		result.InputChanSize = DefaultInputChanSize
+		n.lanes = append(n.lanes, lanes...)
+		n.pools = append(
+			n.pools, &pool{sender: internal.NewSender(output, httpClient, senderFunc, senderOpts)},
+		)
 	}
-	if result.OutputChanSize == 0 {
-		result.OutputChanSize = DefaultOutputChanSize
+
+	return n
+}
+
+// newStreams sets up a Streamer per lane, they share the output channel with messages of failed streams.
+func (n *Notifier) newStreams(
+	lanes []*lane,
+	outputChanSize int,
+	httpClient client.HTTPClient,
+	opts internal.StreamOptions,
+	senderOpts internal.SenderOptions,
+) []*internal.Streamer {
+	opts.Policy = senderOpts.Policy
+	opts.OnSuccess = senderOpts.OnSuccess
+	opts.Budget = senderOpts.Budget
+	opts.Clock = senderOpts.Clock
+	opts.Logger = senderOpts.Logger
+
+	inputs := make([]<-chan string, 0, len(lanes))
+	for _, l := range lanes {
+		inputs = append(inputs, l.inputChan)
 	}
-	if result.BatchSize == 0 {
-		result.BatchSize = DefaultBatchSizeBytes
+
+	streamers := internal.NewStreams(inputs, outputChanSize, httpClient, opts)
+	for i, l := range lanes {
+		l.streamer = streamers[i]
 	}
-	if result.SendersCount == 0 {
-		result.SendersCount = DefaultSendersCount
+
+	return streamers
+}
+
+// pick returns a lane for a message without a key.
+func (n *Notifier) pick() *lane {
+	if len(n.lanes) == 1 {
+		return n.lanes[0]
 	}
-	if result.FlushInterval == 0 {
-		result.FlushInterval = DefaultFlushInterval
+
+	return n.lanes[n.next.Add(1)%uint64(len(n.lanes))]
+}
+
+// laneOf returns the lane that delivers messages with key.
+func (n *Notifier) laneOf(key string) *lane {
+	if len(n.lanes) == 1 {
+		return n.lanes[0]
 	}
 
-	return result
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return n.lanes[h.Sum32()%uint32(len(n.lanes))]
 }
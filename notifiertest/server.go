@@ -0,0 +1,338 @@
+// Package notifiertest provides an in-process fake receiver of notifier batches and assertion helpers
+// for tests of code that uses notifier.
+package notifiertest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"notifier/codec"
+	"notifier/grpc"
+)
+
+// Response scripts how Server answers a single request.
+type Response struct {
+	// Status defaults to 200
+	Status int
+	// Delay is waited before answering
+	Delay time.Duration
+	// Header is added to the response
+	Header http.Header
+	// Body of the response
+	Body string
+}
+
+// Fail answers with status.
+func Fail(status int) Response {
+	return Response{Status: status}
+}
+
+// Throttle answers with 429 and Retry-After header. Retry-After counts whole seconds, so retryAfter is rounded up,
+// e.g. 500ms is sent as 1.
+func Throttle(retryAfter time.Duration) Response {
+	seconds := (retryAfter + time.Second - 1) / time.Second
+
+	return Response{
+		Status: http.StatusTooManyRequests,
+		Header: http.Header{"Retry-After": []string{strconv.FormatInt(int64(seconds), 10)}},
+	}
+}
+
+// Latency answers with 200 after delay.
+func Latency(delay time.Duration) Response {
+	return Response{Status: http.StatusOK, Delay: delay}
+}
+
+// Batch is a request received by Server.
+type Batch struct {
+	Messages []string
+	Header   http.Header
+	// Body is the raw request body, e.g. to verify its signature
+	Body []byte
+	// Codec is the name of codec the body was decoded with
+	Codec string
+	// Status Server answered with
+	Status     int
+	ReceivedAt time.Time
+}
+
+// Accepted reports whether Server answered with a successful status.
+func (b Batch) Accepted() bool {
+	return b.Status >= 200 && b.Status <= 399
+}
+
+// Server is a recording fake endpoint. It decodes batches in any supported encoding by Content-Type header
+// (JSON is assumed if it's missing) and answers according to the script.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	batches  []Batch
+	script   []Response
+	fallback Response
+	// changed is closed and replaced every time a batch is recorded
+	changed chan struct{}
+}
+
+// NewServer starts Server that is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		fallback: Response{Status: http.StatusOK},
+		changed:  make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Script sets responses for the next requests, one response per request in order.
+// Once the script is exhausted, the default response is used.
+func (s *Server) Script(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.script = append(s.script, responses...)
+}
+
+// SetDefault sets response used when the script is exhausted.
+func (s *Server) SetDefault(r Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fallback = r
+}
+
+// NewGRPCServer starts Server that serves Notify of grpc/notifier.proto over unencrypted HTTP/2 and is closed
+// when the test finishes. Scripted statuses are answered with the closest gRPC codes, Retry-After header
+// with the retry pushback. Codec of received batches is "grpc".
+func NewGRPCServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		fallback: Response{Status: http.StatusOK},
+		changed:  make(chan struct{}),
+	}
+	s.Server = httptest.NewUnstartedServer(grpc.NewHandler(s.notify))
+	s.Config.Protocols = &http.Protocols{}
+	s.Config.Protocols.SetHTTP1(true)
+	s.Config.Protocols.SetUnencryptedHTTP2(true)
+	s.Start()
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// next returns the response to the request and waits for its delay. It returns false if the request
+// is canceled meanwhile.
+func (s *Server) next(ctx context.Context) (Response, bool) {
+	s.mu.Lock()
+	resp := s.fallback
+	if len(s.script) > 0 {
+		resp = s.script[0]
+		s.script = s.script[1:]
+	}
+	s.mu.Unlock()
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-ctx.Done():
+			return resp, false
+		}
+	}
+
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+
+	return resp, true
+}
+
+func (s *Server) notify(ctx context.Context, md http.Header, msgs []string) ([]int, error) {
+	resp, ok := s.next(ctx)
+	if !ok {
+		return nil, ctx.Err()
+	}
+
+	s.record(Batch{Messages: msgs, Header: md.Clone(), Codec: "grpc", Status: resp.Status, ReceivedAt: time.Now()})
+
+	if resp.Status >= 200 && resp.Status <= 399 {
+		return nil, nil
+	}
+
+	st := &grpc.Status{Code: grpc.CodeFromHTTPStatus(resp.Status), Message: resp.Body}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		st.RetryPushback = time.Duration(seconds) * time.Second
+	}
+
+	return nil, st
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	resp, ok := s.next(r.Context())
+	if !ok {
+		return
+	}
+
+	b := Batch{Header: r.Header.Clone(), Status: resp.Status, ReceivedAt: time.Now()}
+
+	// requests with bodies that can't be decoded are recorded with the status they are answered with
+	if status, err := decode(&b, r); err != nil {
+		b.Status = status
+		s.record(b)
+
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	s.record(b)
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.Status)
+	_, _ = io.WriteString(w, resp.Body)
+}
+
+// decode fills body, codec and messages of b from r. It returns the status to answer with on errors.
+func decode(b *Batch, r *http.Request) (int, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	b.Body = body
+
+	c := codec.JSON
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if c, err = codec.ByContentType(contentType); err != nil {
+			return http.StatusUnsupportedMediaType, err
+		}
+	}
+	b.Codec = c.Name()
+
+	if b.Messages, err = c.Decode(body); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return 0, nil
+}
+
+func (s *Server) record(b Batch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, b)
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Batches returns all received batches including rejected ones and ones with bodies that can't be decoded.
+func (s *Server) Batches() []Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Batch(nil), s.batches...)
+}
+
+// Requests returns the number of received batches including rejected ones and ones with bodies that can't
+// be decoded.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.batches)
+}
+
+// Messages returns messages of accepted batches in order of arrival.
+func (s *Server) Messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.messages()
+}
+
+func (s *Server) messages() []string {
+	var msgs []string
+	for _, b := range s.batches {
+		if b.Accepted() {
+			msgs = append(msgs, b.Messages...)
+		}
+	}
+
+	return msgs
+}
+
+// Reset forgets received batches and the script.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = nil
+	s.script = nil
+}
+
+// WaitForMessages waits until at least n messages are accepted and returns them.
+// The test fails if it takes longer than timeout.
+func (s *Server) WaitForMessages(t testing.TB, n int, timeout time.Duration) []string {
+	t.Helper()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		s.mu.Lock()
+		msgs := s.messages()
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(msgs) >= n {
+			return msgs
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			t.Fatalf("notifiertest: got %d messages after %v, want %d", len(msgs), timeout, n)
+			return msgs
+		}
+	}
+}
+
+// AssertDelivered checks that exactly msgs were accepted, in any order.
+func (s *Server) AssertDelivered(t testing.TB, msgs ...string) {
+	t.Helper()
+
+	if got := s.Messages(); !slices.Equal(sorted(msgs), sorted(got)) {
+		t.Errorf("notifiertest: delivered messages = %q, want %q in any order", got, msgs)
+	}
+}
+
+// AssertDeliveredInOrder checks that exactly msgs were accepted in the given order.
+func (s *Server) AssertDeliveredInOrder(t testing.TB, msgs ...string) {
+	t.Helper()
+
+	if got := s.Messages(); !slices.Equal(msgs, got) {
+		t.Errorf("notifiertest: delivered messages = %q, want %q", got, msgs)
+	}
+}
+
+func sorted(msgs []string) []string {
+	out := append([]string{}, msgs...)
+	sort.Strings(out)
+
+	return out
+}
@@ -0,0 +1,193 @@
+package notifiertest
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/codec"
+)
+
+func post(t *testing.T, url string, c codec.Codec, msgs ...string) *http.Response {
+	t.Helper()
+
+	body, err := c.Encode(msgs)
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+
+	resp, err := http.Post(url, c.ContentType(), bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	return resp
+}
+
+func TestServer_Decodes_All_Codecs(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+
+	post(t, s.URL, codec.JSON, "a", "b")
+	post(t, s.URL, codec.NDJSON, "c")
+
+	s.AssertDeliveredInOrder(t, "a", "b", "c")
+
+	got := []string{}
+	for _, b := range s.Batches() {
+		got = append(got, b.Codec)
+	}
+
+	if diff := cmp.Diff([]string{"json", "ndjson"}, got); diff != "" {
+		t.Errorf("codecs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServer_Script(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+	s.Script(Fail(http.StatusServiceUnavailable), Throttle(2*time.Second), Latency(10*time.Millisecond))
+
+	tests := []struct {
+		name       string
+		wantStatus int
+		wantHeader string
+	}{
+		{
+			name:       "fail",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "throttle",
+			wantStatus: http.StatusTooManyRequests,
+			wantHeader: "2",
+		},
+		{
+			name:       "latency",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "script_exhausted",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	// requests are sequential because the script is consumed in order
+	for _, tt := range tests {
+		resp := post(t, s.URL, codec.JSON, tt.name)
+
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status = %v, want %v", tt.name, resp.StatusCode, tt.wantStatus)
+		}
+
+		if got := resp.Header.Get("Retry-After"); got != tt.wantHeader {
+			t.Errorf("%s: Retry-After = %q, want %q", tt.name, got, tt.wantHeader)
+		}
+	}
+
+	if diff := cmp.Diff(4, s.Requests()); diff != "" {
+		t.Errorf("Requests() mismatch (-want +got):\n%s", diff)
+	}
+
+	// rejected batches are not delivered
+	s.AssertDelivered(t, "script_exhausted", "latency")
+}
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{retryAfter: 0, want: "0"},
+		{retryAfter: 500 * time.Millisecond, want: "1"},
+		{retryAfter: time.Second, want: "1"},
+		{retryAfter: 1500 * time.Millisecond, want: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.retryAfter.String(), func(t *testing.T) {
+				t.Parallel()
+
+				got := Throttle(tt.retryAfter).Header.Get("Retry-After")
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("Retry-After mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestServer_Rejects_Unsupported_Body(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+
+	resp, err := http.Post(s.URL, "text/plain", bytes.NewReader([]byte("hello")))
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %v, want %v", resp.StatusCode, http.StatusUnsupportedMediaType)
+	}
+
+	resp, err = http.Post(s.URL, codec.JSON.ContentType(), bytes.NewReader([]byte("{")))
+	if err != nil {
+		t.Fatalf("failed to post: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	// rejected requests are recorded too
+	var got []int
+	for _, b := range s.Batches() {
+		got = append(got, b.Status)
+	}
+	if diff := cmp.Diff([]int{http.StatusUnsupportedMediaType, http.StatusBadRequest}, got); diff != "" {
+		t.Errorf("statuses mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServer_WaitForMessages(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+
+		for _, body := range []string{`{"messages":["a"]}`, `{"messages":["b","c"]}`} {
+			resp, err := http.Post(s.URL, codec.JSON.ContentType(), bytes.NewReader([]byte(body)))
+			if err != nil {
+				t.Errorf("failed to post: %v", err)
+				return
+			}
+			_ = resp.Body.Close()
+		}
+	}()
+
+	got := s.WaitForMessages(t, 3, time.Second)
+
+	if diff := cmp.Diff([]string{"a", "b", "c"}, got); diff != "" {
+		t.Errorf("WaitForMessages() mismatch (-want +got):\n%s", diff)
+	}
+
+	s.Reset()
+
+	if diff := cmp.Diff(0, s.Requests()); diff != "" {
+		t.Errorf("Requests() after Reset() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -1,62 +1,309 @@
 package notifier
 
 import (
+	"golang.org/x/time/rate"
+
+	"notifier/errs"
 	"notifier/log"
 	"notifier/log/tag"
 )
 
 // Notify is semi async func that will be locked if inputChan is full
 func (n *Notifier) Notify(msg string) bool {
+	return n.push(n.pick(), msg, true)
+}
+
+// NotifyBytes is Notify for payloads that are already bytes. msg is copied, so it may be reused after the call.
+func (n *Notifier) NotifyBytes(msg []byte) bool {
+	return n.Notify(string(msg))
+}
+
+// NotifyKey is Notify that delivers messages with the same key in order if ordering is OrderingKey.
+// Messages sent with Notify have no key and are spread over lanes, so they are not ordered in that mode.
+func (n *Notifier) NotifyKey(key, msg string) bool {
+	return n.push(n.laneOf(key), msg, true)
+}
+
+// NotifyBatch is Notify for many messages. They go to the same Aggregator in order, with the ring input queue
+// they are enqueued at once. It's locked while the input queue is full. Messages the transformers fail on
+// are dropped, the rest are sent and false is returned then.
+func (n *Notifier) NotifyBatch(msgs []string) bool {
+	if len(msgs) == 0 {
+		return true
+	}
+
+	// read lock prevents Stop from closing inputChan while messages are being sent
+	n.inputMu.RLock()
+	defer n.inputMu.RUnlock()
+
 	if n.isInputChanLocked.Load() {
-		log.Warn("Dropping message: inputChan is closed. Graceful shutdown in progress...", tag.Msg, msg)
+		n.log.Warn("Dropping messages: inputChan is closed. Graceful shutdown in progress...", tag.Msgs, len(msgs))
 		return false
 	}
 
-	n.inputChan <- msg
+	msgs, ok := n.transformBatch(msgs)
+	if len(msgs) == 0 {
+		return ok
+	}
 
-	return true
+	size := 0
+	for _, msg := range msgs {
+		size += len(msg)
+	}
+
+	if !n.acquire(size, true) {
+		n.log.Warn("Dropping messages: memory budget is exhausted", tag.Msgs, len(msgs))
+		return false
+	}
+
+	l := n.pick()
+	if l.ring != nil {
+		return l.ring.PushBatch(msgs) && ok
+	}
+
+	for _, msg := range msgs {
+		l.inputChan <- msg
+	}
+
+	return ok
 }
 
-// NotifyAndForget drops messages if inputChan is full
+// NotifyAndForget drops messages if inputChan is full or the memory budget is exhausted
 func (n *Notifier) NotifyAndForget(msg string) bool {
+	return n.push(n.pick(), msg, false)
+}
+
+// Redact returns msg without personal data according to the redaction rules, e.g. to log it or to use it
+// in metrics. msg is returned as is without rules.
+func (n *Notifier) Redact(msg string) string {
+	return n.redactor.Redact(msg)
+}
+
+// Logger returns the logger of the Notifier. Its lines have tags of the Notifier, e.g. its name and destination.
+func (n *Notifier) Logger() log.Logger {
+	return n.log
+}
+
+// MemoryUsage returns the number of bytes held by messages that are not yet delivered or dropped:
+// queued, collected into batches, being sent or waiting for retries. It's counted without a memory budget too.
+func (n *Notifier) MemoryUsage() int {
+	return n.budget.Used()
+}
+
+func (n *Notifier) push(l *lane, msg string, wait bool) bool {
+	// read lock prevents Stop from closing inputChan while message is being sent
+	n.inputMu.RLock()
+	defer n.inputMu.RUnlock()
+
 	if n.isInputChanLocked.Load() {
-		log.Warn("Dropping message: inputChan is closed. Graceful shutdown in progress...", tag.Msg, msg)
+		n.log.Warn("Dropping message: inputChan is closed. Graceful shutdown in progress...", tag.Msg, n.Redact(msg))
 		return false
 	}
 
-	select {
-	case n.inputChan <- msg:
-		return true
-	default:
-		log.Warn("Dropping message: inputChan is full", tag.Msg, msg)
+	if n.transform != nil {
+		transformed, err := n.transform(msg)
+		if err != nil {
+			n.log.Warn("Dropping message: transformation failed", tag.Msg, n.Redact(msg), tag.Err, err)
+			return false
+		}
+		msg = transformed
+	}
+
+	if !n.acquire(len(msg), wait) {
+		n.log.Warn("Dropping message: memory budget is exhausted", tag.Msg, n.Redact(msg))
 		return false
 	}
+
+	if !l.send(msg, wait) {
+		n.budget.Release(len(msg))
+
+		n.log.Warn("Dropping message: inputChan is full", tag.Msg, n.Redact(msg))
+		return false
+	}
+
+	return true
+}
+
+// transformBatch returns msgs shaped by the transformers. Messages they fail on are dropped and ok is false then.
+// msgs are not modified.
+func (n *Notifier) transformBatch(msgs []string) (transformed []string, ok bool) {
+	if n.transform == nil {
+		return msgs, true
+	}
+
+	ok = true
+	transformed = make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		msg, err := n.transform(msg)
+		if err != nil {
+			n.log.Warn("Dropping message: transformation failed", tag.Err, err)
+			ok = false
+			continue
+		}
+
+		transformed = append(transformed, msg)
+	}
+
+	return transformed, ok
+}
+
+// acquire reserves size bytes of the memory budget. It waits for them only if wait is set and overflow
+// is OverflowBlock.
+func (n *Notifier) acquire(size int, wait bool) bool {
+	if wait && n.overflow == OverflowBlock {
+		n.budget.Acquire(size)
+		return true
+	}
+
+	return n.budget.TryAcquire(size)
 }
 
 // Start is initialization function of notifier. It's necessary to call.
 // Start spin up Aggregator and worker pool of SendersCount Senders.
 func (n *Notifier) Start() {
-	n.wg.Add(1)
-	go func() {
-		defer n.wg.Done()
-		n.aggregator.Handle()
-	}()
+	n.mu.Lock()
+	defer n.mu.Unlock()
 
-	for i := 0; i < n.sendersCount; i++ {
+	n.isStarted = true
+
+	for _, l := range n.lanes {
 		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
 
-		go func(id int) {
+			if l.streamer != nil {
+				l.streamer.Handle()
+				return
+			}
+			l.aggregator.Handle()
+		}()
+	}
+	for _, p := range n.pools {
+		n.wg.Add(1)
+		go func() {
 			defer n.wg.Done()
+			p.sender.RunRetries()
+		}()
+	}
 
-			n.sender.Run(id)
-		}(i)
+	n.resizeSenders(n.options.SendersCount)
+}
+
+// Reconfigure applies new settings to the running Notifier without restart.
+// FlushInterval and BatchSize are applied by Aggregator, SendersCount resizes the worker pool
+// and RPS updates the rate limiter. Zero fields keep the current settings.
+// InputChanSize and OutputChanSize cannot be changed at runtime, FlushInterval and BatchSize cannot be set
+// with stream delivery, which has no Aggregators.
+func (n *Notifier) Reconfigure(opt Options) error {
+	if opt.InputChanSize < 0 || opt.OutputChanSize < 0 || opt.BatchSize < 0 ||
+		opt.SendersCount < 0 || opt.FlushInterval < 0 || opt.RPS < 0 {
+		return errs.Wrap(errs.ErrValidation, "options must not be negative")
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.isInputChanLocked.Load() {
+		return errs.Wrap(errs.ErrValidation, "notifier is stopped")
+	}
+
+	if opt.InputChanSize != 0 && opt.InputChanSize != n.options.InputChanSize {
+		return errs.Wrap(errs.ErrValidation, "InputChanSize cannot be changed at runtime")
+	}
+	if opt.OutputChanSize != 0 && opt.OutputChanSize != n.options.OutputChanSize {
+		return errs.Wrap(errs.ErrValidation, "OutputChanSize cannot be changed at runtime")
+	}
+	if opt.RPS != 0 && n.limiter == nil {
+		return errs.Wrap(errs.ErrValidation, "notifier has no rate limiter")
+	}
+	if opt.SendersCount != 0 && opt.SendersCount != n.options.SendersCount && n.ordering != OrderingNone {
+		return errs.Wrap(errs.ErrValidation, "SendersCount cannot be changed at runtime with ordering")
+	}
+	if (opt.BatchSize != 0 || opt.FlushInterval != 0) && n.lanes[0].streamer != nil {
+		return errs.Wrap(errs.ErrValidation, "BatchSize and FlushInterval cannot be set with stream delivery")
+	}
+
+	for _, l := range n.lanes {
+		if l.aggregator != nil {
+			l.aggregator.Reconfigure(opt.BatchSize, opt.FlushInterval)
+		}
+	}
+	if opt.BatchSize != 0 {
+		n.options.BatchSize = opt.BatchSize
+	}
+	if opt.FlushInterval != 0 {
+		n.options.FlushInterval = opt.FlushInterval
+	}
+
+	if opt.RPS != 0 {
+		n.limiter.SetLimit(rate.Limit(opt.RPS))
+		n.limiter.SetBurst(opt.RPS)
+		n.options.RPS = opt.RPS
+	}
+
+	if opt.SendersCount != 0 {
+		n.options.SendersCount = opt.SendersCount
+		if n.isStarted {
+			n.resizeSenders(opt.SendersCount)
+		}
+	}
+
+	n.log.Debug(
+		"Notifier: reconfigured",
+		"batch_size_b", n.options.BatchSize, "flush_period_ms", n.options.FlushInterval.Milliseconds(),
+		"senders", n.options.SendersCount, "rps", n.options.RPS,
+	)
+
+	return nil
+}
+
+// resizeSenders spins up or stops Senders to have exactly count of them. With ordering every pool has
+// a single sender instead. n.mu must be held.
+func (n *Notifier) resizeSenders(count int) {
+	if n.ordering != OrderingNone {
+		count = 1
+	}
+
+	for _, p := range n.pools {
+		for len(p.senderStops) < count {
+			stop := make(chan struct{})
+			p.senderStops = append(p.senderStops, stop)
+
+			id := n.senderIDs
+			n.senderIDs++
+
+			n.wg.Add(1)
+			go func() {
+				defer n.wg.Done()
+
+				p.sender.Run(id, stop)
+			}()
+		}
+
+		for len(p.senderStops) > count {
+			last := len(p.senderStops) - 1
+			close(p.senderStops[last])
+			p.senderStops = p.senderStops[:last]
+		}
 	}
 }
 
 // Stop initiates a graceful shutdown mechanism. It's required to call to finish notifier gracefully.
 func (n *Notifier) Stop() {
-	log.Debug("Notifier: Graceful shutdown in progress...")
+	n.log.Debug("Notifier: Graceful shutdown in progress...")
+	n.mu.Lock()
+	n.inputMu.Lock()
 	n.isInputChanLocked.Store(true)
-	close(n.inputChan)
+	for _, l := range n.lanes {
+		if l.ring != nil {
+			l.ring.Close()
+			continue
+		}
+
+		close(l.inputChan)
+	}
+	n.inputMu.Unlock()
+	n.mu.Unlock()
+
 	n.wg.Wait()
 }
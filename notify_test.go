@@ -1,41 +1,44 @@
 package notifier
 
 import (
-	"io"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"net/http/httptest"
-	"sync/atomic"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"notifier/client"
+	"notifier/clock"
+	"notifier/codec"
+	"notifier/errs"
 	"notifier/log"
+	"notifier/log/tag"
+	"notifier/notifiertest"
+	"notifier/redact"
+	"notifier/signature"
+	"notifier/transform"
 )
 
 func TestNotifier_End_To_End(t *testing.T) {
 	t.Parallel()
 
-	var requestCount int32
+	server := notifiertest.NewServer(t)
+	server.SetDefault(notifiertest.Latency(100 * time.Millisecond))
 
-	receivedBody := ""
-
-	server := httptest.NewServer(
-		http.HandlerFunc(
-			func(w http.ResponseWriter, r *http.Request) {
-				time.Sleep(100 * time.Millisecond)
-				// Read body to verify content
-				bodyBytes, _ := io.ReadAll(r.Body)
-				receivedBody = string(bodyBytes)
-
-				atomic.AddInt32(&requestCount, 1)
-				w.WriteHeader(http.StatusOK)
-			},
-		),
-	)
-	defer server.Close()
-
-	n := Default(server.URL)
+	n, err := Default(server.URL)
+	if err != nil {
+		t.Fatalf("Default() error = %v", err)
+	}
 
 	n.Start()
 
@@ -43,30 +46,27 @@ func TestNotifier_End_To_End(t *testing.T) {
 	n.Notify(testMsg)
 	n.Stop()
 
-	if diff := cmp.Diff(atomic.LoadInt32(&requestCount), int32(1)); diff != "" {
+	if diff := cmp.Diff(1, server.Requests()); diff != "" {
 		t.Errorf("Request count mismatch (-want +got):\n%s", diff)
 	}
 
-	if diff := cmp.Diff(`{"messages":["hello_world_integration"]}`, receivedBody); diff != "" {
-		t.Errorf("Body missmatch (-want +got):\n%s", diff)
+	server.AssertDelivered(t, testMsg)
+
+	if diff := cmp.Diff(codec.JSON.Name(), server.Batches()[0].Codec); diff != "" {
+		t.Errorf("Codec missmatch (-want +got):\n%s", diff)
 	}
 }
 
 func TestNotifier_Notify_No_Panic_After_Stop(t *testing.T) {
 	t.Parallel()
 
-	server := httptest.NewServer(
-		http.HandlerFunc(
-			func(w http.ResponseWriter, r *http.Request) {
-				time.Sleep(100 * time.Millisecond)
+	server := notifiertest.NewServer(t)
+	server.SetDefault(notifiertest.Latency(100 * time.Millisecond))
 
-				w.WriteHeader(http.StatusOK)
-			},
-		),
-	)
-	defer server.Close()
-
-	n := Default(server.URL)
+	n, err := Default(server.URL)
+	if err != nil {
+		t.Fatalf("Default() error = %v", err)
+	}
 
 	n.Start()
 
@@ -92,3 +92,1095 @@ func TestNotifier_Notify_No_Panic_After_Stop(t *testing.T) {
 
 	n.Stop()
 }
+
+func TestNotifier_Reconfigure(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	n, err := Default(server.URL, Options{FlushInterval: time.Hour, SendersCount: 1})
+	if err != nil {
+		t.Fatalf("Default() error = %v", err)
+	}
+
+	n.Start()
+
+	err = n.Reconfigure(Options{FlushInterval: 50 * time.Millisecond, SendersCount: 5, RPS: 10})
+	if err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+
+	if diff := cmp.Diff(5, len(n.pools[0].senderStops)); diff != "" {
+		t.Errorf("senders count mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(10, n.limiter.Burst()); diff != "" {
+		t.Errorf("limiter burst mismatch (-want +got):\n%s", diff)
+	}
+
+	n.Notify("hello")
+
+	// flushed by the new interval
+	server.WaitForMessages(t, 1, time.Second)
+
+	if err = n.Reconfigure(Options{SendersCount: 2}); err != nil {
+		t.Fatalf("Reconfigure() error = %v", err)
+	}
+
+	if diff := cmp.Diff(2, len(n.pools[0].senderStops)); diff != "" {
+		t.Errorf("senders count mismatch (-want +got):\n%s", diff)
+	}
+
+	n.Stop()
+
+	if err = n.Reconfigure(Options{SendersCount: 2}); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Reconfigure() after Stop() error = %v, want %v", err, errs.ErrValidation)
+	}
+}
+
+func TestNotifier_Reconfigure_Sender_IDs(t *testing.T) {
+	t.Parallel()
+
+	var buf syncBuffer
+	n, err := New(
+		"http://localhost", WithSenders(2),
+		WithLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	for _, count := range []int{1, 3} {
+		if err = n.Reconfigure(Options{SendersCount: count}); err != nil {
+			t.Fatalf("Reconfigure() error = %v", err)
+		}
+	}
+	n.Stop()
+
+	// Senders stopped by a resize may still finish their batches, so new ones never reuse their IDs
+	var ids []float64
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var line map[string]any
+		if err = json.Unmarshal([]byte(l), &line); err != nil {
+			t.Fatalf("log line %s: %v", l, err)
+		}
+		if line[slog.MessageKey] == "sender started" {
+			ids = append(ids, line[tag.ID].(float64))
+		}
+	}
+
+	slices.Sort(ids)
+	if diff := cmp.Diff([]float64{0, 1, 2, 3}, ids); diff != "" {
+		t.Errorf("sender IDs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifier_Reconfigure_Validation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts []Option
+		opt  Options
+	}{
+		{
+			name: "negative_batch_size",
+			opt:  Options{BatchSize: -1},
+		},
+		{
+			name: "changed_input_chan_size",
+			opt:  Options{InputChanSize: DefaultInputChanSize + 1},
+		},
+		{
+			name: "changed_output_chan_size",
+			opt:  Options{OutputChanSize: DefaultOutputChanSize + 1},
+		},
+		{
+			name: "batch_size_with_streaming",
+			opts: []Option{WithStreaming(DefaultStreamMaxBytes, DefaultStreamMaxAge)},
+			opt:  Options{BatchSize: 1024},
+		},
+		{
+			name: "flush_interval_with_streaming",
+			opts: []Option{WithStreaming(DefaultStreamMaxBytes, DefaultStreamMaxAge)},
+			opt:  Options{FlushInterval: time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				n, err := New("http://localhost", tt.opts...)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				if err = n.Reconfigure(tt.opt); !errors.Is(err, errs.ErrValidation) {
+					t.Errorf("Reconfigure() error = %v, want %v", err, errs.ErrValidation)
+				}
+			},
+		)
+	}
+}
+
+func TestNotifier_Retries_Failed_Requests(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.Script(notifiertest.Fail(http.StatusServiceUnavailable), notifiertest.Fail(http.StatusBadGateway))
+
+	n, err := New(server.URL, WithRetry(3, time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	if diff := cmp.Diff(3, server.Requests()); diff != "" {
+		t.Errorf("Request count mismatch (-want +got):\n%s", diff)
+	}
+
+	server.AssertDelivered(t, "hello")
+}
+
+func TestNotifier_Stop_Caps_Retry_After(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.Script(notifiertest.Throttle(time.Hour))
+
+	cfg := DefaultConfig()
+	cfg.URL = server.URL
+	cfg.FlushInterval = 10 * time.Millisecond
+	cfg.RetryAfterMax = 50 * time.Millisecond
+
+	n, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		n.Stop()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() waits for the whole Retry-After")
+	}
+
+	if diff := cmp.Diff(2, server.Requests()); diff != "" {
+		t.Errorf("Request count mismatch (-want +got):\n%s", diff)
+	}
+	server.AssertDelivered(t, "hello")
+}
+
+func TestNotifier_Failure_Handler(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.SetDefault(notifiertest.Response{Status: http.StatusBadRequest, Body: `{"error":"bad payload"}`})
+
+	var (
+		failedMsgs []string
+		failedErr  error
+	)
+
+	n, err := New(
+		server.URL,
+		WithFailureHandler(
+			func(msgs []string, err error) {
+				failedMsgs = msgs
+				failedErr = err
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	if diff := cmp.Diff([]string{"hello"}, failedMsgs); diff != "" {
+		t.Errorf("failed messages mismatch (-want +got):\n%s", diff)
+	}
+
+	if !errors.Is(failedErr, errs.ErrValidation) {
+		t.Errorf("failure error = %v, want %v", failedErr, errs.ErrValidation)
+	}
+
+	if !errors.Is(failedErr, errs.ErrPermanent) {
+		t.Errorf("failure error = %v, want %v", failedErr, errs.ErrPermanent)
+	}
+
+	var derr *errs.DeliveryError
+	if !errors.As(failedErr, &derr) {
+		t.Fatalf("failure error = %T, want *errs.DeliveryError", failedErr)
+	}
+
+	want := errs.DeliveryError{
+		StatusCode: http.StatusBadRequest,
+		Body:       `{"error":"bad payload"}`,
+		Attempts:   1,
+		BatchID:    server.Batches()[0].Header.Get(HeaderBatchID),
+		Class:      errs.ClassPermanent,
+	}
+	if diff := cmp.Diff(want, *derr, cmpopts.IgnoreFields(errs.DeliveryError{}, "Header", "Err")); diff != "" {
+		t.Errorf("delivery error mismatch (-want +got):\n%s", diff)
+	}
+
+	if want.BatchID == "" {
+		t.Error("batch ID header is not sent")
+	}
+}
+
+func TestNotifier_With_Clock(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	n, err := New(server.URL, WithClock(clk), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	defer n.Stop()
+
+	n.Notify("hello")
+
+	// the flush timer is armed
+	clk.BlockUntil(1)
+	clk.Advance(time.Hour)
+
+	if diff := cmp.Diff([]string{"hello"}, server.WaitForMessages(t, 1, time.Second)); diff != "" {
+		t.Errorf("messages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifier_Delivers_Through_Faults(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	faulty, err := client.NewFaultClient(
+		client.NewDefaultHTTPClient(resty.New().SetBaseURL(server.URL), nil),
+		client.Faults{
+			Seed:                1,
+			ResetProbability:    0.2,
+			Statuses:            []client.StatusFault{{Status: http.StatusServiceUnavailable, Probability: 0.3}},
+			TruncateProbability: 0.1,
+			Latency:             client.UniformLatency(0, time.Millisecond),
+		},
+	)
+	if err != nil {
+		t.Fatalf("NewFaultClient() error = %v", err)
+	}
+
+	n, err := New(
+		server.URL,
+		WithHTTPClient(faulty),
+		WithBatchSize(10),
+		WithRetry(50, time.Millisecond, 5*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+
+	want := make([]string, 0, 20)
+	for i := 0; i < 20; i++ {
+		msg := fmt.Sprintf("msg_%02d", i)
+		want = append(want, msg)
+		n.Notify(msg)
+	}
+
+	n.Stop()
+
+	// delivery is at least once
+	delivered := make(map[string]bool)
+	for _, msg := range server.Messages() {
+		delivered[msg] = true
+	}
+
+	for _, msg := range want {
+		if !delivered[msg] {
+			t.Errorf("message %q was not delivered", msg)
+		}
+	}
+
+	if stats := faulty.Stats(); stats.Resets+stats.Statuses+stats.Truncated == 0 {
+		t.Errorf("no faults were injected: %+v", stats)
+	}
+}
+
+func TestNotifier_Signs_Requests(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	n, err := New(server.URL, WithSigningSecret("secret"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	batches := server.Batches()
+	if len(batches) != 1 {
+		t.Fatalf("got %d batches, want 1", len(batches))
+	}
+
+	err = signature.Verify(batches[0].Header, []byte("secret"), time.Now(), signature.DefaultTolerance, batches[0].Body)
+	if err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestNotifier_Success_Handler(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.Script(notifiertest.Fail(http.StatusServiceUnavailable))
+
+	var (
+		mu        sync.Mutex
+		delivered []string
+	)
+
+	n, err := New(
+		server.URL,
+		WithRetry(3, time.Millisecond, 10*time.Millisecond),
+		WithSuccessHandler(
+			func(msgs []string) {
+				mu.Lock()
+				defer mu.Unlock()
+				delivered = append(delivered, msgs...)
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	// called once after the retry succeeded
+	if diff := cmp.Diff([]string{"hello"}, delivered); diff != "" {
+		t.Errorf("delivered messages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifier_Retries_Rejected_Messages(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.Script(notifiertest.Response{Body: `{"failed":[1]}`})
+
+	var (
+		mu        sync.Mutex
+		delivered [][]string
+	)
+
+	n, err := New(
+		server.URL,
+		WithFlushInterval(time.Hour),
+		WithRetry(3, time.Millisecond, 10*time.Millisecond),
+		WithResponseParser(client.RejectedIndexes("failed")),
+		WithSuccessHandler(
+			func(msgs []string) {
+				mu.Lock()
+				defer mu.Unlock()
+				delivered = append(delivered, msgs)
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("a")
+	n.Notify("b")
+	n.Notify("c")
+	n.Stop()
+
+	var sent [][]string
+	for _, b := range server.Batches() {
+		sent = append(sent, b.Messages)
+	}
+
+	// only the rejected message is sent again
+	if diff := cmp.Diff([][]string{{"a", "b", "c"}, {"b"}}, sent); diff != "" {
+		t.Errorf("sent batches mismatch (-want +got):\n%s", diff)
+	}
+
+	// the retry has different content, so it has a derived ID
+	batches := server.Batches()
+	wantID := batches[0].Header.Get(HeaderBatchID) + ".r1"
+	if diff := cmp.Diff(wantID, batches[1].Header.Get(HeaderBatchID)); diff != "" {
+		t.Errorf("batch ID of the retry mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([][]string{{"a", "c"}, {"b"}}, delivered); diff != "" {
+		t.Errorf("delivered messages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifier_Reports_Rejected_Messages(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.SetDefault(notifiertest.Response{Body: `{"failed":[0]}`})
+
+	var (
+		mu      sync.Mutex
+		failed  []string
+		gotErr  error
+		success []string
+	)
+
+	n, err := New(
+		server.URL,
+		WithFlushInterval(time.Hour),
+		WithRetry(1, time.Millisecond, 10*time.Millisecond),
+		WithResponseParser(client.RejectedIndexes("failed")),
+		WithSuccessHandler(
+			func(msgs []string) {
+				mu.Lock()
+				defer mu.Unlock()
+				success = append(success, msgs...)
+			},
+		),
+		WithFailureHandler(
+			func(msgs []string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				failed = append(failed, msgs...)
+				gotErr = err
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("a")
+	n.Notify("b")
+	n.Stop()
+
+	if diff := cmp.Diff([]string{"b"}, success); diff != "" {
+		t.Errorf("delivered messages mismatch (-want +got):\n%s", diff)
+	}
+
+	// the rejected message is tried twice before it's reported
+	if diff := cmp.Diff([]string{"a"}, failed); diff != "" {
+		t.Errorf("failed messages mismatch (-want +got):\n%s", diff)
+	}
+
+	if !errors.Is(gotErr, errs.ErrPartial) || !errors.Is(gotErr, errs.ErrRetryable) {
+		t.Errorf("failure error = %v, want errs.ErrPartial and errs.ErrRetryable", gotErr)
+	}
+}
+
+func TestNotifier_Splits_Too_Large_Batches(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.Script(notifiertest.Fail(http.StatusRequestEntityTooLarge))
+
+	n, err := New(server.URL, WithFlushInterval(time.Hour), WithRetry(0, time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("a")
+	n.Notify("b")
+	n.Notify("c")
+	n.Stop()
+
+	// the rejected batch is sent again in halves even without retries
+	if diff := cmp.Diff(3, server.Requests()); diff != "" {
+		t.Errorf("requests mismatch (-want +got):\n%s", diff)
+	}
+	server.AssertDelivered(t, "a", "b", "c")
+}
+
+func TestNotifier_Ordering(t *testing.T) {
+	t.Parallel()
+
+	keys := []string{"a", "b", "c", "d"}
+
+	tests := []struct {
+		name     string
+		ordering string
+		keys     []string
+	}{
+		{name: "global", ordering: OrderingGlobal, keys: []string{""}},
+		{name: "key", ordering: OrderingKey, keys: keys},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				server := notifiertest.NewServer(t)
+				// failed batches would be overtaken by the next ones without ordering
+				server.Script(
+					notifiertest.Fail(http.StatusServiceUnavailable),
+					notifiertest.Fail(http.StatusServiceUnavailable),
+					notifiertest.Response{},
+					notifiertest.Fail(http.StatusServiceUnavailable),
+				)
+
+				n, err := New(
+					server.URL,
+					WithOrdering(tt.ordering),
+					WithSenders(4),
+					// a message per batch
+					WithBatchSize(4),
+					WithRetry(5, time.Millisecond, 5*time.Millisecond),
+				)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				want := make(map[string][]string)
+
+				n.Start()
+				for i := range 20 {
+					for _, key := range tt.keys {
+						msg := fmt.Sprintf("%s%02d", key, i)
+
+						want[key] = append(want[key], msg)
+						n.NotifyKey(key, msg)
+					}
+				}
+				n.Stop()
+
+				got := make(map[string][]string)
+				for _, msg := range server.Messages() {
+					key := strings.TrimRight(msg, "0123456789")
+					got[key] = append(got[key], msg)
+				}
+
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Errorf("delivered messages mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestNotifier_With_Aggregator_Shards(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	n, err := New(server.URL, WithAggregatorShards(4), WithSenders(2), WithBatchSize(16))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if diff := cmp.Diff(4, len(n.lanes)); diff != "" {
+		t.Errorf("lanes mismatch (-want +got):\n%s", diff)
+	}
+
+	var want []string
+
+	n.Start()
+	for i := range 100 {
+		msg := fmt.Sprintf("msg%02d", i)
+		want = append(want, msg)
+
+		if i%2 == 0 {
+			n.Notify(msg)
+		} else {
+			n.NotifyKey(msg, msg)
+		}
+	}
+	n.Stop()
+
+	server.AssertDelivered(t, want...)
+}
+
+func TestNotifier_NotifyBatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		queue         string
+		inputChanSize int
+	}{
+		{name: "channel", queue: InputQueueChannel, inputChanSize: 8},
+		{name: "ring", queue: InputQueueRing, inputChanSize: 8},
+		{name: "ring_size_zero", queue: InputQueueRing},
+		{name: "ring_size_one", queue: InputQueueRing, inputChanSize: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				server := notifiertest.NewServer(t)
+
+				// the batch is longer than the input queue, so NotifyBatch waits for the Aggregator
+				n, err := New(
+					server.URL, WithInputQueue(tt.queue), WithAggregatorShards(2),
+					WithInputChanSize(tt.inputChanSize), WithBatchSize(64),
+				)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				msgs := make([]string, 0, 50)
+				for i := range 50 {
+					msgs = append(msgs, fmt.Sprintf("msg%02d", i))
+				}
+
+				n.Start()
+				if !n.NotifyBatch(msgs) {
+					t.Error("NotifyBatch() = false")
+				}
+				if !n.Notify("last") {
+					t.Error("Notify() = false")
+				}
+				n.Stop()
+
+				if n.NotifyBatch(msgs) {
+					t.Error("NotifyBatch() after Stop = true")
+				}
+
+				server.AssertDelivered(t, append(msgs, "last")...)
+			},
+		)
+	}
+}
+
+func TestNotifier_NotifyBytes(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	n, err := New(server.URL, WithEncoder(codec.NDJSON))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// the buffer is reused for every message
+	var buf []byte
+
+	n.Start()
+	for _, msg := range []string{`{"id":1}`, "<b>bold</b> & \"quoted\""} {
+		buf = append(buf[:0], msg...)
+		if !n.NotifyBytes(buf) {
+			t.Errorf("NotifyBytes(%q) = false", msg)
+		}
+	}
+	clear(buf)
+	n.Stop()
+
+	server.AssertDelivered(t, `{"id":1}`, "<b>bold</b> & \"quoted\"")
+}
+
+func TestNotifier_Memory_Budget(t *testing.T) {
+	t.Parallel()
+
+	t.Run(
+		"drop", func(t *testing.T) {
+			t.Parallel()
+
+			server := notifiertest.NewServer(t)
+			clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+			n, err := New(server.URL, WithClock(clk), WithFlushInterval(time.Hour), WithMemoryBudget(10, OverflowDrop))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			n.Start()
+
+			// messages are held in the batch until the flush timer fires
+			got := []bool{n.Notify("12345"), n.Notify("67890"), n.Notify("x"), n.NotifyAndForget("y")}
+			if diff := cmp.Diff([]bool{true, true, false, false}, got); diff != "" {
+				t.Errorf("Notify() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(10, n.MemoryUsage()); diff != "" {
+				t.Errorf("MemoryUsage() mismatch (-want +got):\n%s", diff)
+			}
+
+			clk.BlockUntil(1)
+			clk.Advance(time.Hour)
+			server.WaitForMessages(t, 2, time.Second)
+			n.Stop()
+
+			server.AssertDelivered(t, "12345", "67890")
+			if diff := cmp.Diff(0, n.MemoryUsage()); diff != "" {
+				t.Errorf("MemoryUsage() after Stop mismatch (-want +got):\n%s", diff)
+			}
+		},
+	)
+
+	t.Run(
+		"block", func(t *testing.T) {
+			t.Parallel()
+
+			server := notifiertest.NewServer(t)
+			clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+			n, err := New(server.URL, WithClock(clk), WithFlushInterval(time.Hour), WithMemoryBudget(5, OverflowBlock))
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			n.Start()
+			n.Notify("12345")
+
+			notified := make(chan bool)
+			go func() {
+				notified <- n.Notify("abc")
+			}()
+
+			select {
+			case <-notified:
+				t.Fatal("Notify() returned while the memory budget is exhausted")
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			// delivery of the first message frees the budget
+			clk.BlockUntil(1)
+			clk.Advance(time.Hour)
+
+			if !<-notified {
+				t.Error("Notify() = false")
+			}
+			n.Stop()
+
+			server.AssertDelivered(t, "12345", "abc")
+		},
+	)
+}
+
+func TestNotifier_Streaming(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "accepted", status: http.StatusOK},
+		// messages of failed streams are posted as batches, which fail too
+		{name: "failed", status: http.StatusBadRequest, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				server := notifiertest.NewServer(t)
+				server.SetDefault(notifiertest.Response{Status: tt.status})
+
+				var (
+					mu        sync.Mutex
+					delivered []string
+					failed    []string
+				)
+
+				// the flush interval is never reached, streams are rotated by size
+				n, err := New(
+					server.URL, WithStreaming(16, time.Second), WithFlushInterval(time.Hour), WithAggregatorShards(2),
+					WithSuccessHandler(
+						func(msgs []string) {
+							mu.Lock()
+							defer mu.Unlock()
+
+							delivered = append(delivered, msgs...)
+						},
+					),
+					WithFailureHandler(
+						func(msgs []string, _ error) {
+							mu.Lock()
+							defer mu.Unlock()
+
+							failed = append(failed, msgs...)
+						},
+					),
+				)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				var want []string
+				n.Start()
+				for i := range 10 {
+					msg := fmt.Sprintf("msg%d", i)
+					want = append(want, msg)
+					n.Notify(msg)
+				}
+				if !tt.wantErr {
+					// 2 shards write 3 lines of 7 bytes into a stream before it's rotated, the rest is sent on Stop
+					server.WaitForMessages(t, 6, time.Second)
+				}
+				n.Stop()
+
+				got := delivered
+				if tt.wantErr {
+					got = failed
+				}
+				if diff := cmp.Diff(want, got, cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+					t.Errorf("reported messages mismatch (-want +got):\n%s", diff)
+				}
+
+				for _, b := range server.Batches() {
+					if diff := cmp.Diff(codec.NDJSON.Name(), b.Codec); diff != "" {
+						t.Errorf("codec mismatch (-want +got):\n%s", diff)
+					}
+				}
+				if diff := cmp.Diff(0, n.MemoryUsage()); diff != "" {
+					t.Errorf("MemoryUsage() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestNotifier_GRPC_Transport(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewGRPCServer(t)
+	// the first call fails with Unavailable and is retried
+	server.Script(notifiertest.Fail(http.StatusServiceUnavailable))
+
+	cfg := DefaultConfig()
+	cfg.URL = server.URL
+	cfg.Transport = TransportGRPC
+	cfg.FlushInterval = 10 * time.Millisecond
+	cfg.RetryDelay = time.Millisecond
+	cfg.Headers = map[string]string{"X-Source": "test"}
+
+	n, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewFromConfig() error = %v", err)
+	}
+
+	n.Start()
+	n.NotifyBatch([]string{"msg1", `{"id":2}`})
+	server.WaitForMessages(t, 2, time.Second)
+	n.Stop()
+
+	server.AssertDelivered(t, "msg1", `{"id":2}`)
+
+	batches := server.Batches()
+	if diff := cmp.Diff(2, len(batches)); diff != "" {
+		t.Fatalf("calls mismatch (-want +got):\n%s", diff)
+	}
+	for _, b := range batches {
+		if diff := cmp.Diff("grpc", b.Codec); diff != "" {
+			t.Errorf("codec mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff("test", b.Header.Get("X-Source")); diff != "" {
+			t.Errorf("metadata mismatch (-want +got):\n%s", diff)
+		}
+	}
+	if diff := cmp.Diff(batches[0].Header.Get(HeaderBatchID), batches[1].Header.Get(HeaderBatchID)); diff != "" {
+		t.Errorf("retried call has another batch ID (-first +retry):\n%s", diff)
+	}
+}
+
+func TestNotifier_Transformers(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	n, err := New(
+		server.URL, WithFlushInterval(10*time.Millisecond),
+		WithTransformer(transform.Rename(map[string]string{"msg": "text"})),
+		WithTransformer(
+			func(msg string) (string, error) {
+				if strings.Contains(msg, "secret") {
+					return "", errors.New("secret")
+				}
+				return msg, nil
+			},
+		),
+		// the template is applied after transformers
+		WithTemplate(`{"channel":"ops","text":{{json .text}}}`),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	if !n.Notify(`{"msg":"disk is full"}`) {
+		t.Error("Notify() = false, want true")
+	}
+	if n.Notify(`{"msg":"secret"}`) {
+		t.Error("Notify() of failed message = true, want false")
+	}
+	if n.NotifyBatch([]string{`{"msg":"db is down"}`, `{"msg":"secret"}`}) {
+		t.Error("NotifyBatch() with failed message = true, want false")
+	}
+	server.WaitForMessages(t, 2, time.Second)
+	n.Stop()
+
+	server.AssertDelivered(t, `{"channel":"ops","text":"disk is full"}`, `{"channel":"ops","text":"db is down"}`)
+	if diff := cmp.Diff(0, n.MemoryUsage()); diff != "" {
+		t.Errorf("MemoryUsage() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNotifier_Redaction(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		deadLetters bool
+		wantFailed  []string
+	}{
+		{name: "logs_only", wantFailed: []string{`{"email":"bob@example.com"}`}},
+		{name: "dead_letters", deadLetters: true, wantFailed: []string{`{"email":"[REDACTED]"}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				server := notifiertest.NewServer(t)
+				server.SetDefault(notifiertest.Fail(http.StatusBadRequest))
+
+				var (
+					mu     sync.Mutex
+					failed []string
+				)
+				n, err := New(
+					server.URL, WithFlushInterval(10*time.Millisecond),
+					WithRedaction(redact.Config{Fields: []string{"email"}, DeadLetters: tt.deadLetters}),
+					WithFailureHandler(
+						func(msgs []string, _ error) {
+							mu.Lock()
+							defer mu.Unlock()
+
+							failed = append(failed, msgs...)
+						},
+					),
+				)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				if diff := cmp.Diff(`{"email":"[REDACTED]"}`, n.Redact(`{"email":"bob@example.com"}`)); diff != "" {
+					t.Errorf("Redact() mismatch (-want +got):\n%s", diff)
+				}
+
+				n.Start()
+				n.Notify(`{"email":"bob@example.com"}`)
+				n.Stop()
+
+				// the receiver gets messages as is
+				if diff := cmp.Diff([]string{`{"email":"bob@example.com"}`}, server.Batches()[0].Messages); diff != "" {
+					t.Errorf("sent messages mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantFailed, failed); diff != "" {
+					t.Errorf("failed messages mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestNotifier_Logger(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+	server.SetDefault(notifiertest.Fail(http.StatusBadRequest))
+
+	var buf syncBuffer
+	n, err := New(
+		server.URL+"?token=secret", WithFlushInterval(10*time.Millisecond), WithName("billing"),
+		WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	lines := make(map[string]map[string]any)
+	for _, l := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var line map[string]any
+		if err = json.Unmarshal([]byte(l), &line); err != nil {
+			t.Fatalf("log line %s: %v", l, err)
+		}
+		lines[line[slog.MessageKey].(string)] = line
+	}
+
+	want := map[string]any{
+		tag.Notifier:    "billing",
+		tag.Destination: server.URL,
+		tag.BatchID:     server.Batches()[0].Header.Get(HeaderBatchID),
+		tag.Attempt:     float64(1),
+	}
+	for _, msg := range []string{"http: request failed", "sender: dropping msgs"} {
+		line, ok := lines[msg]
+		if !ok {
+			t.Fatalf("%q is not logged, got %v", msg, lines)
+		}
+		if _, ok = line[tag.Latency]; !ok {
+			t.Errorf("%q has no %s", msg, tag.Latency)
+		}
+
+		got := make(map[string]any)
+		for key := range want {
+			got[key] = line[key]
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("%q tags mismatch (-want +got):\n%s", msg, diff)
+		}
+	}
+}
+
+// syncBuffer is bytes.Buffer that loggers of different goroutines can write to.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
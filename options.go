@@ -0,0 +1,488 @@
+package notifier
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"notifier/client"
+	"notifier/clock"
+	"notifier/codec"
+	"notifier/errs"
+	"notifier/log"
+	"notifier/redact"
+	"notifier/retry"
+	"notifier/transform"
+)
+
+// Option configures Notifier created by New. Options return an error for nonsense values.
+type Option func(s *settings) error
+
+// settings are collected from Options before Notifier is built.
+type settings struct {
+	cfg Config
+
+	// encoder overrides cfg.Encoder. It allows using codecs that are not registered by name.
+	encoder      codec.Codec
+	errorHandler client.ErrorHandler
+	// responseParser finds messages rejected in accepted batches
+	responseParser client.ResponseParser
+	httpClient     client.HTTPClient
+	// transport replaces the HTTP client, encoder and response parser
+	transport client.Transport
+	clock     clock.Clock
+	// logger is the base of the Notifier logger, tags are added to it
+	logger log.Logger
+	// retryPolicy overrides retry_* fields of cfg
+	retryPolicy *retry.Policy
+	// transformers shape messages before the template of cfg
+	transformers []transform.Transformer
+	onFailure    FailureHandler
+	onSuccess    SuccessHandler
+}
+
+func invalid(option, msg string) error {
+	return errs.Wrap(errs.ErrValidation, option+": "+msg)
+}
+
+// WithConfig replaces all settings with cfg. It's useful as the first Option followed by overrides.
+func WithConfig(cfg Config) Option {
+	return func(s *settings) error {
+		s.cfg = cfg
+		return nil
+	}
+}
+
+// WithOptions applies non-zero fields of Options. At most one Options is accepted.
+func WithOptions(opt ...Options) Option {
+	return func(s *settings) error {
+		if len(opt) > 1 {
+			return invalid("WithOptions", "expected at most one Options, got "+strconv.Itoa(len(opt)))
+		}
+
+		if len(opt) == 0 {
+			return nil
+		}
+
+		o := opt[0]
+		if o.InputChanSize < 0 || o.OutputChanSize < 0 || o.BatchSize < 0 ||
+			o.SendersCount < 0 || o.FlushInterval < 0 || o.RPS < 0 {
+			return invalid("WithOptions", "options must not be negative")
+		}
+
+		if o.InputChanSize != 0 {
+			s.cfg.InputChanSize = o.InputChanSize
+		}
+		if o.OutputChanSize != 0 {
+			s.cfg.OutputChanSize = o.OutputChanSize
+		}
+		if o.BatchSize != 0 {
+			s.cfg.BatchSizeBytes = o.BatchSize
+		}
+		if o.SendersCount != 0 {
+			s.cfg.SendersCount = o.SendersCount
+		}
+		if o.FlushInterval != 0 {
+			s.cfg.FlushInterval = o.FlushInterval
+		}
+		if o.RPS != 0 {
+			s.cfg.RPS = o.RPS
+		}
+
+		return nil
+	}
+}
+
+// WithInputChanSize sets the size of the channel Notify puts messages into. Zero makes Notify synchronous.
+// The ring of InputQueueRing rounds the size up to a power of two and holds at least 2 messages.
+func WithInputChanSize(size int) Option {
+	return func(s *settings) error {
+		if size < 0 {
+			return invalid("WithInputChanSize", "size must not be negative")
+		}
+
+		s.cfg.InputChanSize = size
+		return nil
+	}
+}
+
+// WithOutputChanSize sets the size of the channel with batches waiting for Senders.
+func WithOutputChanSize(size int) Option {
+	return func(s *settings) error {
+		if size < 0 {
+			return invalid("WithOutputChanSize", "size must not be negative")
+		}
+
+		s.cfg.OutputChanSize = size
+		return nil
+	}
+}
+
+// WithBatchSize sets max size of a batch in bytes.
+func WithBatchSize(sizeBytes int) Option {
+	return func(s *settings) error {
+		if sizeBytes <= 0 {
+			return invalid("WithBatchSize", "size must be positive")
+		}
+
+		s.cfg.BatchSizeBytes = sizeBytes
+		return nil
+	}
+}
+
+// WithFlushInterval sets how often not filled batches are flushed.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(s *settings) error {
+		if interval <= 0 {
+			return invalid("WithFlushInterval", "interval must be positive")
+		}
+
+		s.cfg.FlushInterval = interval
+		return nil
+	}
+}
+
+// WithAggregatorShards runs count Aggregators, each with its own input channel and batch, so Notify doesn't
+// contend on a single channel. Notify spreads messages round-robin, NotifyKey picks a shard by key hash.
+func WithAggregatorShards(count int) Option {
+	return func(s *settings) error {
+		if count <= 0 {
+			return invalid("WithAggregatorShards", "count must be positive")
+		}
+
+		s.cfg.AggregatorShards = count
+		return nil
+	}
+}
+
+// WithInputQueue sets InputQueueChannel or InputQueueRing as the queue between Notify and Aggregators.
+func WithInputQueue(kind string) Option {
+	return func(s *settings) error {
+		switch kind {
+		case InputQueueChannel, InputQueueRing:
+		default:
+			return invalid("WithInputQueue", "unknown queue "+kind)
+		}
+
+		s.cfg.InputQueue = kind
+		return nil
+	}
+}
+
+// WithMemoryBudget limits the size of messages held from Notify until they are delivered or dropped to sizeBytes.
+// overflow is OverflowBlock or OverflowDrop, it's applied when the budget is exhausted.
+func WithMemoryBudget(sizeBytes int, overflow string) Option {
+	return func(s *settings) error {
+		if sizeBytes <= 0 {
+			return invalid("WithMemoryBudget", "size must be positive")
+		}
+
+		switch overflow {
+		case OverflowBlock, OverflowDrop:
+		default:
+			return invalid("WithMemoryBudget", "unknown overflow "+overflow)
+		}
+
+		s.cfg.MemoryBudgetBytes = sizeBytes
+		s.cfg.Overflow = overflow
+		return nil
+	}
+}
+
+// WithStreaming switches to DeliveryStream with ndjson encoder. Streams are rotated after maxBytes or maxAge,
+// which must be less than the HTTP timeout.
+func WithStreaming(maxBytes int, maxAge time.Duration) Option {
+	return func(s *settings) error {
+		if maxBytes <= 0 || maxAge <= 0 {
+			return invalid("WithStreaming", "max bytes and max age must be positive")
+		}
+
+		s.cfg.Delivery = DeliveryStream
+		s.cfg.Encoder = codec.NDJSON.Name()
+		s.cfg.StreamMaxBytes = maxBytes
+		s.cfg.StreamMaxAge = maxAge
+		return nil
+	}
+}
+
+// WithSenders sets the number of Senders that send batches concurrently.
+func WithSenders(count int) Option {
+	return func(s *settings) error {
+		if count <= 0 {
+			return invalid("WithSenders", "count must be positive")
+		}
+
+		s.cfg.SendersCount = count
+		return nil
+	}
+}
+
+// WithHTTPTimeout sets timeout of a single request.
+func WithHTTPTimeout(timeout time.Duration) Option {
+	return func(s *settings) error {
+		if timeout <= 0 {
+			return invalid("WithHTTPTimeout", "timeout must be positive")
+		}
+
+		s.cfg.HTTPTimeout = timeout
+		return nil
+	}
+}
+
+// WithRetry sets how many times failed requests are retried and the backoff between attempts.
+func WithRetry(count int, delay, maxDelay time.Duration) Option {
+	return func(s *settings) error {
+		if count < 0 {
+			return invalid("WithRetry", "count must not be negative")
+		}
+		if delay < 0 || maxDelay < delay {
+			return invalid("WithRetry", "delay must not be negative and must not exceed maxDelay")
+		}
+
+		s.cfg.RetryCount = count
+		s.cfg.RetryDelay = delay
+		s.cfg.RetryMaxDelay = maxDelay
+		return nil
+	}
+}
+
+// WithRetryPolicy sets full retry.Policy, e.g. retryable statuses, max elapsed time or per attempt timeout.
+// Retries are performed by Senders, so they work with any client.HTTPClient.
+func WithRetryPolicy(p retry.Policy) Option {
+	return func(s *settings) error {
+		if err := p.Validate(); err != nil {
+			return errs.Wrap(err, "WithRetryPolicy")
+		}
+
+		s.retryPolicy = &p
+		return nil
+	}
+}
+
+// WithFailureHandler sets handler of messages that were not delivered. Failed batches are re-queued with backoff
+// according to retry policy, h is called once a batch runs out of attempts or max elapsed time.
+func WithFailureHandler(h FailureHandler) Option {
+	return func(s *settings) error {
+		if h == nil {
+			return invalid("WithFailureHandler", "handler is required")
+		}
+
+		s.onFailure = h
+		return nil
+	}
+}
+
+// WithSuccessHandler sets handler of delivered messages.
+func WithSuccessHandler(h SuccessHandler) Option {
+	return func(s *settings) error {
+		if h == nil {
+			return invalid("WithSuccessHandler", "handler is required")
+		}
+
+		s.onSuccess = h
+		return nil
+	}
+}
+
+// WithRateLimit limits requests per second of all Senders.
+func WithRateLimit(rps int) Option {
+	return func(s *settings) error {
+		if rps <= 0 {
+			return invalid("WithRateLimit", "rps must be positive")
+		}
+
+		s.cfg.RPS = rps
+		return nil
+	}
+}
+
+// WithEncoder sets codec that encodes batches into request bodies.
+func WithEncoder(enc codec.Codec) Option {
+	return func(s *settings) error {
+		if enc == nil {
+			return invalid("WithEncoder", "encoder is required")
+		}
+
+		s.encoder = enc
+		s.cfg.Encoder = enc.Name()
+		return nil
+	}
+}
+
+// WithHeader adds header to every request.
+func WithHeader(key, value string) Option {
+	return func(s *settings) error {
+		if http.CanonicalHeaderKey(key) == "" {
+			return invalid("WithHeader", "key is required")
+		}
+
+		headers := make(map[string]string, len(s.cfg.Headers)+1)
+		for k, v := range s.cfg.Headers {
+			headers[k] = v
+		}
+		headers[key] = value
+
+		s.cfg.Headers = headers
+		return nil
+	}
+}
+
+// WithSigningSecret signs every request body with HMAC-SHA256 of secret, see signature package.
+func WithSigningSecret(secret string) Option {
+	return func(s *settings) error {
+		if secret == "" {
+			return invalid("WithSigningSecret", "secret is required")
+		}
+
+		s.cfg.SigningSecret = secret
+		return nil
+	}
+}
+
+// WithOrdering sets one of OrderingNone, OrderingKey or OrderingGlobal modes.
+func WithOrdering(mode string) Option {
+	return func(s *settings) error {
+		switch mode {
+		case OrderingNone, OrderingKey, OrderingGlobal:
+		default:
+			return invalid("WithOrdering", "unknown mode "+mode)
+		}
+
+		s.cfg.Ordering = mode
+		return nil
+	}
+}
+
+// WithErrorHandler sets handler of HTTP responses and errors. It's ignored if WithHTTPClient is used.
+func WithErrorHandler(h client.ErrorHandler) Option {
+	return func(s *settings) error {
+		if h == nil {
+			return invalid("WithErrorHandler", "handler is required")
+		}
+
+		s.errorHandler = h
+		return nil
+	}
+}
+
+// WithResponseParser sets parser of successful responses that report per-message results.
+// Only messages rejected by the receiver are re-queued, the rest are reported as delivered.
+func WithResponseParser(p client.ResponseParser) Option {
+	return func(s *settings) error {
+		if p == nil {
+			return invalid("WithResponseParser", "parser is required")
+		}
+
+		s.responseParser = p
+		return nil
+	}
+}
+
+// WithHTTPClient replaces the resty based client. Timeout is up to c then, rate limit and retries still apply.
+func WithHTTPClient(c client.HTTPClient) Option {
+	return func(s *settings) error {
+		if c == nil {
+			return invalid("WithHTTPClient", "client is required")
+		}
+
+		s.httpClient = c
+		return nil
+	}
+}
+
+// WithTransformer adds t to the transformers that shape messages before they are queued. Transformers are applied
+// in the order they are added, the template of WithTemplate is applied after all of them.
+func WithTransformer(t transform.Transformer) Option {
+	return func(s *settings) error {
+		if t == nil {
+			return invalid("WithTransformer", "transformer is required")
+		}
+
+		s.transformers = append(s.transformers, t)
+		return nil
+	}
+}
+
+// WithTemplate renders every message with text/template text, see transform.Template.
+func WithTemplate(text string) Option {
+	return func(s *settings) error {
+		if _, err := transform.Template(text); err != nil {
+			return invalid("WithTemplate", err.Error())
+		}
+
+		s.cfg.Template = text
+		return nil
+	}
+}
+
+// WithRedaction sets rules that remove personal data from logged messages, see redact.Config.
+func WithRedaction(c redact.Config) Option {
+	return func(s *settings) error {
+		if _, err := redact.New(c); err != nil {
+			return invalid("WithRedaction", err.Error())
+		}
+
+		s.cfg.Redaction = c
+		return nil
+	}
+}
+
+// WithTransport sends batches with t instead of posting them over HTTP. Encoder, headers, signing
+// and the HTTP client are not used then, rate limit and retries still apply. Stream delivery is not supported.
+func WithTransport(t client.Transport) Option {
+	return func(s *settings) error {
+		if t == nil {
+			return invalid("WithTransport", "transport is required")
+		}
+
+		s.transport = t
+		return nil
+	}
+}
+
+// WithLogger sets the logger the Notifier, its Aggregators, Senders and the HTTP client write to. Lines have
+// tag.Destination and tag.Notifier of WithName, lines of batches have tag.BatchID and tag.Attempt too.
+func WithLogger(l log.Logger) Option {
+	return func(s *settings) error {
+		if l == nil {
+			return invalid("WithLogger", "logger is required")
+		}
+
+		s.logger = l
+		return nil
+	}
+}
+
+// WithName sets the name of the Notifier that is added to its log lines.
+func WithName(name string) Option {
+	return func(s *settings) error {
+		s.cfg.Name = name
+		return nil
+	}
+}
+
+// WithLogSampling logs at most burst warnings and errors with the same message per interval.
+// Zero interval logs every line.
+func WithLogSampling(interval time.Duration, burst int) Option {
+	return func(s *settings) error {
+		if interval < 0 || (interval > 0 && burst <= 0) {
+			return invalid("WithLogSampling", "interval must not be negative and burst must be positive")
+		}
+
+		s.cfg.LogSampleInterval = interval
+		s.cfg.LogSampleBurst = burst
+		return nil
+	}
+}
+
+// WithClock sets clock that drives flush interval, retry backoff and rate limiting. It's meant for tests.
+func WithClock(c clock.Clock) Option {
+	return func(s *settings) error {
+		if c == nil {
+			return invalid("WithClock", "clock is required")
+		}
+
+		s.clock = c
+		return nil
+	}
+}
@@ -0,0 +1,333 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/codec"
+	"notifier/errs"
+	"notifier/grpc"
+)
+
+// recordingClient stores bodies and headers of requests instead of sending them.
+type recordingClient struct {
+	mu      sync.Mutex
+	bodies  []string
+	headers []http.Header
+}
+
+func (c *recordingClient) Do(_ context.Context, req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bodies = append(c.bodies, string(body))
+	c.headers = append(c.headers, req.Header)
+
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		want    func(c *Config)
+		wantErr error
+	}{
+		{
+			name: "no_options_keeps_defaults",
+			want: func(c *Config) {},
+		},
+		{
+			name: "all_options_applied",
+			opts: []Option{
+				WithInputChanSize(10),
+				WithOutputChanSize(0),
+				WithBatchSize(100),
+				WithFlushInterval(time.Minute),
+				WithSenders(2),
+				WithHTTPTimeout(time.Second),
+				WithRetry(5, time.Millisecond, time.Second),
+				WithRateLimit(7),
+				WithEncoder(codec.NDJSON),
+				WithHeader("X-A", "1"),
+				WithHeader("X-B", "2"),
+			},
+			want: func(c *Config) {
+				c.InputChanSize = 10
+				c.OutputChanSize = 0
+				c.BatchSizeBytes = 100
+				c.FlushInterval = time.Minute
+				c.SendersCount = 2
+				c.HTTPTimeout = time.Second
+				c.RetryCount = 5
+				c.RetryDelay = time.Millisecond
+				c.RetryMaxDelay = time.Second
+				c.RPS = 7
+				c.Encoder = codec.NDJSON.Name()
+				c.Headers = map[string]string{"X-A": "1", "X-B": "2"}
+			},
+		},
+		{
+			name: "later_options_override_config",
+			opts: []Option{
+				WithConfig(Config{BatchSizeBytes: 1, SendersCount: 1}),
+				WithSenders(3),
+			},
+			want: func(c *Config) {
+				*c = Config{BatchSizeBytes: 1, SendersCount: 3}
+			},
+		},
+		{
+			name: "options_struct_zero_fields_keep_defaults",
+			opts: []Option{WithOptions(Options{SendersCount: 4})},
+			want: func(c *Config) {
+				c.SendersCount = 4
+			},
+		},
+		{
+			name:    "two_options_structs",
+			opts:    []Option{WithOptions(Options{}, Options{})},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "negative_options_struct",
+			opts:    []Option{WithOptions(Options{BatchSize: -1})},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "negative_input_chan_size",
+			opts:    []Option{WithInputChanSize(-1)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "zero_batch_size",
+			opts:    []Option{WithBatchSize(0)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "zero_flush_interval",
+			opts:    []Option{WithFlushInterval(0)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "zero_senders",
+			opts:    []Option{WithSenders(0)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "retry_delay_over_max",
+			opts:    []Option{WithRetry(1, time.Second, time.Millisecond)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "nil_encoder",
+			opts:    []Option{WithEncoder(nil)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "nil_failure_handler",
+			opts:    []Option{WithFailureHandler(nil)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "nil_error_handler",
+			opts:    []Option{WithErrorHandler(nil)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name: "logging",
+			opts: []Option{WithName("billing"), WithLogSampling(time.Minute, 3)},
+			want: func(c *Config) {
+				c.Name = "billing"
+				c.LogSampleInterval = time.Minute
+				c.LogSampleBurst = 3
+			},
+		},
+		{
+			name:    "zero_log_sample_burst",
+			opts:    []Option{WithLogSampling(time.Second, 0)},
+			wantErr: errs.ErrValidation,
+		},
+		{
+			name:    "nil_logger",
+			opts:    []Option{WithLogger(nil)},
+			wantErr: errs.ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				s := &settings{cfg: DefaultConfig()}
+
+				var err error
+				for _, opt := range tt.opts {
+					if err = opt(s); err != nil {
+						break
+					}
+				}
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Option error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if tt.wantErr != nil {
+					return
+				}
+
+				want := DefaultConfig()
+				tt.want(&want)
+
+				if diff := cmp.Diff(want, s.cfg); diff != "" {
+					t.Errorf("settings mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	c := &recordingClient{}
+
+	n, err := New(
+		"http://localhost:8080/notify",
+		WithHTTPClient(c),
+		WithEncoder(codec.NDJSON),
+		WithHeader("X-Source", "billing"),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	if diff := cmp.Diff([]string{"\"hello\"\n"}, c.bodies); diff != "" {
+		t.Errorf("Body mismatch (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff("billing", c.headers[0].Get("X-Source")); diff != "" {
+		t.Errorf("Header mismatch (-want +got):\n%s", diff)
+	}
+
+	// rate limiting is done by Senders, so it applies to custom clients too
+	if n.limiter == nil {
+		t.Error("custom HTTP client must get a rate limiter")
+	}
+}
+
+// upperCodec is a custom codec that is not registered by name.
+type upperCodec struct {
+	codec.Codec
+}
+
+func (upperCodec) Name() string {
+	return "upper"
+}
+
+func (c upperCodec) Encode(msgs []string) ([]byte, error) {
+	body, err := c.Codec.Encode(msgs)
+	return bytes.ToUpper(body), err
+}
+
+func TestNew_Custom_Encoder(t *testing.T) {
+	t.Parallel()
+
+	c := &recordingClient{}
+
+	n, err := New("http://localhost:8080/notify", WithHTTPClient(c), WithEncoder(upperCodec{codec.NDJSON}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	n.Start()
+	n.Notify("hello")
+	n.Stop()
+
+	if diff := cmp.Diff([]string{"\"HELLO\"\n"}, c.bodies); diff != "" {
+		t.Errorf("Body mismatch (-want +got):\n%s", diff)
+	}
+
+	// without WithEncoder the name must be registered
+	cfg := DefaultConfig()
+	cfg.Encoder = upperCodec{}.Name()
+	if _, err = New("http://localhost:8080/notify", WithConfig(cfg)); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("New() error = %v, want %v", err, errs.ErrValidation)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		url  string
+		opts []Option
+	}{
+		{
+			name: "missing_url",
+			url:  "",
+		},
+		{
+			name: "invalid_option",
+			url:  "http://localhost:8080/notify",
+			opts: []Option{WithSenders(-1)},
+		},
+		{
+			name: "invalid_config",
+			url:  "http://localhost:8080/notify",
+			opts: []Option{WithConfig(Config{})},
+		},
+		{
+			name: "transport_with_streaming",
+			url:  "http://localhost:8080/notify",
+			opts: []Option{
+				WithTransport(grpc.NewTransport("http://localhost:9090", grpc.Options{})), WithStreaming(1, 1),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				if _, err := New(tt.url, tt.opts...); !errors.Is(err, errs.ErrValidation) {
+					t.Errorf("New() error = %v, want %v", err, errs.ErrValidation)
+				}
+			},
+		)
+	}
+}
+
+func TestDefault_Invalid_Options(t *testing.T) {
+	t.Parallel()
+
+	n, err := Default("http://localhost:8080/notify", Options{}, Options{})
+	if !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Default() error = %v, want %v", err, errs.ErrValidation)
+	}
+	if n != nil {
+		t.Error("Default() returned Notifier with an error")
+	}
+}
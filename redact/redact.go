@@ -0,0 +1,214 @@
+// Package redact removes personal data from messages before they reach logs, metrics or dead-letter storage.
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"notifier/errs"
+)
+
+const (
+	// ModeMask replaces matches of rules with Mask
+	ModeMask = ""
+	// ModeHash replaces matches of rules with their hash, so equal values can still be correlated
+	ModeHash = "hash"
+	// ModeSummary replaces the whole message with its length and hash, rules are not needed
+	ModeSummary = "summary"
+
+	// Mask replaces redacted values in ModeMask
+	Mask = "[REDACTED]"
+
+	// hashLen is the number of hex digits of hashes that are kept
+	hashLen = 16
+)
+
+// Config declares redaction rules.
+type Config struct {
+	// Mode is one of ModeMask, ModeHash or ModeSummary
+	Mode string `yaml:"mode" json:"mode"`
+	// Patterns are regular expressions of values to redact, e.g. emails or card numbers
+	Patterns []string `yaml:"patterns" json:"patterns"`
+	// Fields are dot separated paths of JSON fields to redact, e.g. user.email. * matches any key or array element.
+	Fields []string `yaml:"fields" json:"fields"`
+	// HashKey keys hashes with HMAC, so short values can't be found by hashing guesses. Empty uses plain SHA-256.
+	HashKey string `yaml:"hash_key" json:"hash_key"`
+	// DeadLetters applies the rules to messages passed to the failure handler too
+	DeadLetters bool `yaml:"dead_letters" json:"dead_letters"`
+}
+
+// Enabled reports whether c redacts anything.
+func (c Config) Enabled() bool {
+	return c.Mode == ModeSummary || len(c.Patterns) > 0 || len(c.Fields) > 0
+}
+
+// Redactor applies redaction rules. A nil Redactor returns messages as is.
+type Redactor struct {
+	mode     string
+	patterns []*regexp.Regexp
+	fields   [][]string
+	hashKey  []byte
+}
+
+// New compiles rules of cfg.
+func New(cfg Config) (*Redactor, error) {
+	switch cfg.Mode {
+	case ModeMask, ModeHash, ModeSummary:
+	default:
+		return nil, errs.Wrap(errs.ErrValidation, "redaction mode must be hash, summary or empty, got "+cfg.Mode)
+	}
+
+	r := &Redactor{mode: cfg.Mode, hashKey: []byte(cfg.HashKey)}
+
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errs.Wrap(errs.ErrValidation, "redaction pattern: "+err.Error())
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	for _, field := range cfg.Fields {
+		path := strings.Split(field, ".")
+		for _, key := range path {
+			if key == "" {
+				return nil, errs.Wrap(errs.ErrValidation, "redaction field has an empty key: "+field)
+			}
+		}
+		r.fields = append(r.fields, path)
+	}
+
+	return r, nil
+}
+
+// Redact returns msg without values that match the rules.
+func (r *Redactor) Redact(msg string) string {
+	if r == nil {
+		return msg
+	}
+
+	if r.mode == ModeSummary {
+		return "len=" + strconv.Itoa(len(msg)) + " sha256=" + r.hash(msg)
+	}
+
+	if len(r.fields) > 0 {
+		msg = r.redactFields(msg)
+	}
+
+	for _, re := range r.patterns {
+		msg = re.ReplaceAllStringFunc(msg, r.replace)
+	}
+
+	return msg
+}
+
+// Transform is transform.Transformer that redacts messages before they are sent.
+func (r *Redactor) Transform(msg string) (string, error) {
+	return r.Redact(msg), nil
+}
+
+// RedactAll returns msgs redacted. msgs are not modified.
+func (r *Redactor) RedactAll(msgs []string) []string {
+	if r == nil {
+		return msgs
+	}
+
+	redacted := make([]string, len(msgs))
+	for i, msg := range msgs {
+		redacted[i] = r.Redact(msg)
+	}
+
+	return redacted
+}
+
+// replace returns what a redacted value is replaced with.
+func (r *Redactor) replace(value string) string {
+	if r.mode == ModeHash {
+		return "sha256:" + r.hash(value)
+	}
+
+	return Mask
+}
+
+func (r *Redactor) hash(value string) string {
+	var sum []byte
+	if len(r.hashKey) > 0 {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(value))
+		sum = mac.Sum(nil)
+	} else {
+		s := sha256.Sum256([]byte(value))
+		sum = s[:]
+	}
+
+	return hex.EncodeToString(sum)[:hashLen]
+}
+
+// redactFields replaces fields of a JSON message. Messages that are not JSON or have none of the fields
+// are returned as is.
+func (r *Redactor) redactFields(msg string) string {
+	d := json.NewDecoder(strings.NewReader(msg))
+	d.UseNumber()
+
+	var v any
+	if d.Decode(&v) != nil || d.More() {
+		return msg
+	}
+
+	redacted := false
+	for _, path := range r.fields {
+		v = r.redactPath(v, path, &redacted)
+	}
+	if !redacted {
+		return msg
+	}
+
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if e.Encode(v) != nil {
+		return msg
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// redactPath returns v with values at path replaced.
+func (r *Redactor) redactPath(v any, path []string, redacted *bool) any {
+	if len(path) == 0 {
+		*redacted = true
+
+		// numbers and objects are replaced by the hash of their JSON
+		s, ok := v.(string)
+		if !ok {
+			b, _ := json.Marshal(v)
+			s = string(b)
+		}
+
+		return r.replace(s)
+	}
+
+	key, rest := path[0], path[1:]
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if key == "*" || key == k {
+				v[k] = r.redactPath(child, rest, redacted)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			if key == "*" || key == strconv.Itoa(i) {
+				v[i] = r.redactPath(child, rest, redacted)
+			}
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,107 @@
+package redact
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/errs"
+)
+
+func TestRedactor_Redact(t *testing.T) {
+	t.Parallel()
+
+	const email = `[a-z]+@[a-z.]+`
+
+	tests := []struct {
+		name string
+		cfg  Config
+		msg  string
+		want string
+	}{
+		{
+			name: "pattern",
+			cfg:  Config{Patterns: []string{email}},
+			msg:  "mail bob@example.com or amy@example.org",
+			want: "mail [REDACTED] or [REDACTED]",
+		},
+		{
+			name: "fields",
+			cfg:  Config{Fields: []string{"user.email", "cards.*.number", "ssn"}},
+			msg:  `{"user":{"email":"bob@example.com","id":7},"cards":[{"number":4111},{"number":"5500"}],"note":"<b>"}`,
+			want: `{"cards":[{"number":"[REDACTED]"},{"number":"[REDACTED]"}],"note":"<b>",` +
+				`"user":{"email":"[REDACTED]","id":7}}`,
+		},
+		{
+			name: "fields_missing",
+			cfg:  Config{Fields: []string{"user.email"}},
+			msg:  `{"id": 1}`,
+			want: `{"id": 1}`,
+		},
+		{
+			name: "fields_not_json",
+			cfg:  Config{Fields: []string{"user.email"}, Patterns: []string{email}},
+			msg:  `user.email=bob@example.com`,
+			want: `user.email=[REDACTED]`,
+		},
+		{
+			name: "hash",
+			cfg:  Config{Mode: ModeHash, Fields: []string{"email"}},
+			msg:  `{"email":"bob@example.com"}`,
+			want: `{"email":"sha256:5ff860bf1190596c"}`,
+		},
+		{
+			name: "keyed_hash",
+			cfg:  Config{Mode: ModeHash, Patterns: []string{email}, HashKey: "key"},
+			msg:  `bob@example.com`,
+			want: `sha256:b55c2e91fb8602a0`,
+		},
+		{
+			name: "summary",
+			cfg:  Config{Mode: ModeSummary},
+			msg:  `bob@example.com`,
+			want: `len=15 sha256=5ff860bf1190596c`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				r, err := New(tt.cfg)
+				if err != nil {
+					t.Fatalf("New() error = %v", err)
+				}
+
+				if diff := cmp.Diff(tt.want, r.Redact(tt.msg)); diff != "" {
+					t.Errorf("Redact() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestRedactor_Nil(t *testing.T) {
+	t.Parallel()
+
+	var r *Redactor
+	if diff := cmp.Diff("bob@example.com", r.Redact("bob@example.com")); diff != "" {
+		t.Errorf("Redact() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, cfg := range []Config{
+		{Mode: "drop"},
+		{Patterns: []string{"("}},
+		{Fields: []string{"user..email"}},
+	} {
+		if _, err := New(cfg); !errors.Is(err, errs.ErrValidation) {
+			t.Errorf("New(%+v) error = %v, want %v", cfg, err, errs.ErrValidation)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package retry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"notifier/client"
+)
+
+// Error is a failed attempt. Response is kept, so the failure can be classified by Policy.
+type Error struct {
+	// Response is nil if the request failed before the response was received
+	Response *http.Response
+	Err      error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
+	return "unexpected status code " + strconv.Itoa(e.Response.StatusCode)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Result extracts response and cause of a failed attempt from err. Response is nil if err isn't *Error.
+func Result(err error) (*http.Response, error) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Response, err
+	}
+
+	return nil, err
+}
+
+type onceClient struct {
+	next    client.HTTPClient
+	timeout time.Duration
+}
+
+// Once wraps next, so every Do is a single attempt limited by timeout (zero means no limit).
+// Failed attempts, including unsuccessful statuses returned without error, are returned as *Error.
+// Callers are expected to retry later with Policy.Next.
+func Once(next client.HTTPClient, timeout time.Duration) client.HTTPClient {
+	return &onceClient{next: next, timeout: timeout}
+}
+
+func (c *onceClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return attempt(ctx, c.next, req, c.timeout)
+}
+
+func attempt(ctx context.Context, next client.HTTPClient, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	resp, err := do(ctx, next, req, timeout)
+
+	if err == nil && resp != nil && resp.StatusCode >= 200 && resp.StatusCode <= 399 {
+		return resp, nil
+	}
+
+	if err == nil && resp == nil {
+		return nil, &Error{Err: io.ErrUnexpectedEOF}
+	}
+
+	return resp, &Error{Response: resp, Err: err}
+}
+
+func do(ctx context.Context, next client.HTTPClient, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return next.Do(ctx, req)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := next.Do(attemptCtx, req.WithContext(attemptCtx))
+
+	// response body can't be read once the attempt context is canceled
+	if resp != nil && resp.Body != nil {
+		data, readErr := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+
+		if err == nil && readErr != nil {
+			err = readErr
+		}
+	}
+
+	return resp, err
+}
+
+// replayable returns a copy of req with body that can be read again. body is the buffered original body.
+func replayable(ctx context.Context, req *http.Request, body []byte) *http.Request {
+	r := req.Clone(ctx)
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		r.ContentLength = int64(len(body))
+	}
+
+	return r
+}
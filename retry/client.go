@@ -0,0 +1,76 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"notifier/client"
+	"notifier/clock"
+	"notifier/log"
+	"notifier/log/tag"
+)
+
+// Client retries requests of the wrapped client.HTTPClient in place according to Policy.
+// Request body is buffered once, so it can be sent again.
+// Notifier doesn't block Senders with in place retries, it re-queues failed batches instead.
+type Client struct {
+	next   client.HTTPClient
+	policy Policy
+}
+
+// NewClient wraps next with retries.
+func NewClient(next client.HTTPClient, policy Policy) *Client {
+	return &Client{next: next, policy: policy}
+}
+
+func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	clk := clock.OrReal(c.policy.Clock)
+	start := clk.Now()
+
+	for n := 1; ; n++ {
+		resp, err := attempt(ctx, c.next, replayable(ctx, req, body), c.policy.PerAttemptTimeout)
+		if err == nil {
+			return resp, nil
+		}
+
+		// caller is not interested in the result anymore
+		if ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay, ok := c.policy.Next(n, clk.Since(start), resp, err)
+		if !ok {
+			return resp, err
+		}
+
+		log.FromContext(ctx).WarnContext(
+			ctx, "retrying request", tag.Attempt, n, "delay_ms", delay.Milliseconds(), tag.Err, err,
+		)
+
+		timer := clk.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, err
+		case <-timer.C():
+		}
+	}
+}
+
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	defer func() {
+		_ = req.Body.Close()
+	}()
+
+	return io.ReadAll(req.Body)
+}
@@ -0,0 +1,228 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// scriptedClient returns prepared results one by one and records request bodies.
+type scriptedClient struct {
+	mu      sync.Mutex
+	results []func(ctx context.Context) (*http.Response, error)
+	bodies  []string
+}
+
+func (c *scriptedClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+
+	c.mu.Lock()
+	i := len(c.bodies)
+	c.bodies = append(c.bodies, string(body))
+	c.mu.Unlock()
+
+	return c.results[i](ctx)
+}
+
+func status(code int) func(ctx context.Context) (*http.Response, error) {
+	return func(context.Context) (*http.Response, error) {
+		return &http.Response{StatusCode: code, Header: http.Header{}, Body: http.NoBody}, nil
+	}
+}
+
+func TestClient_Do(t *testing.T) {
+	t.Parallel()
+
+	policy := DefaultPolicy()
+	policy.InitialDelay = time.Millisecond
+	policy.MaxDelay = time.Millisecond
+
+	tests := []struct {
+		name         string
+		policy       Policy
+		results      []func(ctx context.Context) (*http.Response, error)
+		wantStatus   int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			name:         "success_first_attempt",
+			policy:       policy,
+			results:      []func(ctx context.Context) (*http.Response, error){status(http.StatusOK)},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 1,
+		},
+		{
+			name:   "retry_until_success",
+			policy: policy,
+			results: []func(ctx context.Context) (*http.Response, error){
+				status(http.StatusServiceUnavailable),
+				func(context.Context) (*http.Response, error) { return nil, io.ErrUnexpectedEOF },
+				status(http.StatusAccepted),
+			},
+			wantStatus:   http.StatusAccepted,
+			wantAttempts: 3,
+		},
+		{
+			name:   "attempts_exhausted",
+			policy: policy,
+			results: []func(ctx context.Context) (*http.Response, error){
+				status(http.StatusBadGateway),
+				status(http.StatusBadGateway),
+				status(http.StatusBadGateway),
+				status(http.StatusBadGateway),
+			},
+			wantStatus:   http.StatusBadGateway,
+			wantErr:      true,
+			wantAttempts: DefaultMaxAttempts,
+		},
+		{
+			name:   "not_retryable_status",
+			policy: policy,
+			results: []func(ctx context.Context) (*http.Response, error){
+				status(http.StatusBadRequest),
+			},
+			wantStatus:   http.StatusBadRequest,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "per_attempt_timeout",
+			policy: func() Policy {
+				p := policy
+				p.PerAttemptTimeout = 10 * time.Millisecond
+				return p
+			}(),
+			results: []func(ctx context.Context) (*http.Response, error){
+				func(ctx context.Context) (*http.Response, error) {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				},
+				func(context.Context) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+				},
+			},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:   "no_retry",
+			policy: NoRetry(),
+			results: []func(ctx context.Context) (*http.Response, error){
+				func(context.Context) (*http.Response, error) { return nil, errors.New("boom") },
+			},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				next := &scriptedClient{results: tt.results}
+
+				req, err := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader("payload"))
+				if err != nil {
+					t.Fatalf("failed to make request: %v", err)
+				}
+
+				resp, err := NewClient(next, tt.policy).Do(context.Background(), req)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Do() error = %v, wantErr %v", err, tt.wantErr)
+				}
+
+				if resp != nil && resp.StatusCode != tt.wantStatus {
+					t.Errorf("Do() status = %v, want %v", resp.StatusCode, tt.wantStatus)
+				}
+
+				wantBodies := make([]string, tt.wantAttempts)
+				for i := range wantBodies {
+					wantBodies[i] = "payload"
+				}
+
+				// body is sent again on every attempt
+				if diff := cmp.Diff(wantBodies, next.bodies); diff != "" {
+					t.Errorf("attempts mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestClient_Do_Stops_On_Context_Cancel(t *testing.T) {
+	t.Parallel()
+
+	policy := DefaultPolicy()
+	policy.HonorRetryAfter = true
+
+	next := &scriptedClient{
+		results: []func(ctx context.Context) (*http.Response, error){
+			func(context.Context) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Header:     http.Header{"Retry-After": []string{"3600"}},
+					Body:       http.NoBody,
+				}, nil
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader("payload"))
+
+	start := time.Now()
+	resp, _ := NewClient(next, policy).Do(ctx, req)
+
+	if time.Since(start) > time.Second {
+		t.Error("Do() waited for Retry-After despite canceled context")
+	}
+
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Do() resp = %v, want last response", resp)
+	}
+}
+
+func TestOnce(t *testing.T) {
+	t.Parallel()
+
+	next := &scriptedClient{
+		results: []func(ctx context.Context) (*http.Response, error){
+			status(http.StatusServiceUnavailable),
+			status(http.StatusNoContent),
+		},
+	}
+
+	c := Once(next, time.Second)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com", http.NoBody)
+
+	_, err := c.Do(context.Background(), req)
+
+	resp, cause := Result(err)
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Result() resp = %v, want %v", resp, http.StatusServiceUnavailable)
+	}
+
+	if !DefaultPolicy().Retryable(resp, cause) {
+		t.Error("failed attempt must be retryable")
+	}
+
+	if _, err = c.Do(context.Background(), req); err != nil {
+		t.Errorf("Do() error = %v", err)
+	}
+
+	if diff := cmp.Diff(2, len(next.bodies)); diff != "" {
+		t.Errorf("attempts mismatch (-want +got):\n%s", diff)
+	}
+}
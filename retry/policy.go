@@ -0,0 +1,255 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"notifier/clock"
+	"notifier/errs"
+)
+
+const (
+	// DefaultMaxAttempts is the first attempt and 3 retries
+	DefaultMaxAttempts = 4
+	// DefaultInitialDelay is the upper bound of the first backoff
+	DefaultInitialDelay = 100 * time.Millisecond
+	// DefaultMaxDelay caps exponential backoff
+	DefaultMaxDelay = 300 * time.Millisecond
+	// DefaultMultiplier grows backoff upper bound between attempts
+	DefaultMultiplier = 2
+	// DefaultMaxRetryAfter caps delays asked by Retry-After, so a single response doesn't hold a batch for hours
+	DefaultMaxRetryAfter = 10 * time.Second
+)
+
+// DefaultRetryableStatuses are statuses that usually mean the request may succeed later.
+var DefaultRetryableStatuses = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Policy decides whether a failed request is retried and how long to wait before the next attempt.
+// Backoff is exponential with full jitter: a random delay between 0 and min(MaxDelay, InitialDelay*Multiplier^n).
+type Policy struct {
+	// MaxAttempts is the total number of attempts including the first one. 1 disables retries.
+	MaxAttempts int
+	// RetryableStatuses are response statuses that are retried. Network errors are classified by IsRetryableError.
+	RetryableStatuses []int
+
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+
+	// MaxElapsedTime stops retrying once the next attempt would start later than that since the first one.
+	// Zero means no limit.
+	MaxElapsedTime time.Duration
+	// PerAttemptTimeout limits a single attempt. Zero means no limit besides the caller's context.
+	PerAttemptTimeout time.Duration
+	// HonorRetryAfter makes delay equal to Retry-After header of the response if it's present.
+	HonorRetryAfter bool
+	// MaxRetryAfter caps delays asked by Retry-After, longer ones are retried after MaxRetryAfter.
+	// Zero means DefaultMaxRetryAfter.
+	MaxRetryAfter time.Duration
+	// Clock is used to read Retry-After dates and to wait between attempts. Real clock is used if it's nil.
+	Clock clock.Clock
+
+	// jitter returns random duration in [0, d]. It's replaced in tests.
+	jitter func(d time.Duration) time.Duration
+}
+
+// DefaultPolicy returns Policy that retries DefaultRetryableStatuses and network errors 3 times.
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:       DefaultMaxAttempts,
+		RetryableStatuses: DefaultRetryableStatuses,
+		InitialDelay:      DefaultInitialDelay,
+		MaxDelay:          DefaultMaxDelay,
+		Multiplier:        DefaultMultiplier,
+		HonorRetryAfter:   true,
+		MaxRetryAfter:     DefaultMaxRetryAfter,
+	}
+}
+
+// NoRetry returns Policy that makes a single attempt.
+func NoRetry() Policy {
+	return Policy{MaxAttempts: 1}
+}
+
+// Validate reports nonsense values.
+func (p Policy) Validate() error {
+	var problems []error
+
+	check := func(ok bool, msg string) {
+		if !ok {
+			problems = append(problems, errs.Wrap(errs.ErrValidation, msg))
+		}
+	}
+
+	check(p.MaxAttempts > 0, "max attempts must be positive")
+	check(p.InitialDelay >= 0, "initial delay must not be negative")
+	check(p.MaxDelay >= p.InitialDelay, "max delay must not be less than initial delay")
+	check(p.Multiplier == 0 || p.Multiplier >= 1, "multiplier must not be less than 1")
+	check(p.MaxElapsedTime >= 0, "max elapsed time must not be negative")
+	check(p.PerAttemptTimeout >= 0, "per attempt timeout must not be negative")
+	check(p.MaxRetryAfter >= 0, "max retry after must not be negative")
+
+	for _, status := range p.RetryableStatuses {
+		check(status >= 100 && status <= 599, "invalid retryable status "+strconv.Itoa(status))
+	}
+
+	return errors.Join(problems...)
+}
+
+// Retryable reports whether the attempt that ended with resp and err may succeed if repeated.
+// Response status takes precedence over err because HTTP clients often turn statuses into errors.
+func (p Policy) Retryable(resp *http.Response, err error) bool {
+	if resp != nil && resp.StatusCode != 0 {
+		if resp.StatusCode >= 200 && resp.StatusCode <= 399 {
+			return false
+		}
+
+		for _, status := range p.RetryableStatuses {
+			if status == resp.StatusCode {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return IsRetryableError(err)
+}
+
+// Backoff returns delay before the attempt number attempt+1. The first retry follows attempt 1.
+func (p Policy) Backoff(attempt int, resp *http.Response) time.Duration {
+	if p.HonorRetryAfter {
+		if d, ok := RetryAfter(resp, clock.OrReal(p.Clock).Now()); ok {
+			maxRetryAfter := p.MaxRetryAfter
+			if maxRetryAfter == 0 {
+				maxRetryAfter = DefaultMaxRetryAfter
+			}
+
+			return min(d, maxRetryAfter)
+		}
+	}
+
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = DefaultMultiplier
+	}
+
+	upper := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if upper > float64(p.MaxDelay) {
+		upper = float64(p.MaxDelay)
+	}
+
+	jitter := p.jitter
+	if jitter == nil {
+		jitter = fullJitter
+	}
+
+	return jitter(time.Duration(upper))
+}
+
+// Next decides whether attempt number attempt that ended with resp and err is followed by another one.
+// elapsed is the time since the first attempt started.
+func (p Policy) Next(attempt int, elapsed time.Duration, resp *http.Response, err error) (time.Duration, bool) {
+	if !p.Retryable(resp, err) {
+		return 0, false
+	}
+
+	return p.Delay(attempt, elapsed, resp)
+}
+
+// Delay is Next for an attempt that is known to be retryable, e.g. messages rejected in an accepted batch.
+// It only checks that attempts and elapsed time are not exhausted.
+func (p Policy) Delay(attempt int, elapsed time.Duration, resp *http.Response) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	delay := p.Backoff(attempt, resp)
+
+	if p.MaxElapsedTime > 0 && elapsed+delay > p.MaxElapsedTime {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
+
+// RetryAfter parses Retry-After header of resp. Both delay in seconds and HTTP date are supported.
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	d := at.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+
+	return d, true
+}
+
+// IsRetryableError reports whether err is a transient network error: timeouts, refused or reset connections
+// and connections closed in the middle of a response. Cancellation by caller is not retryable.
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
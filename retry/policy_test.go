@@ -0,0 +1,305 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/errs"
+)
+
+func response(status int, header ...string) *http.Response {
+	h := http.Header{}
+	for i := 0; i+1 < len(header); i += 2 {
+		h.Set(header[i], header[i+1])
+	}
+
+	return &http.Response{StatusCode: status, Header: h}
+}
+
+// maxJitter makes backoff deterministic by always picking the upper bound
+func maxJitter(d time.Duration) time.Duration {
+	return d
+}
+
+func TestPolicy_Retryable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{
+			name: "success",
+			resp: response(http.StatusOK),
+			want: false,
+		},
+		{
+			name: "too_many_requests",
+			resp: response(http.StatusTooManyRequests),
+			err:  errs.ErrInternal,
+			want: true,
+		},
+		{
+			name: "bad_gateway",
+			resp: response(http.StatusBadGateway),
+			want: true,
+		},
+		{
+			name: "bad_request",
+			resp: response(http.StatusBadRequest),
+			err:  errs.ErrValidation,
+			want: false,
+		},
+		{
+			name: "connection_reset",
+			err:  &net.OpError{Op: "read", Err: syscall.ECONNRESET},
+			want: true,
+		},
+		{
+			name: "unexpected_eof",
+			err:  fmt.Errorf("read body: %w", io.ErrUnexpectedEOF),
+			want: true,
+		},
+		{
+			name: "attempt_timeout",
+			err:  context.DeadlineExceeded,
+			want: true,
+		},
+		{
+			name: "canceled_by_caller",
+			err:  context.Canceled,
+			want: false,
+		},
+		{
+			name: "unknown_error",
+			err:  errors.New("boom"),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				if got := DefaultPolicy().Retryable(tt.resp, tt.err); got != tt.want {
+					t.Errorf("Retryable() = %v, want %v", got, tt.want)
+				}
+			},
+		)
+	}
+}
+
+func TestPolicy_Next(t *testing.T) {
+	t.Parallel()
+
+	policy := DefaultPolicy()
+	policy.InitialDelay = 100 * time.Millisecond
+	policy.MaxDelay = 300 * time.Millisecond
+	policy.jitter = maxJitter
+
+	tests := []struct {
+		name      string
+		policy    func(p Policy) Policy
+		attempt   int
+		elapsed   time.Duration
+		resp      *http.Response
+		wantDelay time.Duration
+		wantOK    bool
+	}{
+		{
+			name:      "first_retry",
+			attempt:   1,
+			resp:      response(http.StatusServiceUnavailable),
+			wantDelay: 100 * time.Millisecond,
+			wantOK:    true,
+		},
+		{
+			name:      "exponential_growth",
+			attempt:   2,
+			resp:      response(http.StatusServiceUnavailable),
+			wantDelay: 200 * time.Millisecond,
+			wantOK:    true,
+		},
+		{
+			name:      "capped_by_max_delay",
+			attempt:   3,
+			resp:      response(http.StatusServiceUnavailable),
+			wantDelay: 300 * time.Millisecond,
+			wantOK:    true,
+		},
+		{
+			name:    "attempts_exhausted",
+			attempt: DefaultMaxAttempts,
+			resp:    response(http.StatusServiceUnavailable),
+			wantOK:  false,
+		},
+		{
+			name:    "not_retryable",
+			attempt: 1,
+			resp:    response(http.StatusNotFound),
+			wantOK:  false,
+		},
+		{
+			name:      "retry_after_seconds",
+			attempt:   1,
+			resp:      response(http.StatusTooManyRequests, "Retry-After", "2"),
+			wantDelay: 2 * time.Second,
+			wantOK:    true,
+		},
+		{
+			name:      "retry_after_capped",
+			attempt:   1,
+			resp:      response(http.StatusTooManyRequests, "Retry-After", "3600"),
+			wantDelay: DefaultMaxRetryAfter,
+			wantOK:    true,
+		},
+		{
+			name: "retry_after_capped_by_policy",
+			policy: func(p Policy) Policy {
+				p.MaxRetryAfter = time.Second
+				return p
+			},
+			attempt:   1,
+			resp:      response(http.StatusTooManyRequests, "Retry-After", "2"),
+			wantDelay: time.Second,
+			wantOK:    true,
+		},
+		{
+			name: "retry_after_ignored",
+			policy: func(p Policy) Policy {
+				p.HonorRetryAfter = false
+				return p
+			},
+			attempt:   1,
+			resp:      response(http.StatusTooManyRequests, "Retry-After", "2"),
+			wantDelay: 100 * time.Millisecond,
+			wantOK:    true,
+		},
+		{
+			name: "max_elapsed_time_exceeded",
+			policy: func(p Policy) Policy {
+				p.MaxElapsedTime = time.Second
+				return p
+			},
+			attempt: 1,
+			elapsed: 950 * time.Millisecond,
+			resp:    response(http.StatusServiceUnavailable),
+			wantOK:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				p := policy
+				if tt.policy != nil {
+					p = tt.policy(p)
+				}
+
+				gotDelay, gotOK := p.Next(tt.attempt, tt.elapsed, tt.resp, nil)
+				if gotOK != tt.wantOK {
+					t.Fatalf("Next() ok = %v, want %v", gotOK, tt.wantOK)
+				}
+
+				if diff := cmp.Diff(tt.wantDelay, gotDelay); diff != "" {
+					t.Errorf("Next() delay mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestPolicy_Backoff_Full_Jitter(t *testing.T) {
+	t.Parallel()
+
+	p := DefaultPolicy()
+
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(5, nil); got < 0 || got > p.MaxDelay {
+			t.Fatalf("Backoff() = %v, want in [0, %v]", got, p.MaxDelay)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		resp   *http.Response
+		want   time.Duration
+		wantOK bool
+	}{
+		{
+			name: "nil_response",
+		},
+		{
+			name: "no_header",
+			resp: response(http.StatusTooManyRequests),
+		},
+		{
+			name:   "seconds",
+			resp:   response(http.StatusTooManyRequests, "Retry-After", "120"),
+			want:   2 * time.Minute,
+			wantOK: true,
+		},
+		{
+			name:   "http_date",
+			resp:   response(http.StatusServiceUnavailable, "Retry-After", now.Add(time.Minute).Format(http.TimeFormat)),
+			want:   time.Minute,
+			wantOK: true,
+		},
+		{
+			name:   "date_in_the_past",
+			resp:   response(http.StatusServiceUnavailable, "Retry-After", now.Add(-time.Minute).Format(http.TimeFormat)),
+			want:   0,
+			wantOK: true,
+		},
+		{
+			name: "garbage",
+			resp: response(http.StatusServiceUnavailable, "Retry-After", "soon"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				got, ok := RetryAfter(tt.resp, now)
+				if ok != tt.wantOK || got != tt.want {
+					t.Errorf("RetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+				}
+			},
+		)
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	t.Parallel()
+
+	if err := DefaultPolicy().Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	invalid := Policy{MaxAttempts: 0, InitialDelay: time.Second, MaxDelay: time.Millisecond, RetryableStatuses: []int{42}}
+	if err := invalid.Validate(); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Validate() error = %v, want %v", err, errs.ErrValidation)
+	}
+}
@@ -0,0 +1,45 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"notifier/client"
+	"notifier/clock"
+)
+
+type signingClient struct {
+	next   client.HTTPClient
+	secret []byte
+	clock  clock.Clock
+}
+
+// NewClient wraps next, so every request is signed with secret. Retried requests are signed again
+// with a fresh timestamp. Real clock is used if clk is nil.
+func NewClient(next client.HTTPClient, secret []byte, clk clock.Clock) client.HTTPClient {
+	return &signingClient{next: next, secret: secret, clock: clock.OrReal(clk)}
+}
+
+func (c *signingClient) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+	}
+
+	signed := req.Clone(ctx)
+	if signed.Header == nil {
+		signed.Header = http.Header{}
+	}
+	signed.Body = io.NopCloser(bytes.NewReader(body))
+	signed.ContentLength = int64(len(body))
+
+	Sign(signed.Header, c.secret, c.clock.Now(), body)
+
+	return c.next.Do(ctx, signed)
+}
@@ -0,0 +1,63 @@
+package signature
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/clock"
+)
+
+// recordingClient keeps the last request and its body.
+type recordingClient struct {
+	req  *http.Request
+	body []byte
+}
+
+func (c *recordingClient) Do(_ context.Context, req *http.Request) (*http.Response, error) {
+	c.req = req
+	c.body, _ = io.ReadAll(req.Body)
+
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestClient_Signs_Every_Attempt(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	next := &recordingClient{}
+	c := NewClient(next, secret, clk)
+
+	for i := 0; i < 2; i++ {
+		req := &http.Request{
+			Method: http.MethodPost,
+			Header: http.Header{"Content-Type": []string{"application/json"}},
+			Body:   io.NopCloser(strings.NewReader(`{"messages":["hello"]}`)),
+		}
+
+		if _, err := c.Do(context.Background(), req); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+
+		if diff := cmp.Diff(`{"messages":["hello"]}`, string(next.body)); diff != "" {
+			t.Errorf("body mismatch (-want +got):\n%s", diff)
+		}
+
+		if err := Verify(next.req.Header, secret, clk.Now(), DefaultTolerance, next.body); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+
+		if req.Header.Get(HeaderSignature) != "" {
+			t.Error("original request header was modified")
+		}
+
+		// retry is signed with a fresh timestamp
+		clk.Advance(time.Hour)
+	}
+}
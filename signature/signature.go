@@ -0,0 +1,78 @@
+// Package signature signs request bodies with HMAC-SHA256, so receivers can verify that batches come from Notifier.
+//
+// The signature is sent in HeaderSignature as "sha256=<hex>" of HMAC over "<timestamp>.<body>",
+// where timestamp is Unix seconds sent in HeaderTimestamp. Timestamp lets receivers reject replayed requests.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"notifier/errs"
+)
+
+const (
+	HeaderSignature = "X-Notifier-Signature"
+	HeaderTimestamp = "X-Notifier-Timestamp"
+
+	// DefaultTolerance is the max difference between the timestamp of a request and the receiver clock
+	DefaultTolerance = 5 * time.Minute
+
+	prefix = "sha256="
+)
+
+// Sign sets signature headers of body signed at now.
+func Sign(h http.Header, secret []byte, now time.Time, body []byte) {
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	h.Set(HeaderTimestamp, ts)
+	h.Set(HeaderSignature, prefix+hex.EncodeToString(mac(secret, ts, body)))
+}
+
+// Verify checks signature headers of body. Requests signed more than tolerance away from now are rejected,
+// zero tolerance disables the check. Errors wrap errs.ErrUnauthorized.
+func Verify(h http.Header, secret []byte, now time.Time, tolerance time.Duration, body []byte) error {
+	ts := h.Get(HeaderTimestamp)
+	if ts == "" {
+		return errs.Wrap(errs.ErrUnauthorized, "missing "+HeaderTimestamp+" header")
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errs.Wrap(errs.ErrUnauthorized, "malformed "+HeaderTimestamp+" header")
+	}
+
+	if d := now.Sub(time.Unix(unix, 0)).Abs(); tolerance > 0 && d > tolerance {
+		return errs.Wrap(errs.ErrUnauthorized, "timestamp is out of tolerance")
+	}
+
+	sig, ok := strings.CutPrefix(h.Get(HeaderSignature), prefix)
+	if !ok {
+		return errs.Wrap(errs.ErrUnauthorized, "missing or malformed "+HeaderSignature+" header")
+	}
+
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return errs.Wrap(errs.ErrUnauthorized, "malformed "+HeaderSignature+" header")
+	}
+
+	if !hmac.Equal(got, mac(secret, ts, body)) {
+		return errs.Wrap(errs.ErrUnauthorized, "signature mismatch")
+	}
+
+	return nil
+}
+
+func mac(secret []byte, ts string, body []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+
+	return m.Sum(nil)
+}
@@ -0,0 +1,123 @@
+package signature
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"notifier/errs"
+)
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("secret")
+	body := []byte(`{"messages":["hello"]}`)
+	signedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	signed := func() http.Header {
+		h := http.Header{}
+		Sign(h, secret, signedAt, body)
+
+		return h
+	}
+
+	tests := []struct {
+		name      string
+		header    func() http.Header
+		secret    []byte
+		body      []byte
+		now       time.Time
+		tolerance time.Duration
+		wantErr   error
+	}{
+		{
+			name:      "valid",
+			header:    signed,
+			now:       signedAt.Add(time.Minute),
+			tolerance: DefaultTolerance,
+		},
+		{
+			name:    "zero_tolerance_skips_timestamp_check",
+			header:  signed,
+			now:     signedAt.Add(24 * time.Hour),
+			wantErr: nil,
+		},
+		{
+			name:      "wrong_secret",
+			header:    signed,
+			secret:    []byte("other"),
+			now:       signedAt,
+			tolerance: DefaultTolerance,
+			wantErr:   errs.ErrUnauthorized,
+		},
+		{
+			name:      "tampered_body",
+			header:    signed,
+			body:      []byte(`{"messages":["bye"]}`),
+			now:       signedAt,
+			tolerance: DefaultTolerance,
+			wantErr:   errs.ErrUnauthorized,
+		},
+		{
+			name:      "replayed_request",
+			header:    signed,
+			now:       signedAt.Add(time.Hour),
+			tolerance: DefaultTolerance,
+			wantErr:   errs.ErrUnauthorized,
+		},
+		{
+			name: "tampered_timestamp",
+			header: func() http.Header {
+				h := signed()
+				h.Set(HeaderTimestamp, "1767225601")
+				return h
+			},
+			now:       signedAt,
+			tolerance: DefaultTolerance,
+			wantErr:   errs.ErrUnauthorized,
+		},
+		{
+			name:      "missing_headers",
+			header:    func() http.Header { return http.Header{} },
+			now:       signedAt,
+			tolerance: DefaultTolerance,
+			wantErr:   errs.ErrUnauthorized,
+		},
+		{
+			name: "malformed_signature",
+			header: func() http.Header {
+				h := signed()
+				h.Set(HeaderSignature, "sha256=zz")
+				return h
+			},
+			now:       signedAt,
+			tolerance: DefaultTolerance,
+			wantErr:   errs.ErrUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				verifySecret := secret
+				if tt.secret != nil {
+					verifySecret = tt.secret
+				}
+
+				verifyBody := body
+				if tt.body != nil {
+					verifyBody = tt.body
+				}
+
+				err := Verify(tt.header(), verifySecret, tt.now, tt.tolerance, verifyBody)
+				if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+					t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+			},
+		)
+	}
+}
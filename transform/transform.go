@@ -0,0 +1,112 @@
+// Package transform shapes messages between Notify and the Aggregator, e.g. renders them into envelopes
+// an endpoint expects or removes fields it must not receive.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"notifier/errs"
+)
+
+// Transformer returns msg shaped for a destination. Messages it fails on are dropped.
+// It's called from Notify, so it must be concurrent safe.
+type Transformer func(msg string) (string, error)
+
+// Chain returns Transformer that applies ts in order. It fails on the first failed Transformer.
+func Chain(ts ...Transformer) Transformer {
+	return func(msg string) (string, error) {
+		var err error
+		for _, t := range ts {
+			if msg, err = t(msg); err != nil {
+				return "", err
+			}
+		}
+
+		return msg, nil
+	}
+}
+
+// Template returns Transformer that renders text/template text with the message. A message that is valid JSON
+// is decoded, so its fields are available as {{.field}}, any other message is passed as a string.
+// Besides built-in functions, json encodes a value as JSON and default returns its first argument
+// if the second one is missing or empty, e.g. {{json (default "unknown" .severity)}}.
+func Template(text string) (Transformer, error) {
+	tmpl, err := template.New("message").Funcs(template.FuncMap{"json": toJSON, "default": defaultValue}).Parse(text)
+	if err != nil {
+		return nil, errs.Wrap(errs.ErrValidation, "template: "+err.Error())
+	}
+
+	return func(msg string) (string, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data(msg)); err != nil {
+			return "", errs.Wrap(errs.ErrValidation, "template: "+err.Error())
+		}
+
+		return b.String(), nil
+	}, nil
+}
+
+// Rename returns Transformer that renames top-level fields of JSON objects from keys of names to their values.
+// Messages that are not JSON objects are not changed.
+func Rename(names map[string]string) Transformer {
+	return func(msg string) (string, error) {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal([]byte(msg), &fields) != nil {
+			return msg, nil
+		}
+
+		for from, to := range names {
+			if value, ok := fields[from]; ok {
+				delete(fields, from)
+				fields[to] = value
+			}
+		}
+
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return "", errs.Wrap(errs.ErrInternal, err.Error())
+		}
+
+		return string(b), nil
+	}
+}
+
+// data decodes msg for templates. Numbers keep their text, so they are rendered as they came.
+func data(msg string) any {
+	d := json.NewDecoder(strings.NewReader(msg))
+	d.UseNumber()
+
+	var v any
+	if d.Decode(&v) != nil || d.More() {
+		return msg
+	}
+
+	return v
+}
+
+func toJSON(v any) (string, error) {
+	var b bytes.Buffer
+	e := json.NewEncoder(&b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func defaultValue(def, v any) any {
+	switch v := v.(type) {
+	case nil:
+		return def
+	case string:
+		if v == "" {
+			return def
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,135 @@
+package transform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier/errs"
+)
+
+func TestTemplate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		template string
+		msg      string
+		want     string
+		wantErr  error
+	}{
+		{
+			name:     "json_fields",
+			template: `{"text":{{json .title}},"count":{{.count}}}`,
+			msg:      `{"title":"Disk <full>","count":12345678901234567890}`,
+			want:     `{"text":"Disk <full>","count":12345678901234567890}`,
+		},
+		{
+			name:     "nested_fields",
+			template: `{{.alert.host}}: {{.alert.summary}}`,
+			msg:      `{"alert":{"host":"db1","summary":"down"}}`,
+			want:     `db1: down`,
+		},
+		{
+			name:     "default",
+			template: `{"severity":{{json (default "info" .severity)}}}`,
+			msg:      `{"title":"ok"}`,
+			want:     `{"severity":"info"}`,
+		},
+		{
+			name:     "whole_message",
+			template: `{"event":{{json .}}}`,
+			msg:      `{"id":1}`,
+			want:     `{"event":{"id":1}}`,
+		},
+		{
+			name:     "not_json",
+			template: `{"text":{{json .}}}`,
+			msg:      `disk is "full"`,
+			want:     `{"text":"disk is \"full\""}`,
+		},
+		{
+			name:     "execution_error",
+			template: `{{.title.text}}`,
+			msg:      `{"title":"ok"}`,
+			wantErr:  errs.ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				transformer, err := Template(tt.template)
+				if err != nil {
+					t.Fatalf("Template() error = %v", err)
+				}
+
+				got, err := transformer(tt.msg)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("transformer() error = %v, want %v", err, tt.wantErr)
+				}
+				if diff := cmp.Diff(tt.want, got); diff != "" {
+					t.Errorf("transformer() mismatch (-want +got):\n%s", diff)
+				}
+			},
+		)
+	}
+}
+
+func TestTemplate_Invalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := Template(`{{.title`); !errors.Is(err, errs.ErrValidation) {
+		t.Errorf("Template() error = %v, want %v", err, errs.ErrValidation)
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	failed := errors.New("failed")
+	upper := func(msg string) (string, error) { return strings.ToUpper(msg), nil }
+	fail := func(string) (string, error) { return "", failed }
+
+	chain := Chain(Rename(map[string]string{"msg": "text"}), upper)
+	got, err := chain(`{"msg":"hi","id":1}`)
+	if err != nil {
+		t.Fatalf("chain() error = %v", err)
+	}
+	if diff := cmp.Diff(`{"ID":1,"TEXT":"HI"}`, got); diff != "" {
+		t.Errorf("chain() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err = Chain(upper, fail, upper)("hi"); !errors.Is(err, failed) {
+		t.Errorf("chain() error = %v, want %v", err, failed)
+	}
+}
+
+func TestRename(t *testing.T) {
+	t.Parallel()
+
+	rename := Rename(map[string]string{"msg": "text", "missing": "other"})
+
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{msg: `{"msg":"hi","id":{"a":1}}`, want: `{"id":{"a":1},"text":"hi"}`},
+		{msg: `["msg"]`, want: `["msg"]`},
+		{msg: `plain text`, want: `plain text`},
+	}
+
+	for _, tt := range tests {
+		got, err := rename(tt.msg)
+		if err != nil {
+			t.Fatalf("rename(%s) error = %v", tt.msg, err)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("rename(%s) mismatch (-want +got):\n%s", tt.msg, diff)
+		}
+	}
+}
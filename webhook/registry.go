@@ -0,0 +1,329 @@
+// Package webhook fans messages out to a registry of subscriber endpoints. Every subscriber has its own Notifier,
+// so batching, retries, rate limit and failures of one endpoint don't affect the others.
+package webhook
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"notifier"
+	"notifier/clock"
+	"notifier/errs"
+	"notifier/log"
+	"notifier/log/tag"
+)
+
+// Subscriber is an endpoint that receives published messages.
+type Subscriber struct {
+	// ID identifies the subscriber in the registry
+	ID  string
+	URL string
+	// Secret signs request bodies, see signature package. Empty disables signing.
+	Secret string
+	// Events are path.Match patterns of events the subscriber receives, e.g. "order.*". Empty receives all events.
+	Events []string
+	// Disabled subscribers are kept in the registry, but messages are not published to them. The zero value
+	// receives messages.
+	Disabled bool
+	// RPS limits requests per second to the subscriber. Zero keeps the limit of registry options.
+	RPS int
+	// Template renders messages for the subscriber, see transform.Template. Empty sends messages as is.
+	Template string
+}
+
+// matches reports whether the subscriber receives event.
+func (s Subscriber) matches(event string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+
+	for _, pattern := range s.Events {
+		if ok, _ := path.Match(pattern, event); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// State is a Subscriber with its delivery statistics.
+type State struct {
+	Subscriber
+	// Delivered and Failed count messages
+	Delivered int
+	Failed    int
+	// Dropped counts messages that were not published because the input queue of the subscriber was full,
+	// e.g. while its endpoint hangs
+	Dropped int
+	// FailingSince is the time of the first failure since the last delivery, zero while deliveries succeed
+	FailingSince time.Time
+	// LastError is the error of the last failure since the last delivery
+	LastError error
+}
+
+// Options configure Registry.
+type Options struct {
+	// Notifier options are applied to Notifiers of all subscribers, e.g. batch size and retries
+	Notifier []notifier.Option
+	// DisableAfter disables subscribers that keep failing for that long. Zero never disables them.
+	DisableAfter time.Duration
+	// OnFailure is called with messages a subscriber failed to receive, e.g. to store them as dead letters.
+	// It's called from Sender goroutines, so it must be concurrent safe. It may be nil.
+	OnFailure func(sub Subscriber, msgs []string, err error)
+	// OnDisabled is called when a subscriber is disabled after failures. It may be nil.
+	OnDisabled func(sub Subscriber, err error)
+	// Clock measures failure periods. Real clock is used if it's nil.
+	Clock clock.Clock
+	// Logger is used by the registry and Notifiers of subscribers, unless Notifier options set another one.
+	// log.Default() is used if it's nil.
+	Logger log.Logger
+}
+
+// Registry delivers published messages to subscribers that can be added and removed at runtime.
+type Registry struct {
+	opts  Options
+	clock clock.Clock
+	log   log.Logger
+
+	// mu guards subs and stopped. Publish holds it for reading, so Remove doesn't stop a Notifier in use.
+	// Nothing blocks while it's held, so a hanging subscriber doesn't hold back the others.
+	mu      sync.RWMutex
+	subs    map[string]*subscription
+	stopped bool
+}
+
+// subscription is a subscriber with its Notifier.
+type subscription struct {
+	notifier *notifier.Notifier
+
+	// mu guards state, which is updated by handlers of the Notifier
+	mu    sync.Mutex
+	state State
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry(opts Options) *Registry {
+	return &Registry{
+		opts:  opts,
+		clock: clock.OrReal(opts.Clock),
+		log:   log.OrDefault(opts.Logger),
+		subs:  make(map[string]*subscription),
+	}
+}
+
+// Add starts delivery to sub. IDs must be unique.
+func (r *Registry) Add(sub Subscriber) error {
+	if sub.ID == "" {
+		return errs.Wrap(errs.ErrValidation, "subscriber id is required")
+	}
+	for _, pattern := range sub.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errs.Wrap(errs.ErrValidation, "subscriber "+sub.ID+": invalid event pattern "+pattern)
+		}
+	}
+
+	sub.Events = slices.Clone(sub.Events)
+	s := &subscription{state: State{Subscriber: sub}}
+
+	opts := append(
+		[]notifier.Option{notifier.WithLogger(r.log)},
+		r.opts.Notifier...,
+	)
+	opts = append(
+		opts,
+		notifier.WithName(sub.ID),
+		notifier.WithSuccessHandler(s.delivered),
+		notifier.WithFailureHandler(
+			func(msgs []string, err error) {
+				r.failed(s, msgs, err)
+			},
+		),
+	)
+	if sub.Secret != "" {
+		opts = append(opts, notifier.WithSigningSecret(sub.Secret))
+	}
+	if sub.RPS != 0 {
+		opts = append(opts, notifier.WithRateLimit(sub.RPS))
+	}
+	if sub.Template != "" {
+		opts = append(opts, notifier.WithTemplate(sub.Template))
+	}
+
+	n, err := notifier.New(sub.URL, opts...)
+	if err != nil {
+		return errs.Wrap(err, "subscriber "+sub.ID)
+	}
+	s.notifier = n
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped {
+		return errs.Wrap(errs.ErrValidation, "registry is stopped")
+	}
+	if _, ok := r.subs[sub.ID]; ok {
+		return errs.Wrap(errs.ErrValidation, "subscriber "+sub.ID+" already exists")
+	}
+
+	n.Start()
+	r.subs[sub.ID] = s
+
+	return nil
+}
+
+// Remove stops delivery to the subscriber. Messages already published to it are delivered before Remove returns.
+func (r *Registry) Remove(id string) error {
+	r.mu.Lock()
+	s, ok := r.subs[id]
+	delete(r.subs, id)
+	r.mu.Unlock()
+
+	if !ok {
+		return errs.Wrap(errs.ErrNotFound, "subscriber "+id)
+	}
+
+	s.notifier.Stop()
+
+	return nil
+}
+
+// Enable resumes publishing to the subscriber and forgets its failures.
+func (r *Registry) Enable(id string) error {
+	return r.update(
+		id, func(st *State) {
+			st.Disabled = false
+			st.FailingSince = time.Time{}
+			st.LastError = nil
+		},
+	)
+}
+
+// Disable pauses publishing to the subscriber. Messages already published to it are still delivered.
+func (r *Registry) Disable(id string) error {
+	return r.update(id, func(st *State) { st.Disabled = true })
+}
+
+func (r *Registry) update(id string, f func(st *State)) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.subs[id]
+	if !ok {
+		return errs.Wrap(errs.ErrNotFound, "subscriber "+id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f(&s.state)
+
+	return nil
+}
+
+// Publish sends msg of event to every enabled subscriber whose events match. It never blocks: msg is dropped
+// for subscribers whose input queue is full, like NotifyAndForget, and counted in State.Dropped.
+// It returns the number of subscribers msg is sent to.
+func (r *Registry) Publish(event, msg string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, s := range r.subs {
+		s.mu.Lock()
+		ok := !s.state.Disabled && s.state.matches(event)
+		s.mu.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		if s.notifier.NotifyAndForget(msg) {
+			count++
+			continue
+		}
+
+		s.mu.Lock()
+		s.state.Dropped++
+		s.mu.Unlock()
+	}
+
+	return count
+}
+
+// Subscribers returns states of all subscribers ordered by ID.
+func (r *Registry) Subscribers() []State {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	states := make([]State, 0, len(r.subs))
+	for _, s := range r.subs {
+		s.mu.Lock()
+		st := s.state
+		s.mu.Unlock()
+
+		st.Events = slices.Clone(st.Events)
+		states = append(states, st)
+	}
+
+	slices.SortFunc(states, func(a, b State) int { return strings.Compare(a.ID, b.ID) })
+
+	return states
+}
+
+// Stop removes all subscribers. Messages already published are delivered before Stop returns.
+func (r *Registry) Stop() {
+	r.mu.Lock()
+	r.stopped = true
+	subs := r.subs
+	r.subs = make(map[string]*subscription)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		wg.Go(s.notifier.Stop)
+	}
+	wg.Wait()
+}
+
+func (s *subscription) delivered(msgs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Delivered += len(msgs)
+	s.state.FailingSince = time.Time{}
+	s.state.LastError = nil
+}
+
+// failed records the failure of s and disables it if it keeps failing for DisableAfter.
+func (r *Registry) failed(s *subscription, msgs []string, err error) {
+	now := r.clock.Now()
+
+	s.mu.Lock()
+	s.state.Failed += len(msgs)
+	s.state.LastError = err
+	if s.state.FailingSince.IsZero() {
+		s.state.FailingSince = now
+	}
+
+	disable := !s.state.Disabled && r.opts.DisableAfter > 0 && now.Sub(s.state.FailingSince) >= r.opts.DisableAfter
+	if disable {
+		s.state.Disabled = true
+	}
+	sub := s.state.Subscriber
+	s.mu.Unlock()
+
+	if r.opts.OnFailure != nil {
+		r.opts.OnFailure(sub, msgs, err)
+	}
+
+	if disable {
+		r.log.Warn("webhook: subscriber is disabled after failures", tag.ID, sub.ID, tag.Err, err)
+
+		if r.opts.OnDisabled != nil {
+			r.opts.OnDisabled(sub, err)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"notifier"
+	"notifier/errs"
+	"notifier/notifiertest"
+	"notifier/signature"
+)
+
+var testOptions = []notifier.Option{notifier.WithFlushInterval(10 * time.Millisecond)}
+
+func TestRegistry_Publish(t *testing.T) {
+	t.Parallel()
+
+	orders, all, disabled := notifiertest.NewServer(t), notifiertest.NewServer(t), notifiertest.NewServer(t)
+
+	r := NewRegistry(Options{Notifier: testOptions})
+	for _, sub := range []Subscriber{
+		{ID: "orders", URL: orders.URL, Events: []string{"order.*"}},
+		{ID: "all", URL: all.URL, Secret: "secret", RPS: 10},
+		{ID: "disabled", URL: disabled.URL, Disabled: true},
+	} {
+		if err := r.Add(sub); err != nil {
+			t.Fatalf("Add(%s) error = %v", sub.ID, err)
+		}
+	}
+
+	got := []int{r.Publish("order.created", "msg1"), r.Publish("user.created", "msg2")}
+	if diff := cmp.Diff([]int{2, 1}, got); diff != "" {
+		t.Errorf("Publish() mismatch (-want +got):\n%s", diff)
+	}
+
+	orders.WaitForMessages(t, 1, time.Second)
+	all.WaitForMessages(t, 2, time.Second)
+	r.Stop()
+
+	orders.AssertDelivered(t, "msg1")
+	all.AssertDelivered(t, "msg1", "msg2")
+	disabled.AssertDelivered(t)
+
+	for _, b := range all.Batches() {
+		if err := signature.Verify(b.Header, []byte("secret"), time.Now(), time.Minute, b.Body); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	}
+
+	if diff := cmp.Diff(0, r.Publish("order.created", "msg3")); diff != "" {
+		t.Errorf("Publish() after Stop mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRegistry_Add_Remove(t *testing.T) {
+	t.Parallel()
+
+	server := notifiertest.NewServer(t)
+
+	r := NewRegistry(Options{Notifier: testOptions})
+	defer r.Stop()
+
+	sub := Subscriber{ID: "sub", URL: server.URL}
+	if err := r.Add(sub); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "duplicate", err: r.Add(sub), wantErr: errs.ErrValidation},
+		{name: "missing_id", err: r.Add(Subscriber{URL: server.URL}), wantErr: errs.ErrValidation},
+		{name: "missing_url", err: r.Add(Subscriber{ID: "other"}), wantErr: errs.ErrValidation},
+		{
+			name:    "invalid_pattern",
+			err:     r.Add(Subscriber{ID: "other", URL: server.URL, Events: []string{"[order"}}),
+			wantErr: errs.ErrValidation,
+		},
+		{name: "remove_unknown", err: r.Remove("other"), wantErr: errs.ErrNotFound},
+		{name: "enable_unknown", err: r.Enable("other"), wantErr: errs.ErrNotFound},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, tt.err, tt.wantErr)
+		}
+	}
+
+	r.Publish("event", "msg1")
+
+	// published messages are delivered before Remove returns
+	if err := r.Remove("sub"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	server.AssertDelivered(t, "msg1")
+
+	if diff := cmp.Diff(0, r.Publish("event", "msg2")); diff != "" {
+		t.Errorf("Publish() after Remove mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]State{}, r.Subscribers()); diff != "" {
+		t.Errorf("Subscribers() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRegistry_Publish_Does_Not_Block_On_Hanging_Subscriber(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	hanging := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, req *http.Request) {
+				select {
+				case <-release:
+				case <-req.Context().Done():
+				}
+			},
+		),
+	)
+	defer hanging.Close()
+	healthy := notifiertest.NewServer(t)
+
+	r := NewRegistry(
+		Options{
+			Notifier: append(
+				slices.Clone(testOptions), notifier.WithInputChanSize(1), notifier.WithOutputChanSize(0),
+				notifier.WithSenders(1),
+			),
+		},
+	)
+	defer r.Stop()
+	defer close(release)
+
+	for _, sub := range []Subscriber{
+		{ID: "hanging", URL: hanging.URL},
+		{ID: "healthy", URL: healthy.URL},
+	} {
+		if err := r.Add(sub); err != nil {
+			t.Fatalf("Add(%s) error = %v", sub.ID, err)
+		}
+	}
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+
+		for i := range 50 {
+			r.Publish("event", fmt.Sprintf("msg%d", i))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish() blocks on the hanging subscriber")
+	}
+
+	states := r.Subscribers()
+	if states[0].Dropped == 0 {
+		t.Errorf("Subscribers()[0] = %+v, want dropped messages", states[0])
+	}
+
+	// messages published to the healthy subscriber are delivered
+	healthy.WaitForMessages(t, 50-states[1].Dropped, time.Second)
+}
+
+func TestRegistry_Disables_Failing_Subscribers(t *testing.T) {
+	t.Parallel()
+
+	failing, healthy := notifiertest.NewServer(t), notifiertest.NewServer(t)
+	failing.SetDefault(notifiertest.Fail(http.StatusBadRequest))
+
+	var logs syncBuffer
+	disabled := make(chan Subscriber, 1)
+	r := NewRegistry(
+		Options{
+			Notifier:     testOptions,
+			DisableAfter: 50 * time.Millisecond,
+			OnDisabled: func(sub Subscriber, _ error) {
+				disabled <- sub
+			},
+			Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+		},
+	)
+	defer r.Stop()
+
+	for _, sub := range []Subscriber{
+		{ID: "failing", URL: failing.URL},
+		{ID: "healthy", URL: healthy.URL},
+	} {
+		if err := r.Add(sub); err != nil {
+			t.Fatalf("Add(%s) error = %v", sub.ID, err)
+		}
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+
+	for done := false; !done; {
+		select {
+		case sub := <-disabled:
+			if diff := cmp.Diff("failing", sub.ID); diff != "" {
+				t.Errorf("disabled subscriber mismatch (-want +got):\n%s", diff)
+			}
+			done = true
+		case <-ticker.C:
+			r.Publish("event", "msg")
+		case <-timeout:
+			t.Fatal("subscriber is not disabled")
+		}
+	}
+
+	if !strings.Contains(logs.String(), "webhook: subscriber is disabled after failures") {
+		t.Errorf("logs = %q, want the subscriber to be reported as disabled", logs.String())
+	}
+
+	states := r.Subscribers()
+	if !states[0].Disabled || states[0].FailingSince.IsZero() || states[0].Failed == 0 || states[0].LastError == nil {
+		t.Errorf("Subscribers()[0] = %+v, want disabled failing subscriber", states[0])
+	}
+	if states[1].Disabled || !states[1].FailingSince.IsZero() {
+		t.Errorf("Subscribers()[1] = %+v, want enabled healthy subscriber", states[1])
+	}
+
+	if diff := cmp.Diff(1, r.Publish("event", "msg")); diff != "" {
+		t.Errorf("Publish() with disabled subscriber mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := r.Enable("failing"); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	if diff := cmp.Diff(2, r.Publish("event", "msg")); diff != "" {
+		t.Errorf("Publish() after Enable mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// syncBuffer is bytes.Buffer that loggers of different goroutines can write to.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}